@@ -5,8 +5,23 @@
 // @schemes http https
 package main
 
-import "github.com/drago44/golang-todo-api/internal/app"
+import (
+	"os"
+
+	"github.com/drago44/golang-todo-api/internal/app"
+)
 
 func main() {
-	app.Run()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		// `server migrate <command>` manages the schema instead of serving
+		case "migrate":
+			os.Exit(app.RunMigrate(os.Args[2:]))
+		// `server config print` shows the effective configuration
+		case "config":
+			os.Exit(app.RunConfig(os.Args[2:]))
+		}
+	}
+
+	app.Run(os.Args[1:])
 }
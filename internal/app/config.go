@@ -2,86 +2,227 @@
 package app
 
 import (
+	"errors"
+	"io"
+	"io/fs"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/drago44/golang-todo-api/internal/cors"
+	"github.com/drago44/golang-todo-api/internal/ipfilter"
+	"github.com/drago44/golang-todo-api/internal/ratelimit"
+	"github.com/drago44/golang-todo-api/internal/session"
+	"github.com/drago44/golang-todo-api/internal/tlsconfig"
+	"github.com/drago44/golang-todo-api/internal/tracing"
 	"github.com/joho/godotenv"
 )
 
-// Config holds application configuration loaded from environment variables.
+// Config holds application configuration. See Load for its sources.
 type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
+	Log      LogConfig
+	Tracing  tracing.Config
+	TLS      tlsconfig.Config
+	Security SecurityConfig
+	Session  session.Config
+	// CORS completes Server.AllowedOrigins and Server.AllowCredentials
+	CORS     CORSConfig
+	IPFilter IPFilterConfig
+	Health   HealthConfig
+	Cache    CacheConfig
+	// RateLimit applies when Server.EnableRateLimit is set
+	RateLimit RateLimitConfig
 }
 
 // ServerConfig describes HTTP server settings and related middleware configuration.
 type ServerConfig struct {
 	Port             string
 	Host             string
+	GRPCPort         string
+	EnableGRPC       bool
 	PublicScheme     string
 	EnableSwagger    bool
+	EnableMetrics    bool
+	EnableGraphiQL   bool
 	EnableLogger     bool
 	EnableRateLimit  bool
 	AllowedOrigins   []string
 	AllowCredentials bool
 	GinMode          string
 	TrustedProxies   []string
+	// Listen replaces TCP on Host:Port with a unix:// socket or a socket
+	// passed by systemd; see the listener package
+	Listen string
+	// SocketMode is the permission of a unix:// socket file
+	SocketMode os.FileMode
+	// SocketTrustForwarded takes the client IP from the proxy's headers on a
+	// socket listener, whose connections carry no client address
+	SocketTrustForwarded bool
+	// HTTPRedirectPort, when set with TLS, serves redirects to HTTPS
+	HTTPRedirectPort string
+	// HSTSMaxAge sends Strict-Transport-Security on HTTPS responses; 0 disables it
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	// EnableH2C accepts HTTP/2 without TLS, as proxies speak it to backends
+	EnableH2C bool
+	// RequestTimeout bounds request handling; 0 disables the timeout middleware
+	RequestTimeout time.Duration
+	// ShutdownDelay keeps serving after readiness starts failing so load
+	// balancers can stop routing to this instance
+	ShutdownDelay time.Duration
+	// ConfigWatchInterval polls the config and .env files for changes and
+	// reloads them; 0 leaves reloading to SIGHUP
+	ConfigWatchInterval time.Duration
+	// GraphQL query limits
+	GraphQLMaxDepth      int
+	GraphQLMaxComplexity int
 }
 
 // DatabaseConfig describes database connection settings.
 type DatabaseConfig struct {
 	URL string
+	// AutoMigrate applies pending migrations at startup; otherwise startup
+	// fails until `migrate up` has been run
+	AutoMigrate bool
+	// Pool overrides; 0 keeps the driver default
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// SlowQueryThreshold logs queries slower than this at warn level; 0 disables it
+	SlowQueryThreshold time.Duration
 }
 
-// Load reads configuration from environment variables and optional .env file.
-func Load() (*Config, error) {
-	// Load .env file (non-fatal if missing)
-	if err := godotenv.Load(); err != nil {
-		log.Printf(".env not loaded: %v", err)
+// CORSConfig describes the CORS policy beyond its origins and credentials,
+// and the route groups with a policy of their own.
+type CORSConfig struct {
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposedHeaders []string
+	// MaxAge is how long browsers may cache a preflight; 0 leaves it to them
+	MaxAge time.Duration
+	// Routes override the policy for paths under their prefix
+	Routes []cors.Route
+}
+
+// corsPolicy returns the default CORS policy.
+func (c *Config) corsPolicy() cors.Policy {
+	return cors.Policy{
+		AllowedOrigins:   c.Server.AllowedOrigins,
+		AllowCredentials: c.Server.AllowCredentials,
+		AllowedMethods:   c.CORS.AllowedMethods,
+		AllowedHeaders:   c.CORS.AllowedHeaders,
+		ExposedHeaders:   c.CORS.ExposedHeaders,
+		MaxAge:           c.CORS.MaxAge,
 	}
+}
+
+// IPFilterConfig describes client IP restrictions for route groups.
+type IPFilterConfig struct {
+	// Routes must all admit the client IP of a request under their prefix
+	Routes []ipfilter.Rule
+}
+
+// SecurityConfig describes response security headers and request body limits.
+// An empty header value leaves that header out.
+type SecurityConfig struct {
+	ContentSecurityPolicy string
+	// FrameOptions is DENY or SAMEORIGIN
+	FrameOptions       string
+	ReferrerPolicy     string
+	ContentTypeNosniff bool
+	// MaxBodyBytes rejects larger request bodies with 413; 0 disables the limit
+	MaxBodyBytes int
+	// StrictJSON rejects unknown fields in todo request bodies
+	StrictJSON bool
+}
+
+// HealthConfig describes liveness and readiness probe settings.
+type HealthConfig struct {
+	// CheckTimeout bounds each dependency check
+	CheckTimeout time.Duration
+	// MinFreeDiskMB fails readiness when the database directory has less free space
+	MinFreeDiskMB uint64
+}
+
+// CacheConfig describes the read-through cache for todo reads.
+type CacheConfig struct {
+	Enabled bool
+	// TTL bounds how long an entry lives, and so how stale another instance's
+	// writes can look
+	TTL time.Duration
+	// Size is the maximum number of cached entries
+	Size int
+}
 
-	return &Config{
-		Server: ServerConfig{
-			Port:             getEnv("PORT", "8080"),
-			Host:             getEnv("HOST", "localhost"),
-			PublicScheme:     getEnv("PUBLIC_SCHEME", "http"),
-			EnableSwagger:    getEnvBool("ENABLE_SWAGGER", false),
-			EnableLogger:     getEnvBool("ENABLE_LOGGER", true),
-			EnableRateLimit:  getEnvBool("ENABLE_RATE_LIMIT", false),
-			AllowedOrigins:   splitAndTrim(getEnv("ALLOWED_ORIGINS", "")),
-			AllowCredentials: getEnvBool("ALLOW_CREDENTIALS", true),
-			GinMode:          getEnv("GIN_MODE", "release"),
-			TrustedProxies:   splitAndTrim(getEnv("TRUSTED_PROXIES", "")),
-		},
-		Database: DatabaseConfig{
-			URL: getEnv("DATABASE_URL", "data/app.db"),
-		},
-	}, nil
+// RateLimitConfig describes the token buckets of the rate limiter. Each client
+// has one bucket per route override, one for reads and one for writes.
+type RateLimitConfig struct {
+	// Read applies to GET, HEAD and OPTIONS requests
+	Read ratelimit.Limit
+	// Write applies to every other method
+	Write ratelimit.Limit
+	// Routes overrides Read or Write for "METHOD /route/template" keys
+	Routes map[string]ratelimit.Limit
+	// KeyBy lists the client identities to try in order: api_key, ip
+	KeyBy []string
+	// APIKeys are the keys X-API-Key is checked against for api_key
+	APIKeys []string
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// limitFor returns the bucket name and limit for a request.
+func (c RateLimitConfig) limitFor(method, route string) (string, ratelimit.Limit) {
+	if route != "" {
+		if limit, ok := c.Routes[method+" "+route]; ok {
+			return method + " " + route, limit
+		}
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return "read", c.Read
+	default:
+		return "write", c.Write
 	}
+}
 
-	return defaultValue
+// LogConfig describes structured logging settings.
+type LogConfig struct {
+	Level slog.Level
 }
 
-func getEnvBool(key string, defaultValue bool) bool {
-	v := os.Getenv(key)
-	if v == "" {
-		return defaultValue
+// Load reads configuration from command-line flags, environment variables,
+// an optional .env file and an optional YAML config file. It returns the
+// positional arguments that follow the flags.
+func Load(args []string, stderr io.Writer) (*Config, []string, error) {
+	l, err := load(args, stderr)
+	if err != nil {
+		return nil, nil, err
 	}
+	return l.cfg, l.args, nil
+}
 
-	switch v {
-	case "1", "true", "TRUE", "True", "yes", "YES", "on", "ON":
-		return true
-	case "0", "false", "FALSE", "False", "no", "NO", "off", "OFF":
-		return false
-	default:
-		return defaultValue
+// dotEnvFile supplies variables missing from the process environment.
+const dotEnvFile = ".env"
+
+func load(args []string, stderr io.Writer) (*loaded, error) {
+	// The .env file is optional, and re-read on every load so a reload sees
+	// its changes; variables set in the process environment win
+	dotenv, err := godotenv.Read(dotEnvFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf(".env not loaded: %v", err)
 	}
+
+	return loadSettings(args, stderr, func(key string) (string, bool) {
+		if v, ok := os.LookupEnv(key); ok {
+			return v, true
+		}
+		v, ok := dotenv[key]
+		return v, ok
+	})
 }
 
 func splitAndTrim(s string) []string {
@@ -0,0 +1,107 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const configUsage = `usage: server config print [flags]
+
+Prints the effective configuration as a YAML config file, with secrets
+redacted and each value not taken from the defaults annotated with its source.
+`
+
+// RunConfig runs a `config` subcommand and returns the process exit code.
+func RunConfig(args []string) int {
+	return runConfig(args, os.Stdout, os.Stderr)
+}
+
+func runConfig(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprint(stderr, configUsage)
+		return 2
+	}
+
+	l, err := load(args[1:], stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(stderr, configUsage)
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if len(l.args) > 0 {
+		fmt.Fprintf(stderr, "unexpected arguments %q\n", l.args)
+		fmt.Fprint(stderr, configUsage)
+		return 2
+	}
+
+	enc := yaml.NewEncoder(stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(configDocument(l.settings)); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := enc.Close(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// configDocument nests the resolved settings at the dots of their keys, in
+// registry order, so the output reads back as a config file.
+func configDocument(resolved []resolvedSetting) *yaml.Node {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := map[string]*yaml.Node{"": root}
+
+	for _, r := range resolved {
+		parent := root
+		path := strings.Split(r.key, ".")
+		for i := range path[:len(path)-1] {
+			prefix := strings.Join(path[:i+1], ".")
+			section, ok := sections[prefix]
+			if !ok {
+				section = &yaml.Node{Kind: yaml.MappingNode}
+				sections[prefix] = section
+				parent.Content = append(parent.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: path[i]}, section)
+			}
+			parent = section
+		}
+
+		value := r.value
+		if r.redact != nil {
+			value = r.redact(value)
+		}
+		node := valueNode(r.setting, value)
+		if r.source != sourceDefault {
+			node.LineComment = "from " + r.origin()
+		}
+		key := &yaml.Node{Kind: yaml.ScalarNode, Value: path[len(path)-1]}
+		parent.Content = append(parent.Content, key, node)
+	}
+	return root
+}
+
+func valueNode(s *setting, value string) *yaml.Node {
+	if s.list {
+		seq := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, item := range splitAndTrim(value) {
+			seq.Content = append(seq.Content, valueNode(&setting{}, item))
+		}
+		return seq
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	// Quote values YAML would otherwise read as null or split up
+	if value == "" || strings.ContainsAny(value, ":#,[]{}") {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+	return node
+}
@@ -0,0 +1,30 @@
+package app
+
+import (
+	"net"
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// redirectToHTTPS returns a handler that permanently redirects every request
+// to the same host and path on httpsPort. 308 keeps the method and body.
+func redirectToHTTPS(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// withH2C lets h serve HTTP/2 without TLS, both via prior knowledge and
+// via the HTTP/1.1 Upgrade header.
+func withH2C(h http.Handler) http.Handler {
+	return h2c.NewHandler(h, &http2.Server{})
+}
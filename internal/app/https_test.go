@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	for _, tc := range []struct {
+		port, host, target, want string
+	}{
+		{"443", "api.example.com", "/api/v1/todos?page=2", "https://api.example.com/api/v1/todos?page=2"},
+		{"443", "api.example.com:80", "/", "https://api.example.com/"},
+		{"8443", "localhost:8080", "/livez", "https://localhost:8443/livez"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.target, nil)
+		req.Host = tc.host
+		w := httptest.NewRecorder()
+		redirectToHTTPS(tc.port).ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+		assert.Equal(t, tc.want, w.Header().Get("Location"))
+	}
+}
+
+func TestWithH2C(t *testing.T) {
+	srv := httptest.NewServer(withH2C(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proto", r.Proto)
+	})))
+	defer srv.Close()
+
+	// Prior knowledge: speak HTTP/2 over plain TCP, as a proxy would
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "HTTP/2.0", resp.Header.Get("X-Proto"))
+
+	// HTTP/1.1 clients are still served
+	resp, err = http.Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "HTTP/1.1", resp.Header.Get("X-Proto"))
+}
@@ -1,130 +1,352 @@
 package app
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
-	"sync"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/drago44/golang-todo-api/internal/cors"
+	"github.com/drago44/golang-todo-api/internal/ipfilter"
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/problem"
+	"github.com/drago44/golang-todo-api/internal/ratelimit"
 	"github.com/gin-gonic/gin"
 )
 
-// CORSWithConfig returns a CORS middleware configured from application settings.
-func CORSWithConfig(cfg *Config) gin.HandlerFunc {
-	allowed := make(map[string]struct{}, len(cfg.Server.AllowedOrigins))
-	for _, o := range cfg.Server.AllowedOrigins {
-		allowed[o] = struct{}{}
-	}
-	allowCredentials := cfg.Server.AllowCredentials
-	return gin.HandlerFunc(func(c *gin.Context) {
-		origin := c.GetHeader("Origin")
-		if origin != "" {
-			if _, ok := allowed[origin]; ok {
-				c.Header("Vary", "Origin")
-				c.Header("Access-Control-Allow-Origin", origin)
-			}
-		} else {
-			// No Origin header — do not set wildcard when credentials allowed
-			if !allowCredentials {
-				c.Header("Access-Control-Allow-Origin", "*")
+// CORSWithConfig returns a CORS middleware configured from application
+// settings. The policy is compiled once per configuration, so a reload
+// applies from the next request on. Preflight requests are answered here.
+func CORSWithConfig(live *LiveConfig) gin.HandlerFunc {
+	type compiled struct {
+		cfg      *Config
+		policies *cors.CORS
+	}
+	var current atomic.Pointer[compiled]
+
+	return func(c *gin.Context) {
+		cfg := live.Load()
+		cur := current.Load()
+		if cur == nil || cur.cfg != cfg {
+			policies, err := cors.New(cfg.corsPolicy(), cfg.CORS.Routes)
+			if err != nil {
+				// Unreachable for validated configurations
+				problem.Internal(c, err)
+				return
 			}
+			cur = &compiled{cfg: cfg, policies: policies}
+			current.Store(cur)
 		}
-		c.Header("Access-Control-Allow-Credentials", fmt.Sprintf("%t", allowCredentials))
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
-		c.Header("Access-Control-Max-Age", "600")
-		c.Header("Access-Control-Expose-Headers", "Content-Length, Content-Type")
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		if cur.policies.Handle(c.Writer.Header(), c.Request) {
+			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
+		c.Next()
+	}
+}
 
+// HSTS returns a middleware that sends Strict-Transport-Security on HTTPS
+// responses: those served over TLS, or every response when publicScheme is
+// https because a proxy in front terminates TLS.
+func HSTS(maxAge time.Duration, includeSubdomains bool, publicScheme string) gin.HandlerFunc {
+	value := "max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	if includeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return func(c *gin.Context) {
+		if c.Request.TLS != nil || publicScheme == "https" {
+			c.Header("Strict-Transport-Security", value)
+		}
 		c.Next()
-	})
+	}
 }
 
-// Logger returns a middleware that logs HTTP requests in a custom format.
-func Logger() gin.HandlerFunc {
-	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
-		// Custom log format
-		return fmt.Sprintf("%s - [%s] \"%s %s %s %d %s \"%s\" %s\n",
-			param.ClientIP,
-			param.TimeStamp.Format(time.RFC1123),
-			param.Method,
-			param.Path,
-			param.Request.Proto,
-			param.StatusCode,
-			param.Latency,
-			param.Request.UserAgent(),
-			param.ErrorMessage,
-		)
-	})
+// SecurityHeaders returns a middleware that sets the response security
+// headers configured in cfg, leaving out those with an empty value. Pages that
+// need a looser Content-Security-Policy, such as Swagger UI, override it.
+func SecurityHeaders(cfg SecurityConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		if cfg.ContentSecurityPolicy != "" {
+			h.Set("Content-Security-Policy", cfg.ContentSecurityPolicy)
+		}
+		if cfg.ContentTypeNosniff {
+			h.Set("X-Content-Type-Options", "nosniff")
+		}
+		if cfg.FrameOptions != "" {
+			h.Set("X-Frame-Options", cfg.FrameOptions)
+		}
+		if cfg.ReferrerPolicy != "" {
+			h.Set("Referrer-Policy", cfg.ReferrerPolicy)
+		}
+		c.Next()
+	}
+}
+
+// MaxBodySize returns a middleware that rejects request bodies larger than
+// limit bytes with 413. A declared Content-Length over the limit is rejected
+// up front; otherwise reading past the limit fails and the handler's bind
+// error renders the 413.
+func MaxBodySize(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			problem.PayloadTooLarge(c, limit)
+			return
+		}
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		c.Next()
+	}
 }
 
-// Recovery returns a middleware that recovers from panics and returns 500.
+// ForwardedSocketClient returns a middleware for socket listeners, whose
+// connections carry no client address. It sets the request's RemoteAddr to
+// the client the proxy in front reports: the last X-Forwarded-For entry,
+// which the proxy appended, or else X-Real-IP. c.ClientIP then works as it
+// does over TCP, including the trusted proxies walk through the rest of
+// X-Forwarded-For. Only install it when a proxy sets these headers, as any
+// client that reaches the socket directly can.
+func ForwardedSocketClient() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ip := forwardedClientIP(c.Request.Header); ip.IsValid() {
+			c.Request.RemoteAddr = netip.AddrPortFrom(ip, 0).String()
+		}
+		c.Next()
+	}
+}
+
+func forwardedClientIP(h http.Header) netip.Addr {
+	if values := h.Values("X-Forwarded-For"); len(values) > 0 {
+		entries := strings.Split(values[len(values)-1], ",")
+		ip, _ := netip.ParseAddr(strings.TrimSpace(entries[len(entries)-1]))
+		return ip.Unmap()
+	}
+	ip, _ := netip.ParseAddr(strings.TrimSpace(h.Get("X-Real-IP")))
+	return ip.Unmap()
+}
+
+// IPFilter returns a middleware that refuses requests from client IPs the
+// ip_filter rules covering their path do not admit, answering 403 and
+// logging each refusal for audit. The client IP honours the trusted proxies,
+// and the rules are read per request, so reloads apply immediately.
+func IPFilter(live *LiveConfig, logger *slog.Logger) gin.HandlerFunc {
+	logger = logger.With("component", "audit")
+	return func(c *gin.Context) {
+		rules := live.Load().IPFilter.Routes
+		if len(rules) == 0 {
+			c.Next()
+			return
+		}
+
+		clientIP := c.ClientIP()
+		decision := ipfilter.Check(rules, c.Request.URL.Path, clientIP)
+		if !decision.Allowed {
+			logger.LogAttrs(c.Request.Context(), slog.LevelWarn, "access denied",
+				slog.String("client_ip", clientIP),
+				slog.String("remote_addr", c.Request.RemoteAddr),
+				slog.String("method", c.Request.Method),
+				slog.String("path", c.Request.URL.Path),
+				slog.String("rule", decision.Rule),
+				slog.String("reason", decision.Reason),
+			)
+			problem.Write(c, problem.New(http.StatusForbidden, ipfilter.CodeAccessDenied, "Access from this network is not allowed."))
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequestID returns a middleware that accepts a valid incoming X-Request-ID or
+// generates a new one, echoes it in the response and stores it in the request
+// context so every log record of the request carries it.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(logging.RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+
+		c.Header(logging.RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+
+		c.Next()
+	}
+}
+
+// Logger returns a middleware that writes one structured record per request.
+// Server errors are logged at error level and client errors at warn level.
+func Logger(logger *slog.Logger) gin.HandlerFunc {
+	logger = logger.With("component", "http")
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", c.Writer.Size()),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user_agent", c.Request.UserAgent()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		logger.LogAttrs(c.Request.Context(), level, "http request", attrs...)
+	}
+}
+
+// RequestTimeout returns a middleware that bounds each request's context to
+// timeout, so database queries are interrupted once it expires. Handlers
+// surface the resulting errors through problem.Error; a handler that returns
+// without writing anything after the deadline gets a 504 problem here.
+// Routes in exempt, as registered (/api/v1/todos/export), are not bounded.
+func RequestTimeout(timeout time.Duration, exempt ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if slices.Contains(exempt, c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			problem.Timeout(c)
+		}
+	}
+}
+
+// Recovery returns a middleware that recovers from panics and returns a 500 problem.
 func Recovery() gin.HandlerFunc {
 	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
-		log.Printf("Panic recovered: %v", recovered)
-		c.JSON(500, gin.H{
-			"error": "Internal server error",
-		})
+		problem.Internal(c, fmt.Errorf("panic recovered: %v", recovered))
 	})
 }
 
-// RateLimit returns an in-memory rate limiter middleware with periodic cleanup.
-func RateLimit() gin.HandlerFunc {
-	const (
-		maxRequests = 100
-		window      = time.Minute
-		evictAfter  = 10 * time.Minute
-	)
-	type clientWindow struct {
-		count      int
-		windowEnds time.Time
-		lastSeen   time.Time
-	}
-	var (
-		mu      sync.Mutex
-		clients = make(map[string]*clientWindow)
-	)
-	// Cleanup goroutine
-	go func() {
-		Ticker := time.NewTicker(5 * time.Minute)
-		defer Ticker.Stop()
-		for range Ticker.C {
-			mu.Lock()
-			cut := time.Now().Add(-evictAfter)
-			for ip, cw := range clients {
-				if cw.lastSeen.Before(cut) {
-					delete(clients, ip)
-				}
+// Client identities RateLimitConfig.KeyBy can name.
+const (
+	RateLimitKeyAPIKey = "api_key"
+	RateLimitKeyIP     = "ip"
+)
+
+// APIKeyHeader carries the client's API key.
+const APIKeyHeader = "X-API-Key"
+
+// RateLimitAPIKeyKey is the gin context key under which APIKeys stores a
+// verified API key for RateLimitKeyAPIKey. The rate limiter never reads the
+// header itself: a client could send a fresh key with every request to get a
+// fresh bucket.
+const RateLimitAPIKeyKey = "api_key"
+
+// APIKeys returns a middleware that checks the X-API-Key header against
+// RateLimit.APIKeys and, on a match, stores the key under
+// RateLimitAPIKeyKey. Unknown keys are ignored, leaving the request keyed by
+// its IP. The keys are read per request, so reloads apply immediately.
+func APIKeys(live *LiveConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := c.GetHeader(APIKeyHeader); key != "" && knownAPIKey(live.Load().RateLimit.APIKeys, key) {
+			c.Set(RateLimitAPIKeyKey, key)
+		}
+		c.Next()
+	}
+}
+
+// knownAPIKey reports whether key is one of keys, comparing hashes in
+// constant time so the comparison leaks nothing about the keys.
+func knownAPIKey(keys []string, key string) bool {
+	sum := sha256.Sum256([]byte(key))
+	found := 0
+	for _, k := range keys {
+		want := sha256.Sum256([]byte(k))
+		found |= subtle.ConstantTimeCompare(sum[:], want[:])
+	}
+	return found == 1
+}
+
+// RateLimit returns a middleware that charges every request to a token bucket
+// per client and route, and rejects it with a 429 problem once the bucket is
+// empty. Responses carry RateLimit-* headers, and rejections Retry-After.
+// onReject, when not nil, is called for every rejected request. Limits and
+// Server.EnableRateLimit are read per request, so reloads apply immediately.
+func RateLimit(live *LiveConfig, store ratelimit.Store, onReject func()) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := live.Load()
+		if !cfg.Server.EnableRateLimit {
+			c.Next()
+			return
+		}
+		bucket, limit := cfg.RateLimit.limitFor(c.Request.Method, c.FullPath())
+		key := rateLimitClient(c, cfg.RateLimit.KeyBy) + "|" + bucket
+
+		res, err := store.Take(c.Request.Context(), key, limit)
+		if err != nil {
+			// Fail open: an unreachable store must not take the API down
+			_ = c.Error(fmt.Errorf("rate limit store: %w", err))
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(limit.Capacity()))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ratelimit.Seconds(res.ResetAfter)))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", limit.Requests, ratelimit.Seconds(limit.Period), limit.Capacity()))
+
+		if !res.Allowed {
+			if onReject != nil {
+				onReject()
 			}
-			mu.Unlock()
-		}
-	}()
-	return gin.HandlerFunc(func(c *gin.Context) {
-		ip := c.ClientIP()
-		now := time.Now()
-
-		mu.Lock()
-		cw, ok := clients[ip]
-		if !ok || now.After(cw.windowEnds) {
-			cw = &clientWindow{count: 0, windowEnds: now.Add(window), lastSeen: now}
-			clients[ip] = cw
-		}
-		if cw.count >= maxRequests {
-			mu.Unlock()
-			c.AbortWithStatusJSON(429, gin.H{
-				"error":       "Too Many Requests",
-				"retry_after": int(time.Until(cw.windowEnds).Seconds()),
-			})
+			retryAfter := ratelimit.Seconds(res.RetryAfter)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			problem.Write(c, problem.New(http.StatusTooManyRequests, problem.CodeRateLimited,
+				fmt.Sprintf("Rate limit exceeded, retry after %d seconds.", retryAfter)))
 			return
 		}
-		cw.count++
-		cw.lastSeen = now
-		mu.Unlock()
 
 		c.Next()
-	})
+	}
+}
+
+// rateLimitClient returns the first verified identity in keyBy the request
+// carries, falling back to the client IP. API keys are hashed so the store
+// never holds them.
+func rateLimitClient(c *gin.Context, keyBy []string) string {
+	for _, source := range keyBy {
+		switch source {
+		case RateLimitKeyAPIKey:
+			if key := c.GetString(RateLimitAPIKeyKey); key != "" {
+				sum := sha256.Sum256([]byte(key))
+				return "key:" + hex.EncodeToString(sum[:16])
+			}
+		case RateLimitKeyIP:
+			return "ip:" + c.ClientIP()
+		}
+	}
+	return "ip:" + c.ClientIP()
 }
@@ -0,0 +1,291 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/ipfilter"
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/problem"
+	"github.com/drago44/golang-todo-api/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(RequestTimeout(50*time.Millisecond, "/export"))
+	r.GET("/slow", func(c *gin.Context) {
+		// A handler that honours cancellation but writes nothing itself
+		<-c.Request.Context().Done()
+	})
+	r.GET("/fast", func(c *gin.Context) {
+		_, hasDeadline := c.Request.Context().Deadline()
+		assert.True(t, hasDeadline)
+		c.Status(http.StatusNoContent)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	t.Logf("GET /slow: status=%d resp=%s", w.Code, w.Body.String())
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"request_timeout"`)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// Exempt routes stream without a deadline
+	r.GET("/export", func(c *gin.Context) {
+		_, hasDeadline := c.Request.Context().Deadline()
+		assert.False(t, hasDeadline)
+		c.Status(http.StatusOK)
+	})
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHSTS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serve := func(publicScheme string, overTLS bool) string {
+		r := gin.New()
+		r.Use(HSTS(180*24*time.Hour, true, publicScheme))
+		r.GET("/todos", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+		req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+		if overTLS {
+			req.TLS = &tls.ConnectionState{}
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Header().Get("Strict-Transport-Security")
+	}
+
+	assert.Equal(t, "max-age=15552000; includeSubDomains", serve("http", true))
+	assert.Equal(t, "max-age=15552000; includeSubDomains", serve("https", false), "TLS terminated by a proxy")
+	assert.Empty(t, serve("http", false), "plain HTTP must not send HSTS")
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(SecurityHeaders(SecurityConfig{
+		ContentSecurityPolicy: "default-src 'none'",
+		FrameOptions:          "DENY",
+		ContentTypeNosniff:    true,
+	}))
+	r.GET("/todos", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos", nil))
+	t.Logf("headers: %v", w.Header())
+	assert.Equal(t, "default-src 'none'", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.NotContains(t, w.Header(), "Referrer-Policy", "an empty value leaves the header out")
+}
+
+func TestMaxBodySize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(MaxBodySize(16))
+	r.POST("/todos", func(c *gin.Context) {
+		var body map[string]any
+		if err := c.ShouldBindJSON(&body); err != nil {
+			problem.BindError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	post := func(body string, chunked bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(body))
+		if chunked {
+			// No Content-Length, so only reading the body finds it too large
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusNoContent, post(`{"title":"a"}`, false).Code)
+	for _, chunked := range []bool{false, true} {
+		w := post(`{"title":"far too long for the limit"}`, chunked)
+		t.Logf("chunked=%t: %d %s", chunked, w.Code, w.Body.String())
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Contains(t, w.Body.String(), problem.CodePayloadTooLarge)
+	}
+}
+
+func TestIPFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	admin, err := ipfilter.ParseRule("/metrics: allow=10.8.0.0/16")
+	require.NoError(t, err)
+	live := NewLiveConfig(&Config{IPFilter: IPFilterConfig{Routes: []ipfilter.Rule{admin}}})
+	var logs bytes.Buffer
+
+	r := gin.New()
+	require.NoError(t, r.SetTrustedProxies([]string{"192.0.2.1"}))
+	r.Use(RequestID(), IPFilter(live, logging.New(&logs, slog.LevelInfo)))
+	r.GET("/metrics", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	r.GET("/todos", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	get := func(path, remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, get("/metrics", "10.8.0.5:5000", ""))
+	assert.Equal(t, http.StatusNoContent, get("/todos", "198.51.100.7:5000", ""), "other routes are unrestricted")
+	assert.Equal(t, http.StatusNoContent, get("/metrics", "192.0.2.1:5000", "10.8.0.5"), "a trusted proxy forwards the VPN address")
+	assert.Equal(t, http.StatusForbidden, get("/metrics", "198.51.100.7:5000", "10.8.0.5"), "an untrusted client cannot claim one")
+
+	t.Logf("audit log:\n%s", logs.String())
+	assert.Contains(t, logs.String(), `"msg":"access denied"`)
+	assert.Contains(t, logs.String(), `"component":"audit"`)
+	assert.Contains(t, logs.String(), `"client_ip":"198.51.100.7"`)
+	assert.Contains(t, logs.String(), `"reason":"not in allow list"`)
+	assert.Contains(t, logs.String(), `"request_id":`)
+
+	// Rules are read per request, so a reload applies immediately
+	live.store(&Config{})
+	assert.Equal(t, http.StatusNoContent, get("/metrics", "198.51.100.7:5000", ""))
+}
+
+func TestForwardedSocketClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	require.NoError(t, r.SetTrustedProxies([]string{"203.0.113.0/24"}))
+	r.Use(ForwardedSocketClient())
+	r.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+
+	clientIP := func(header http.Header) string {
+		req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+		// What net/http reports for a unix socket connection
+		req.RemoteAddr = "@"
+		req.Header = header
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		t.Logf("%v: %q", header, w.Body.String())
+		return w.Body.String()
+	}
+
+	assert.Equal(t, "198.51.100.7", clientIP(http.Header{"X-Forwarded-For": {"10.0.0.1, 198.51.100.7"}}), "the entry the proxy appended")
+	assert.Equal(t, "198.51.100.7", clientIP(http.Header{"X-Forwarded-For": {"10.0.0.1", "198.51.100.7"}}))
+	assert.Equal(t, "198.51.100.7", clientIP(http.Header{"X-Forwarded-For": {"198.51.100.7, 203.0.113.9"}}), "trusted proxies are skipped")
+	assert.Equal(t, "2001:db8::1", clientIP(http.Header{"X-Real-Ip": {"2001:db8::1"}}))
+	assert.Equal(t, "", clientIP(http.Header{"X-Forwarded-For": {"unknown"}}))
+	assert.Equal(t, "", clientIP(nil))
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := RateLimitConfig{
+		Read:    ratelimit.Limit{Requests: 3, Period: time.Minute},
+		Write:   ratelimit.Limit{Requests: 1, Period: time.Minute},
+		Routes:  map[string]ratelimit.Limit{"POST /sync": {Requests: 2, Period: time.Minute}},
+		KeyBy:   []string{RateLimitKeyAPIKey, RateLimitKeyIP},
+		APIKeys: []string{"k1", "k3"},
+	}
+	rejected := 0
+	r := gin.New()
+	live := NewLiveConfig(&Config{Server: ServerConfig{EnableRateLimit: true}, RateLimit: cfg})
+	r.Use(APIKeys(live), RateLimit(live, ratelimit.NewMemoryStore(), func() { rejected++ }))
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	r.GET("/todos", ok)
+	r.POST("/todos", ok)
+	r.POST("/sync", ok)
+
+	do := func(method, path, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if apiKey != "" {
+			req.Header.Set(APIKeyHeader, apiKey)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// Reads have their own bucket
+	for remaining := 2; remaining >= 0; remaining-- {
+		w := do(http.MethodGet, "/todos", "")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "3", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, strconv.Itoa(remaining), w.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "3;w=60;burst=3", w.Header().Get("RateLimit-Policy"))
+	}
+	w := do(http.MethodGet, "/todos", "")
+	t.Logf("GET over limit: status=%d headers=%v body=%s", w.Code, w.Header(), w.Body.String())
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "20", w.Header().Get("Retry-After"))
+	assert.Equal(t, "60", w.Header().Get("RateLimit-Reset"))
+	assert.Contains(t, w.Body.String(), `"code":"rate_limited"`)
+
+	// Writes are stricter, and a route override gets a bucket of its own
+	assert.Equal(t, http.StatusNoContent, do(http.MethodPost, "/todos", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "/todos", "").Code)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodPost, "/sync", "").Code)
+	assert.Equal(t, http.StatusNoContent, do(http.MethodPost, "/sync", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodPost, "/sync", "").Code)
+
+	// Each verified API key has a bucket of its own, apart from its IP; an
+	// unknown one is charged to the IP
+	for remaining := 2; remaining >= 0; remaining-- {
+		w := do(http.MethodGet, "/todos", "k1")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, strconv.Itoa(remaining), w.Header().Get("RateLimit-Remaining"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodGet, "/todos", "k1").Code)
+	assert.Equal(t, "2", do(http.MethodGet, "/todos", "k3").Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, http.StatusTooManyRequests, do(http.MethodGet, "/todos", "k2").Code)
+	assert.Equal(t, 5, rejected)
+}
+
+// failingLimitStore fails every call, like an unreachable shared store.
+type failingLimitStore struct{}
+
+func (failingLimitStore) Take(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store down")
+}
+
+func TestRateLimit_FailsOpen(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := RateLimitConfig{Read: ratelimit.Limit{Requests: 1, Period: time.Minute}}
+	r := gin.New()
+	r.Use(RateLimit(NewLiveConfig(&Config{Server: ServerConfig{EnableRateLimit: true}, RateLimit: cfg}), failingLimitStore{}, nil))
+	r.GET("/todos", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/todos", nil))
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	}
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/migrate"
+	"gorm.io/gorm"
+)
+
+const migrateUsage = `usage: server migrate [flags] <command>
+
+commands:
+  up        apply all pending migrations
+  down      roll back the most recent migration
+  status    list migrations and whether they are applied
+  to N      migrate up or down to version N (0 rolls back everything)
+`
+
+// NewMigrator returns a migrator for the application database.
+func NewMigrator(db *gorm.DB, logger *slog.Logger) (*migrate.Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(sqlDB, db.Dialector.Name(), logger)
+}
+
+// Migrate prepares the schema at startup. With autoMigrate it applies pending
+// migrations; otherwise it only verifies that none are pending. Either way a
+// schema newer than the binary is an error.
+func Migrate(ctx context.Context, migrator *migrate.Migrator, autoMigrate bool) error {
+	if autoMigrate {
+		return migrator.Up(ctx)
+	}
+	if err := migrator.Check(ctx); err != nil {
+		return fmt.Errorf("%w (run `server migrate up` or set DB_AUTO_MIGRATE=true)", err)
+	}
+	return nil
+}
+
+// RunMigrate runs a `migrate` subcommand and returns the process exit code.
+func RunMigrate(args []string) int {
+	return runMigrate(context.Background(), args, os.Stdout, os.Stderr)
+}
+
+func runMigrate(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	cfg, args, err := Load(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		fmt.Fprint(stderr, migrateUsage)
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	// Progress goes to stderr so `migrate status` output stays parseable
+	logger := logging.New(stderr, cfg.Log.Level)
+
+	db, err := Init(&cfg.Database, logger)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if db == nil {
+		fmt.Fprintln(stderr, "migrate: the memory:// database has no schema")
+		return 1
+	}
+	migrator, err := NewMigrator(db, logger)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	if err := migrateCommand(ctx, migrator, args, stdout); err != nil {
+		fmt.Fprintln(stderr, err)
+		if errors.Is(err, errUsage) {
+			fmt.Fprint(stderr, migrateUsage)
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+var errUsage = errors.New("invalid migrate command")
+
+func migrateCommand(ctx context.Context, migrator *migrate.Migrator, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch cmd, rest := args[0], args[1:]; {
+	case cmd == "up" && len(rest) == 0:
+		if err := migrator.Up(ctx); err != nil {
+			return err
+		}
+	case cmd == "down" && len(rest) == 0:
+		if err := migrator.Down(ctx); err != nil {
+			return err
+		}
+	case cmd == "to" && len(rest) == 1:
+		version, err := strconv.Atoi(rest[0])
+		if err != nil {
+			return fmt.Errorf("%w: version %q is not a number", errUsage, rest[0])
+		}
+		if err := migrator.To(ctx, version); err != nil {
+			return err
+		}
+	case cmd == "status" && len(rest) == 0:
+		return printStatus(ctx, migrator, stdout)
+	default:
+		return fmt.Errorf("%w: %q", errUsage, args)
+	}
+
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "schema is at version %d of %d\n", version, migrator.Latest())
+	return nil
+}
+
+func printStatus(ctx context.Context, migrator *migrate.Migrator, stdout io.Writer) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		state, appliedAt := "pending", "-"
+		if s.Applied {
+			state, appliedAt = "applied", s.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		if s.Unknown {
+			state = "unknown (newer binary)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/migrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFileMigrator(t *testing.T) *migrate.Migrator {
+	t.Helper()
+
+	db, err := Init(&DatabaseConfig{URL: filepath.Join(t.TempDir(), "app.db")}, logging.Discard())
+	require.NoError(t, err)
+	migrator, err := NewMigrator(db, logging.Discard())
+	require.NoError(t, err)
+	return migrator
+}
+
+func TestMigrate_WithoutAutoMigrateRequiresCurrentSchema(t *testing.T) {
+	ctx := context.Background()
+	migrator := newFileMigrator(t)
+
+	err := Migrate(ctx, migrator, false)
+	t.Logf("startup against empty database: %v", err)
+	assert.ErrorIs(t, err, migrate.ErrPending)
+
+	require.NoError(t, Migrate(ctx, migrator, true))
+	assert.NoError(t, Migrate(ctx, migrator, false))
+}
+
+func TestMigrateCommand(t *testing.T) {
+	ctx := context.Background()
+	migrator := newFileMigrator(t)
+
+	var out bytes.Buffer
+	require.NoError(t, migrateCommand(ctx, migrator, []string{"to", "1"}, &out))
+	assert.Equal(t, "schema is at version 1 of 3\n", out.String())
+
+	out.Reset()
+	require.NoError(t, migrateCommand(ctx, migrator, []string{"status"}, &out))
+	t.Logf("migrate status:\n%s", out.String())
+	assert.Contains(t, out.String(), "create_todos")
+	assert.Regexp(t, `2\s+add_sync_columns\s+pending`, out.String())
+
+	out.Reset()
+	require.NoError(t, migrateCommand(ctx, migrator, []string{"up"}, &out))
+	assert.Equal(t, "schema is at version 3 of 3\n", out.String())
+
+	for _, args := range [][]string{nil, {"sideways"}, {"to"}, {"to", "two"}, {"up", "now"}} {
+		assert.ErrorIs(t, migrateCommand(ctx, migrator, args, &out), errUsage, "args %q", args)
+	}
+}
@@ -0,0 +1,214 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// LiveConfig holds the configuration read per request by middleware that
+// follows reloads. A reload swaps it atomically, so a request sees either the
+// old or the new settings, never a mix.
+type LiveConfig struct {
+	cfg   atomic.Pointer[Config]
+	level slog.LevelVar
+}
+
+// NewLiveConfig returns a LiveConfig starting at cfg.
+func NewLiveConfig(cfg *Config) *LiveConfig {
+	l := &LiveConfig{}
+	l.store(cfg)
+	return l
+}
+
+// Load returns the current configuration. Callers must not modify it.
+func (l *LiveConfig) Load() *Config {
+	return l.cfg.Load()
+}
+
+// Level is the current log level, for logging.New.
+func (l *LiveConfig) Level() slog.Leveler {
+	return &l.level
+}
+
+func (l *LiveConfig) store(cfg *Config) {
+	l.cfg.Store(cfg)
+	l.level.Set(cfg.Log.Level)
+}
+
+// reloadable lists the settings a reload applies. Changes to any other
+// setting are logged and wait for a restart.
+var reloadable = map[string]bool{
+	"server.allowed_origins":   true,
+	"server.allow_credentials": true,
+	"cors.allowed_methods":     true,
+	"cors.allowed_headers":     true,
+	"cors.exposed_headers":     true,
+	"cors.max_age":             true,
+	"cors.routes":              true,
+	"ip_filter.routes":         true,
+	"server.enable_rate_limit": true,
+	"rate_limit.read":          true,
+	"rate_limit.write":         true,
+	"rate_limit.routes":        true,
+	"rate_limit.key_by":        true,
+	"rate_limit.api_keys":      true,
+	"log.level":                true,
+}
+
+// reloader re-reads the configuration and applies its reloadable settings
+// to a LiveConfig. An invalid configuration is rejected as a whole and the
+// running one kept.
+type reloader struct {
+	load   func() (*loaded, error)
+	live   *LiveConfig
+	logger *slog.Logger
+	// activatedUnix is set when systemd passed a Unix socket, whose lack of
+	// client IPs validate cannot see from the listen spec
+	activatedUnix bool
+
+	// current is the running value of every setting
+	current []resolvedSetting
+	// files are watched for changes, with their last seen modification time
+	files map[string]time.Time
+}
+
+// newReloader returns a reloader that loads the configuration from args, as
+// the running one l was. activatedUnix reports whether the server listens on
+// a Unix socket passed by systemd.
+func newReloader(args []string, l *loaded, live *LiveConfig, activatedUnix bool, logger *slog.Logger) *reloader {
+	r := &reloader{
+		load: func() (*loaded, error) {
+			// The flags parsed once already, so their errors cannot recur
+			return load(args, io.Discard)
+		},
+		live:          live,
+		logger:        logger.With("component", "config"),
+		activatedUnix: activatedUnix,
+		current:       l.settings,
+	}
+	r.files = watchedFiles(l)
+	return r
+}
+
+// reload loads the configuration and applies the reloadable settings that
+// changed. reason is logged.
+func (r *reloader) reload(reason string) error {
+	// Seen before loading, so a rejected edit is reported once rather than on
+	// every poll, and an edit made while loading is still noticed
+	seen := make(map[string]time.Time, len(r.files))
+	for path := range r.files {
+		seen[path] = modTime(path)
+	}
+	r.files = seen
+
+	l, err := r.load()
+	if err != nil {
+		r.logger.Error("configuration reload rejected", "reason", reason, "error", err.Error())
+		return err
+	}
+	// CONFIG_FILE may have changed in .env; keep the times seen before
+	// loading for the files still watched
+	files := watchedFiles(l)
+	for path := range files {
+		if t, ok := seen[path]; ok {
+			files[path] = t
+		}
+	}
+	r.files = files
+
+	next := *r.live.Load()
+	current := append([]resolvedSetting(nil), r.current...)
+	var applied, ignored []string
+	for i, s := range l.settings {
+		if s.value == current[i].value {
+			continue
+		}
+		if !reloadable[s.key] {
+			ignored = append(ignored, s.key)
+			continue
+		}
+		// loadSettings already accepted the value
+		if err := s.apply(&next, strings.TrimSpace(s.value)); err != nil {
+			return err
+		}
+		current[i] = s
+		applied = append(applied, s.key)
+	}
+	errs := validate(&next)
+	if r.activatedUnix {
+		errs = append(errs, socketClientIPErrors(&next)...)
+	}
+	if len(errs) > 0 {
+		err := fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+		r.logger.Error("configuration reload rejected", "reason", reason, "error", err.Error())
+		return err
+	}
+
+	r.live.store(&next)
+	r.current = current
+	if len(ignored) > 0 {
+		r.logger.Warn("configuration changes need a restart", "settings", ignored)
+	}
+	r.logger.Info("configuration reloaded", "reason", reason, "changed", applied)
+	return nil
+}
+
+// watch reloads on every value received from hup and, when interval is
+// positive, whenever a watched file changes. It returns when ctx is done.
+func (r *reloader) watch(ctx context.Context, hup <-chan os.Signal, interval time.Duration) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-hup:
+			_ = r.reload(sig.String())
+		case <-tick:
+			if path, changed := r.changedFile(); changed {
+				_ = r.reload(path + " changed")
+			}
+		}
+	}
+}
+
+// changedFile reports the first watched file whose modification time is not
+// the one seen at the last load.
+func (r *reloader) changedFile() (string, bool) {
+	for path, seen := range r.files {
+		if modTime(path) != seen {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+func watchedFiles(l *loaded) map[string]time.Time {
+	files := map[string]time.Time{dotEnvFile: modTime(dotEnvFile)}
+	if l.configFile != "" {
+		files[l.configFile] = modTime(l.configFile)
+	}
+	return files
+}
+
+// modTime returns the file's modification time, or the zero time when it
+// cannot be read, so creating or deleting a file also counts as a change.
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,179 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestReloader loads the config file at path the way Run would and
+// returns a reloader for it.
+func newTestReloader(t *testing.T, path string) *reloader {
+	t.Helper()
+	clearConfigEnv(t)
+	args := []string{"--config", path}
+	l, err := loadSettings(args, io.Discard, os.LookupEnv)
+	require.NoError(t, err)
+
+	r := newReloader(args, l, NewLiveConfig(l.cfg), false, logging.Discard())
+	r.load = func() (*loaded, error) { return loadSettings(args, io.Discard, os.LookupEnv) }
+	return r
+}
+
+func TestReloader_AppliesReloadableSettings(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  port: 8080
+  allowed_origins: [https://a.example.com]
+log:
+  level: info
+`)
+	r := newTestReloader(t, path)
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+server:
+  port: 9000
+  allowed_origins: [https://b.example.com]
+  enable_rate_limit: true
+log:
+  level: debug
+rate_limit:
+  read: 5/1s
+`), 0o600))
+	require.NoError(t, r.reload("test"))
+
+	cfg := r.live.Load()
+	assert.Equal(t, []string{"https://b.example.com"}, cfg.Server.AllowedOrigins)
+	assert.True(t, cfg.Server.EnableRateLimit)
+	assert.Equal(t, ratelimit.Limit{Requests: 5, Period: time.Second}, cfg.RateLimit.Read)
+	assert.Equal(t, slog.LevelDebug, r.live.Level().Level())
+	assert.Equal(t, "8080", cfg.Server.Port, "the port needs a restart")
+}
+
+func TestReloader_ActivatedUnixSocketNeedsClientIP(t *testing.T) {
+	path := writeConfigFile(t, "server:\n  listen: systemd\n")
+	r := newTestReloader(t, path)
+	r.activatedUnix = true
+
+	require.NoError(t, os.WriteFile(path, []byte("server:\n  listen: systemd\n  enable_rate_limit: true\n"), 0o600))
+	err := r.reload("test")
+	t.Logf("reload: %v", err)
+	assert.ErrorContains(t, err, "server.enable_rate_limit: a Unix socket has no client IP")
+	assert.False(t, r.live.Load().Server.EnableRateLimit)
+
+	// Over a TCP socket from systemd the same change applies
+	r.activatedUnix = false
+	require.NoError(t, r.reload("test"))
+	assert.True(t, r.live.Load().Server.EnableRateLimit)
+}
+
+func TestReloader_RejectsInvalidConfig(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  allowed_origins: [https://a.example.com]
+`)
+	r := newTestReloader(t, path)
+	before := r.live.Load()
+
+	for name, content := range map[string]string{
+		"bad value":      "server:\n  allowed_origins: [a.example.com]\n",
+		"cross-field":    "server:\n  allowed_origins: [\"*\"]\n",
+		"unknown key":    "server:\n  allowed_origin: [https://b.example.com]\n",
+		"malformed YAML": "server: [\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+			err := r.reload("test")
+			t.Logf("%v", err)
+			assert.Error(t, err)
+			assert.Same(t, before, r.live.Load(), "the running config is kept")
+		})
+	}
+}
+
+func TestReloader_ReportsRejectedEditOnce(t *testing.T) {
+	path := writeConfigFile(t, "log:\n  level: info\n")
+	r := newTestReloader(t, path)
+
+	require.NoError(t, os.WriteFile(path, []byte("log:\n  level: loud\n"), 0o600))
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(path, future, future))
+	changed, ok := r.changedFile()
+	require.True(t, ok)
+	assert.Equal(t, path, changed)
+
+	require.Error(t, r.reload(changed+" changed"))
+	_, ok = r.changedFile()
+	assert.False(t, ok, "the rejected edit is not picked up again")
+
+	// The next edit is
+	require.NoError(t, os.WriteFile(path, []byte("log:\n  level: warn\n"), 0o600))
+	later := future.Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	changed, ok = r.changedFile()
+	require.True(t, ok)
+	require.NoError(t, r.reload(changed+" changed"))
+	assert.Equal(t, slog.LevelWarn, r.live.Level().Level())
+}
+
+func TestReloader_WatchesSignalAndFile(t *testing.T) {
+	path := writeConfigFile(t, "log:\n  level: info\n")
+	r := newTestReloader(t, path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hup := make(chan os.Signal, 1)
+	go r.watch(ctx, hup, 10*time.Millisecond)
+
+	// A file change is picked up by polling
+	require.NoError(t, os.WriteFile(path, []byte("log:\n  level: warn\n"), 0o600))
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(path, future, future))
+	assert.Eventually(t, func() bool {
+		return r.live.Level().Level() == slog.LevelWarn
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// SIGHUP reloads even when the modification time is unchanged
+	require.NoError(t, os.WriteFile(path, []byte("log:\n  level: error\n"), 0o600))
+	require.NoError(t, os.Chtimes(path, future, future))
+	hup <- syscall.SIGHUP
+	assert.Eventually(t, func() bool {
+		return r.live.Level().Level() == slog.LevelError
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestCORSWithConfig_FollowsReloads(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	live := NewLiveConfig(&Config{Server: ServerConfig{AllowedOrigins: []string{"https://a.example.com"}}})
+	r := gin.New()
+	r.Use(CORSWithConfig(live))
+	r.GET("/todos", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	allowed := func(origin string) string {
+		req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	assert.Equal(t, "https://a.example.com", allowed("https://a.example.com"))
+	assert.Empty(t, allowed("https://b.example.com"))
+
+	live.store(&Config{Server: ServerConfig{AllowedOrigins: []string{"https://b.example.com"}}})
+	assert.Empty(t, allowed("https://a.example.com"))
+	assert.Equal(t, "https://b.example.com", allowed("https://b.example.com"))
+}
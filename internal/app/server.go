@@ -2,37 +2,86 @@ package app
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	docs "github.com/drago44/golang-todo-api/docs/swagger"
+	"github.com/drago44/golang-todo-api/internal/cache"
+	"github.com/drago44/golang-todo-api/internal/database"
+	"github.com/drago44/golang-todo-api/internal/gql"
+	"github.com/drago44/golang-todo-api/internal/grpcapi"
+	"github.com/drago44/golang-todo-api/internal/health"
+	"github.com/drago44/golang-todo-api/internal/listener"
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/metrics"
+	"github.com/drago44/golang-todo-api/internal/migrate"
+	"github.com/drago44/golang-todo-api/internal/ratelimit"
 	"github.com/drago44/golang-todo-api/internal/router"
+	"github.com/drago44/golang-todo-api/internal/session"
+	"github.com/drago44/golang-todo-api/internal/tlsconfig"
 	"github.com/drago44/golang-todo-api/internal/todos"
+	"github.com/drago44/golang-todo-api/internal/tracing"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.uber.org/dig"
 	"gorm.io/gorm"
 )
 
-// Run performs application bootstrapping and starts the HTTP server.
-func Run() {
-	cfg, err := Load()
+// Run performs application bootstrapping and starts the HTTP server. args
+// are the command-line flags; see Load.
+func Run(args []string) {
+	loadedCfg, err := load(args, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+	if len(loadedCfg.args) > 0 {
+		log.Fatalf("unexpected arguments %q (commands are migrate and config)", loadedCfg.args)
+	}
+	cfg := loadedCfg.cfg
+	// Middleware reading live follows reloads; everything else keeps cfg
+	live := NewLiveConfig(cfg)
+
+	logger := logging.New(os.Stdout, live.Level())
+	// Route the standard library logger and package-level slog calls through it too
+	slog.SetDefault(logger)
 
-	db, err := Init(&cfg.Database)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if err := Migrate(db); err != nil {
+	db, err := Init(&cfg.Database, logger)
+	if err != nil {
 		log.Fatal(err)
 	}
 
+	// db is nil for memory://, which has no schema or connection pool
+	var migrator *migrate.Migrator
+	if db != nil {
+		migrator, err = NewMigrator(db, logger)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := Migrate(context.Background(), migrator, cfg.Database.AutoMigrate); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		logger.Warn("using in-memory storage; todos are lost on exit")
+	}
+
 	container := dig.New()
 
 	// Provide core singletons
@@ -42,8 +91,45 @@ func Run() {
 	if err := container.Provide(func() *gorm.DB { return db }); err != nil {
 		log.Fatal(err)
 	}
+	if err := container.Provide(func() *slog.Logger { return logger }); err != nil {
+		log.Fatal(err)
+	}
 
-	if err := container.Provide(func(cfg *Config) *gin.Engine {
+	// Metrics are nil when disabled; consumers skip instrumentation in that case
+	if err := container.Provide(func(cfg *Config, db *gorm.DB) (*metrics.Metrics, error) {
+		if !cfg.Server.EnableMetrics {
+			return nil, nil
+		}
+		m := metrics.New()
+		if db == nil {
+			return m, nil
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		if err := m.RegisterDBStats(sqlDB, "app"); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := container.Provide(func(cfg *Config) *session.Manager {
+		if !cfg.Session.Enabled() {
+			return nil
+		}
+		sessionCfg := cfg.Session
+		// Browsers only send Secure cookies over HTTPS, which is what clients see
+		// when TLS is terminated here or by a proxy
+		sessionCfg.Secure = cfg.TLS.Enabled() || cfg.Server.PublicScheme == "https"
+		return session.NewManager(sessionCfg)
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := container.Provide(func(cfg *Config, logger *slog.Logger, m *metrics.Metrics, sessions *session.Manager) *gin.Engine {
 		// Mode
 		mode := cfg.Server.GinMode
 		if mode == "" {
@@ -52,13 +138,40 @@ func Run() {
 		gin.SetMode(mode)
 
 		engine := gin.New()
+		if cfg.Server.SocketTrustForwarded {
+			// Before anything records the client IP
+			engine.Use(ForwardedSocketClient())
+		}
+		// Tracing first so every later middleware logs within the request span
+		engine.Use(otelgin.Middleware(tracing.ServiceName), RequestID())
+		if m != nil {
+			engine.Use(m.Middleware())
+		}
 		if cfg.Server.EnableLogger {
-			engine.Use(Logger())
+			engine.Use(Logger(logger))
+		}
+		// IP rules before CORS, so refused clients learn nothing about the policy.
+		// Always installed, as a reload can add rules
+		engine.Use(Recovery(), IPFilter(live, logger), CORSWithConfig(live), SecurityHeaders(cfg.Security))
+		if cfg.Security.MaxBodyBytes > 0 {
+			engine.Use(MaxBodySize(int64(cfg.Security.MaxBodyBytes)))
+		}
+		if cfg.Server.HSTSMaxAge > 0 {
+			engine.Use(HSTS(cfg.Server.HSTSMaxAge, cfg.Server.HSTSIncludeSubdomains, cfg.Server.PublicScheme))
+		}
+		if cfg.Server.RequestTimeout > 0 {
+			// Exports stream for as long as the client reads
+			engine.Use(RequestTimeout(cfg.Server.RequestTimeout, router.StreamingRoutes...))
 		}
-		engine.Use(Recovery(), CORSWithConfig(cfg))
-		if cfg.Server.EnableRateLimit {
-			engine.Use(RateLimit())
+		if sessions != nil {
+			engine.Use(sessions.Middleware(), sessions.CSRF())
 		}
+		// Always installed, as a reload can enable it
+		var onReject func()
+		if m != nil {
+			onReject = m.RateLimitRejected
+		}
+		engine.Use(APIKeys(live), RateLimit(live, ratelimit.NewMemoryStore(), onReject))
 		// Trusted proxies
 		if err := engine.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
 			log.Fatal(err)
@@ -76,17 +189,91 @@ func Run() {
 		}
 	}
 
-	if err := container.Provide(func(engine *gin.Engine, todoHandler *todos.TodoHandler, cfg *Config) *router.Router {
-		return router.New(engine, todoHandler, cfg.Server.EnableSwagger)
+	if err := container.Decorate(func(h *todos.TodoHandler, cfg *Config) *todos.TodoHandler {
+		if !cfg.Security.StrictJSON {
+			return h
+		}
+		return h.WithStrictJSON()
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := container.Decorate(func(repo todos.TodoRepository, cfg *Config, m *metrics.Metrics, logger *slog.Logger) todos.TodoRepository {
+		if !cfg.Cache.Enabled {
+			return repo
+		}
+		var onLookup func(query string, hit bool)
+		if m != nil {
+			onLookup = m.CacheLookup
+		}
+		return todos.WithCache(repo, cache.NewLRU(cfg.Cache.Size), cfg.Cache.TTL, logger, onLookup)
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := container.Provide(func(todoService todos.TodoService, logger *slog.Logger, cfg *Config) (*gql.Handler, error) {
+		limits := gql.Limits{
+			MaxDepth:      cfg.Server.GraphQLMaxDepth,
+			MaxComplexity: cfg.Server.GraphQLMaxComplexity,
+		}
+		return gql.NewHandler(todoService, logger, limits, cfg.Server.EnableGraphiQL)
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := container.Provide(func(db *gorm.DB, cfg *Config) (*health.Registry, error) {
+		registry := health.NewRegistry(cfg.Health.CheckTimeout)
+		if db == nil {
+			return registry, nil
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+
+		registry.AddReadinessCheck(health.Check{Name: "database", Run: health.DBPing(sqlDB)})
+		registry.AddReadinessCheck(health.Check{Name: "migrations", Run: migrator.Check})
+		// Free space only matters when the database lives on local disk
+		if src, err := database.Parse(cfg.Database.URL); err == nil && src.Driver == database.SQLite {
+			registry.AddReadinessCheck(health.Check{
+				Name: "disk",
+				Run:  health.DiskSpace(src.DataDir(), cfg.Health.MinFreeDiskMB<<20),
+			})
+		}
+		return registry, nil
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := container.Provide(func(engine *gin.Engine, todoHandler *todos.TodoHandler, syncHandler *todos.SyncHandler, graphqlHandler *gql.Handler, m *metrics.Metrics, healthRegistry *health.Registry, todoRepo todos.TodoRepository, sessions *session.Manager, logger *slog.Logger, cfg *Config) (*router.Router, error) {
+		var metricsHandler http.Handler
+		if m != nil {
+			if err := m.RegisterTodoCounts(todoRepo, logger); err != nil {
+				return nil, err
+			}
+			metricsHandler = m.Handler()
+		}
+		var sessionHandler *session.Handler
+		if sessions != nil {
+			sessionHandler = session.NewHandler(sessions)
+		}
+		return router.New(engine, todoHandler, syncHandler, graphqlHandler, metricsHandler, sessionHandler, healthRegistry, cfg.Server.EnableSwagger), nil
 	}); err != nil {
 		log.Fatal(err)
 	}
 
-	if err := container.Invoke(func(router *router.Router, cfg *Config) {
+	if err := container.Provide(grpcapi.NewServer); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := container.Invoke(func(router *router.Router, grpcServer *grpcapi.Server, healthRegistry *health.Registry, cfg *Config) {
 		addr := cfg.Server.Host + ":" + cfg.Server.Port
 
 		// Determine the public scheme from config; fallback by port if not set
 		protocol := cfg.Server.PublicScheme
+		if cfg.TLS.Enabled() {
+			protocol = "https"
+		}
 		if protocol == "" {
 			if cfg.Server.Port == "443" {
 				protocol = "https"
@@ -103,42 +290,149 @@ func Run() {
 		// Form the URL for clickability
 		url := protocol + "://" + addr
 
-		log.Printf("🚀 Server starting on %s", url)
+		logger.Info("server starting", "url", url, "log_level", cfg.Log.Level.String())
 		if cfg.Server.EnableSwagger {
-			log.Printf("📖 API Documentation: %s/swagger/index.html", url)
+			logger.Info("API documentation enabled", "url", url+"/swagger/index.html")
+		}
+		if cfg.Server.EnableGraphiQL {
+			logger.Info("GraphiQL enabled", "url", url+"/graphiql")
+		}
+		logger.Info("health checks available", "liveness", url+"/livez", "readiness", url+"/readyz")
+		if cfg.Server.EnableMetrics {
+			logger.Info("metrics enabled", "url", url+"/metrics")
+		}
+		if cfg.Server.EnableGRPC {
+			logger.Info("gRPC enabled", "addr", cfg.Server.Host+":"+cfg.Server.GRPCPort)
 		}
-		log.Printf("💚 Health Check: %s/health", url)
+
+		// Background work that stops with the server
+		bgCtx, stopBackground := context.WithCancel(context.Background())
 
 		// Start the server
-		srv := &http.Server{
-			Addr:              addr,
-			Handler:           router.GetEngine(),
-			ReadTimeout:       5 * time.Second,
-			ReadHeaderTimeout: 5 * time.Second,
-			WriteTimeout:      10 * time.Second,
-			IdleTimeout:       60 * time.Second,
-			MaxHeaderBytes:    1 << 20,
+		var handler http.Handler = router.GetEngine()
+		if cfg.Server.EnableH2C {
+			handler = withH2C(handler)
+		}
+		srv := newHTTPServer(addr, handler)
+		if cfg.TLS.Enabled() {
+			tlsCfg, certs, err := tlsconfig.New(cfg.TLS, logger)
+			if err != nil {
+				log.Fatal(err)
+			}
+			srv.TLSConfig = tlsCfg
+			go certs.Watch(bgCtx, cfg.TLS.ReloadInterval)
+			logger.Info("TLS enabled", "cert_file", cfg.TLS.CertFile, "not_after", certs.NotAfter(), "mutual_tls", cfg.TLS.ClientCAFile != "")
 		}
 
-		// Start the server in a goroutine
+		// Listen before serving so a busy port or socket fails startup
+		ln, err := listener.Listen(cfg.Server.Listen, addr, cfg.Server.SocketMode)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if cfg.Server.Listen != "" {
+			logger.Info("listening", "network", ln.Addr().Network(), "addr", ln.Addr().String())
+		}
+		// Only now is a systemd socket's network known
+		activatedUnix := strings.HasPrefix(cfg.Server.Listen, listener.Systemd) && ln.Addr().Network() == "unix"
+		if activatedUnix {
+			if errs := socketClientIPErrors(cfg); len(errs) > 0 {
+				log.Fatal(fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...)))
+			}
+		}
+
+		// Start the server in a goroutine; Shutdown closes ln, which removes
+		// a unix:// socket file
 		go func() {
-			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			var err error
+			if srv.TLSConfig != nil {
+				// The certificate comes from TLSConfig.GetCertificate; HTTP/2 is negotiated via ALPN
+				err = srv.ServeTLS(ln, "", "")
+			} else {
+				err = srv.Serve(ln)
+			}
+			if err != nil && err != http.ErrServerClosed {
 				log.Fatal(err)
 			}
 		}()
 
+		// Redirect plain HTTP to HTTPS when asked
+		var redirectSrv *http.Server
+		if cfg.Server.HTTPRedirectPort != "" {
+			redirectSrv = newHTTPServer(cfg.Server.Host+":"+cfg.Server.HTTPRedirectPort, redirectToHTTPS(cfg.Server.Port))
+			logger.Info("redirecting HTTP to HTTPS", "addr", redirectSrv.Addr)
+			go func() {
+				if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					log.Fatal(err)
+				}
+			}()
+		}
+
+		// Start the gRPC server alongside HTTP when enabled
+		if cfg.Server.EnableGRPC {
+			lis, err := net.Listen("tcp", cfg.Server.Host+":"+cfg.Server.GRPCPort)
+			if err != nil {
+				log.Fatal(err)
+			}
+			go func() {
+				if err := grpcServer.Serve(lis); err != nil {
+					log.Fatal(err)
+				}
+			}()
+		}
+
+		// Reload the runtime configuration on SIGHUP or file changes
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		go newReloader(args, loadedCfg, live, activatedUnix, logger).watch(bgCtx, hup, cfg.Server.ConfigWatchInterval)
+
 		// Shutdown the server gracefully
 		quit := make(chan os.Signal, 1)
 		signal.Notify(quit, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 		<-quit
-		log.Printf("📦 Shutting down server...")
+		stopBackground()
+		signal.Stop(hup)
+		logger.Info("shutting down server")
+
+		// Fail readiness first so load balancers drain this instance
+		healthRegistry.SetShuttingDown()
+		if cfg.Server.ShutdownDelay > 0 {
+			logger.Info("waiting before closing listeners", "delay", cfg.Server.ShutdownDelay.String())
+			time.Sleep(cfg.Server.ShutdownDelay)
+		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		if err := srv.Shutdown(ctx); err != nil {
-			log.Printf("Server forced to shutdown: %v", err)
+			logger.Error("server forced to shutdown", "error", err.Error())
+		}
+		if redirectSrv != nil {
+			if err := redirectSrv.Shutdown(ctx); err != nil {
+				logger.Error("redirect server forced to shutdown", "error", err.Error())
+			}
+		}
+		if cfg.Server.EnableGRPC {
+			if err := grpcServer.Shutdown(ctx); err != nil {
+				logger.Error("gRPC server forced to shutdown", "error", err.Error())
+			}
+		}
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("flushing traces failed", "error", err.Error())
 		}
 	}); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// newHTTPServer returns a server for handler on addr with the application's
+// timeouts.
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       5 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+	}
+}
@@ -0,0 +1,643 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/cors"
+	"github.com/drago44/golang-todo-api/internal/database"
+	"github.com/drago44/golang-todo-api/internal/ipfilter"
+	"github.com/drago44/golang-todo-api/internal/listener"
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/ratelimit"
+	"github.com/drago44/golang-todo-api/internal/session"
+	"github.com/drago44/golang-todo-api/internal/tlsconfig"
+	"github.com/drago44/golang-todo-api/internal/tracing"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names the YAML config file when --config is not given.
+const ConfigFileEnv = "CONFIG_FILE"
+
+// Sources of a setting's value, from lowest to highest precedence.
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// setting is one configuration value. Its key names it in the config file
+// (nested at the dots) and on the command line (--server.port).
+type setting struct {
+	key   string
+	env   string
+	def   string
+	usage string
+	// list settings are comma-separated in env and flags, sequences in files
+	list bool
+	// redact hides secrets when the value is printed
+	redact func(string) string
+	apply  func(cfg *Config, value string) error
+}
+
+// resolvedSetting is a setting's effective value and where it came from.
+type resolvedSetting struct {
+	*setting
+	value  string
+	source string
+}
+
+// origin describes where the value came from, such as "env PORT".
+func (r resolvedSetting) origin() string {
+	if r.source == sourceEnv {
+		return sourceEnv + " " + r.env
+	}
+	return r.source
+}
+
+// settings lists every configuration value. Defaults are the values the
+// server runs with when nothing is configured.
+var settings = []setting{
+	portSetting("server.port", "PORT", "8080", "HTTP listen port", func(c *Config) *string { return &c.Server.Port }),
+	{
+		key: "server.listen", env: "LISTEN", usage: "unix:///path/to.sock, systemd or systemd:NAME instead of TCP on host:port",
+		apply: func(c *Config, v string) error {
+			c.Server.Listen = v
+			return listener.Validate(v)
+		},
+	},
+	{
+		key: "server.socket_mode", env: "SOCKET_MODE", def: "0660", usage: "permissions of a unix:// socket file",
+		apply: func(c *Config, v string) error {
+			mode, err := strconv.ParseUint(v, 8, 32)
+			if err != nil || mode > 0o777 {
+				return fmt.Errorf("%q is not an octal permission such as 0660", v)
+			}
+			c.Server.SocketMode = os.FileMode(mode)
+			return nil
+		},
+	},
+	boolSetting("server.socket_trust_forwarded", "SOCKET_TRUST_FORWARDED", "false", "take the client IP from X-Forwarded-For or X-Real-IP on a unix:// or systemd socket", func(c *Config) *bool { return &c.Server.SocketTrustForwarded }),
+	stringSetting("server.host", "HOST", "localhost", "public host name used in logged URLs", func(c *Config) *string { return &c.Server.Host }),
+	portSetting("server.grpc_port", "GRPC_PORT", "9090", "gRPC listen port", func(c *Config) *string { return &c.Server.GRPCPort }),
+	boolSetting("server.enable_grpc", "ENABLE_GRPC", "false", "serve the gRPC API", func(c *Config) *bool { return &c.Server.EnableGRPC }),
+	oneOfSetting("server.public_scheme", "PUBLIC_SCHEME", "http", "scheme used in logged URLs", []string{"http", "https"}, func(c *Config) *string { return &c.Server.PublicScheme }),
+	boolSetting("server.enable_swagger", "ENABLE_SWAGGER", "false", "serve Swagger UI", func(c *Config) *bool { return &c.Server.EnableSwagger }),
+	boolSetting("server.enable_metrics", "ENABLE_METRICS", "false", "serve Prometheus metrics", func(c *Config) *bool { return &c.Server.EnableMetrics }),
+	boolSetting("server.enable_graphiql", "ENABLE_GRAPHIQL", "false", "serve the GraphiQL IDE", func(c *Config) *bool { return &c.Server.EnableGraphiQL }),
+	boolSetting("server.enable_logger", "ENABLE_LOGGER", "true", "log every HTTP request", func(c *Config) *bool { return &c.Server.EnableLogger }),
+	boolSetting("server.enable_rate_limit", "ENABLE_RATE_LIMIT", "false", "rate limit requests", func(c *Config) *bool { return &c.Server.EnableRateLimit }),
+	{
+		key: "server.allowed_origins", env: "ALLOWED_ORIGINS", usage: "CORS origins", list: true,
+		apply: func(c *Config, v string) error {
+			c.Server.AllowedOrigins = splitAndTrim(v)
+			for _, origin := range c.Server.AllowedOrigins {
+				if err := cors.ValidateOrigin(origin); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	boolSetting("server.allow_credentials", "ALLOW_CREDENTIALS", "true", "allow credentials in CORS requests", func(c *Config) *bool { return &c.Server.AllowCredentials }),
+	{
+		key: "cors.allowed_methods", env: "CORS_ALLOWED_METHODS", def: "GET,HEAD,POST,PUT,PATCH,DELETE", usage: "methods cross-origin requests may use", list: true,
+		apply: func(c *Config, v string) error {
+			c.CORS.AllowedMethods = splitAndTrim(v)
+			return nil
+		},
+	},
+	{
+		key: "cors.allowed_headers", env: "CORS_ALLOWED_HEADERS", usage: "request headers cross-origin requests may send (* allows any)", list: true,
+		def: "Accept,Authorization,Cache-Control,Content-Type,If-Match,If-None-Match,X-API-Key,X-CSRF-Token,X-Request-ID,X-Requested-With",
+		apply: func(c *Config, v string) error {
+			c.CORS.AllowedHeaders = splitAndTrim(v)
+			return nil
+		},
+	},
+	{
+		key: "cors.exposed_headers", env: "CORS_EXPOSED_HEADERS", usage: "response headers cross-origin scripts may read", list: true,
+		def: "RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset,RateLimit-Policy,Retry-After,X-CSRF-Token,X-Request-ID",
+		apply: func(c *Config, v string) error {
+			c.CORS.ExposedHeaders = splitAndTrim(v)
+			return nil
+		},
+	},
+	durationSetting("cors.max_age", "CORS_MAX_AGE", "10m", "how long browsers may cache a preflight result (0 leaves it to the browser)", func(c *Config) *time.Duration { return &c.CORS.MaxAge }),
+	{
+		key: "cors.routes", env: "CORS_ROUTES", usage: "per-route policies: PATH: origins=...; credentials=...; methods=...", list: true,
+		apply: func(c *Config, v string) error {
+			c.CORS.Routes = nil
+			for _, spec := range splitAndTrim(v) {
+				route, err := cors.ParseRoute(spec)
+				if err != nil {
+					return err
+				}
+				c.CORS.Routes = append(c.CORS.Routes, route)
+			}
+			return nil
+		},
+	},
+	oneOfSetting("server.gin_mode", "GIN_MODE", "release", "Gin mode", []string{"debug", "release", "test"}, func(c *Config) *string { return &c.Server.GinMode }),
+	{
+		key: "server.trusted_proxies", env: "TRUSTED_PROXIES", usage: "proxy IPs or CIDRs trusted for client IP headers", list: true,
+		apply: func(c *Config, v string) error {
+			c.Server.TrustedProxies = splitAndTrim(v)
+			for _, proxy := range c.Server.TrustedProxies {
+				if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+					return fmt.Errorf("%q is neither an IP address nor a CIDR", proxy)
+				}
+			}
+			return nil
+		},
+	}, {
+		key: "ip_filter.routes", env: "IP_FILTER_ROUTES", usage: "client IP rules for route groups: PATH: allow=CIDR ...; deny=CIDR ...", list: true,
+		apply: func(c *Config, v string) error {
+			c.IPFilter.Routes = nil
+			for _, spec := range splitAndTrim(v) {
+				rule, err := ipfilter.ParseRule(spec)
+				if err != nil {
+					return err
+				}
+				c.IPFilter.Routes = append(c.IPFilter.Routes, rule)
+			}
+			return nil
+		},
+	},
+
+	optionalPortSetting("server.http_redirect_port", "HTTP_REDIRECT_PORT", "plain HTTP port redirecting to HTTPS (empty disables)", func(c *Config) *string { return &c.Server.HTTPRedirectPort }),
+	durationSetting("server.hsts_max_age", "HSTS_MAX_AGE", "0s", "Strict-Transport-Security max-age on HTTPS responses (0 disables)", func(c *Config) *time.Duration { return &c.Server.HSTSMaxAge }),
+	boolSetting("server.hsts_include_subdomains", "HSTS_INCLUDE_SUBDOMAINS", "false", "extend HSTS to subdomains", func(c *Config) *bool { return &c.Server.HSTSIncludeSubdomains }),
+	boolSetting("server.enable_h2c", "ENABLE_H2C", "false", "accept plaintext HTTP/2 (h2c), for use behind a proxy", func(c *Config) *bool { return &c.Server.EnableH2C }),
+	durationSetting("server.request_timeout", "REQUEST_TIMEOUT", "8s", "request handling timeout (0 disables)", func(c *Config) *time.Duration { return &c.Server.RequestTimeout }),
+	durationSetting("server.shutdown_delay", "SHUTDOWN_DELAY", "0s", "keep serving this long after readiness fails on shutdown", func(c *Config) *time.Duration { return &c.Server.ShutdownDelay }),
+	durationSetting("server.config_watch_interval", "CONFIG_WATCH_INTERVAL", "0s", "reload when the config or .env file changes, checked this often (0 disables)", func(c *Config) *time.Duration { return &c.Server.ConfigWatchInterval }),
+	intSetting("server.graphql_max_depth", "GRAPHQL_MAX_DEPTH", "8", "GraphQL query depth limit", 1, func(c *Config) *int { return &c.Server.GraphQLMaxDepth }),
+	intSetting("server.graphql_max_complexity", "GRAPHQL_MAX_COMPLEXITY", "1000", "GraphQL query complexity limit", 1, func(c *Config) *int { return &c.Server.GraphQLMaxComplexity }),
+
+	stringSetting("security.content_security_policy", "CONTENT_SECURITY_POLICY", "default-src 'none'; frame-ancestors 'none'", "Content-Security-Policy of API responses (empty disables)", func(c *Config) *string { return &c.Security.ContentSecurityPolicy }),
+	oneOfSetting("security.frame_options", "FRAME_OPTIONS", "DENY", "X-Frame-Options (empty disables)", []string{"DENY", "SAMEORIGIN", ""}, func(c *Config) *string { return &c.Security.FrameOptions }),
+	stringSetting("security.referrer_policy", "REFERRER_POLICY", "no-referrer", "Referrer-Policy (empty disables)", func(c *Config) *string { return &c.Security.ReferrerPolicy }),
+	boolSetting("security.content_type_nosniff", "CONTENT_TYPE_NOSNIFF", "true", "send X-Content-Type-Options: nosniff", func(c *Config) *bool { return &c.Security.ContentTypeNosniff }),
+	intSetting("security.max_body_bytes", "MAX_BODY_BYTES", "1048576", "largest request body accepted (0 disables the limit)", 0, func(c *Config) *int { return &c.Security.MaxBodyBytes }),
+	boolSetting("security.strict_json", "STRICT_JSON", "false", "reject unknown fields in todo request bodies", func(c *Config) *bool { return &c.Security.StrictJSON }),
+
+	{
+		key: "session.secret", env: "SESSION_SECRET", usage: fmt.Sprintf("key signing session cookies and CSRF tokens, at least %d bytes; enables sessions", session.MinSecretLength), redact: redactSecret,
+		apply: func(c *Config, v string) error {
+			if v != "" && len(v) < session.MinSecretLength {
+				return fmt.Errorf("secret is %d bytes, want at least %d", len(v), session.MinSecretLength)
+			}
+			c.Session.Secret = v
+			return nil
+		},
+	},
+	positiveDurationSetting("session.ttl", "SESSION_TTL", "24h", "session lifetime", func(c *Config) *time.Duration { return &c.Session.TTL }),
+	{
+		key: "session.cookie_name", env: "SESSION_COOKIE_NAME", def: "todo_session", usage: "session cookie name",
+		apply: func(c *Config, v string) error {
+			if err := (&http.Cookie{Name: v}).Valid(); err != nil || v == session.CSRFCookieName {
+				return fmt.Errorf("%q is not a usable cookie name", v)
+			}
+			c.Session.CookieName = v
+			return nil
+		},
+	},
+
+	stringSetting("tls.cert_file", "TLS_CERT_FILE", "", "PEM certificate chain; enables HTTPS", func(c *Config) *string { return &c.TLS.CertFile }),
+	stringSetting("tls.key_file", "TLS_KEY_FILE", "", "PEM private key of the certificate", func(c *Config) *string { return &c.TLS.KeyFile }),
+	stringSetting("tls.client_ca_file", "TLS_CLIENT_CA_FILE", "", "PEM CAs whose client certificates are accepted; enables mutual TLS", func(c *Config) *string { return &c.TLS.ClientCAFile }),
+	oneOfSetting("tls.client_auth", "TLS_CLIENT_AUTH", tlsconfig.ClientAuthRequire, "client certificate policy with a client CA",
+		[]string{tlsconfig.ClientAuthRequire, tlsconfig.ClientAuthVerifyIfGiven},
+		func(c *Config) *string { return &c.TLS.ClientAuth }),
+	oneOfSetting("tls.min_version", "TLS_MIN_VERSION", tlsconfig.Version12, "oldest TLS version accepted",
+		[]string{tlsconfig.Version12, tlsconfig.Version13},
+		func(c *Config) *string { return &c.TLS.MinVersion }),
+	durationSetting("tls.reload_interval", "TLS_RELOAD_INTERVAL", "1m", "check the certificate files for renewals this often (0 disables)", func(c *Config) *time.Duration { return &c.TLS.ReloadInterval }),
+
+	{
+		key: "database.url", env: "DATABASE_URL", def: "data/app.db", usage: "database path or URL", redact: redactURL,
+		apply: func(c *Config, v string) error {
+			if _, err := database.Parse(v); err != nil {
+				return err
+			}
+			c.Database.URL = v
+			return nil
+		},
+	},
+	boolSetting("database.auto_migrate", "DB_AUTO_MIGRATE", "true", "apply pending migrations on startup", func(c *Config) *bool { return &c.Database.AutoMigrate }),
+	intSetting("database.max_open_conns", "DB_MAX_OPEN_CONNS", "0", "connection pool size (0 keeps the driver default)", 0, func(c *Config) *int { return &c.Database.MaxOpenConns }),
+	intSetting("database.max_idle_conns", "DB_MAX_IDLE_CONNS", "0", "idle connections kept (0 keeps the driver default)", 0, func(c *Config) *int { return &c.Database.MaxIdleConns }),
+	durationSetting("database.conn_max_lifetime", "DB_CONN_MAX_LIFETIME", "0s", "connection reuse limit (0 keeps the driver default)", func(c *Config) *time.Duration { return &c.Database.ConnMaxLifetime }),
+	durationSetting("database.slow_query_threshold", "DB_SLOW_QUERY_THRESHOLD", "200ms", "log queries slower than this (0 disables)", func(c *Config) *time.Duration { return &c.Database.SlowQueryThreshold }),
+
+	{
+		key: "log.level", env: "LOG_LEVEL", def: "info", usage: "debug, info, warn or error",
+		apply: func(c *Config, v string) (err error) {
+			c.Log.Level, err = logging.ParseLevel(v)
+			return err
+		},
+	},
+
+	positiveDurationSetting("health.check_timeout", "HEALTH_CHECK_TIMEOUT", "2s", "timeout of each readiness check", func(c *Config) *time.Duration { return &c.Health.CheckTimeout }),
+	{
+		key: "health.min_free_disk_mb", env: "HEALTH_MIN_FREE_DISK_MB", def: "100", usage: "free MiB below which readiness fails",
+		apply: func(c *Config, v string) (err error) {
+			c.Health.MinFreeDiskMB, err = strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%q is not a non-negative integer", v)
+			}
+			return nil
+		},
+	},
+
+	oneOfSetting("tracing.exporter", "TRACING_EXPORTER", tracing.ExporterNone, "span exporter",
+		[]string{tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterFile, tracing.ExporterOTLP},
+		func(c *Config) *string { return &c.Tracing.Exporter }),
+	stringSetting("tracing.file_path", "TRACING_FILE_PATH", "data/traces.jsonl", "span file for the file exporter", func(c *Config) *string { return &c.Tracing.FilePath }),
+	{
+		key: "tracing.otlp_endpoint", env: "TRACING_OTLP_ENDPOINT", def: "localhost:4318", usage: "OTLP/HTTP collector host:port or URL", redact: redactURL,
+		apply: func(c *Config, v string) error {
+			c.Tracing.OTLPEndpoint = v
+			return nil
+		},
+	},
+	boolSetting("tracing.otlp_insecure", "TRACING_OTLP_INSECURE", "true", "disable TLS towards a host:port endpoint", func(c *Config) *bool { return &c.Tracing.OTLPInsecure }),
+	{
+		key: "tracing.sample_ratio", env: "TRACING_SAMPLE_RATIO", def: "1", usage: "fraction of new traces recorded",
+		apply: func(c *Config, v string) error {
+			ratio, err := strconv.ParseFloat(v, 64)
+			if err != nil || math.IsNaN(ratio) || ratio < 0 || ratio > 1 {
+				return fmt.Errorf("%q is not a number between 0 and 1", v)
+			}
+			c.Tracing.SampleRatio = ratio
+			return nil
+		},
+	},
+
+	limitSetting("rate_limit.read", "RATE_LIMIT_READ", "100/1m", "limit for reads: requests/period[/burst]", func(c *Config) *ratelimit.Limit { return &c.RateLimit.Read }),
+	limitSetting("rate_limit.write", "RATE_LIMIT_WRITE", "30/1m/10", "limit for writes: requests/period[/burst]", func(c *Config) *ratelimit.Limit { return &c.RateLimit.Write }),
+	{
+		key: "rate_limit.routes", env: "RATE_LIMIT_ROUTES", usage: `per-route limits: "METHOD /route=limit"`, list: true,
+		apply: func(c *Config, v string) error {
+			c.RateLimit.Routes = make(map[string]ratelimit.Limit)
+			for _, entry := range splitAndTrim(v) {
+				route, spec, ok := strings.Cut(entry, "=")
+				method, path, hasPath := strings.Cut(strings.TrimSpace(route), " ")
+				if !ok || !hasPath {
+					return fmt.Errorf("%q: want \"METHOD /route=limit\"", entry)
+				}
+				limit, err := ratelimit.ParseLimit(spec)
+				if err != nil {
+					return err
+				}
+				c.RateLimit.Routes[strings.ToUpper(method)+" "+strings.TrimSpace(path)] = limit
+			}
+			return nil
+		},
+	},
+	{
+		key: "rate_limit.key_by", env: "RATE_LIMIT_KEY_BY", def: RateLimitKeyIP, usage: "client identities tried in order: api_key, ip", list: true,
+		apply: func(c *Config, v string) error {
+			c.RateLimit.KeyBy = splitAndTrim(v)
+			for _, source := range c.RateLimit.KeyBy {
+				switch source {
+				case RateLimitKeyAPIKey, RateLimitKeyIP:
+				case "user":
+					return errors.New(`"user" needs user authentication, which this API does not have`)
+				default:
+					return fmt.Errorf("unknown identity %q (want api_key or ip)", source)
+				}
+			}
+			return nil
+		},
+	},
+	{
+		key: "rate_limit.api_keys", env: "RATE_LIMIT_API_KEYS", usage: "API keys accepted in X-API-Key for the api_key identity", list: true, redact: redactSecret,
+		apply: func(c *Config, v string) error {
+			c.RateLimit.APIKeys = splitAndTrim(v)
+			return nil
+		},
+	},
+
+	boolSetting("cache.enabled", "CACHE_ENABLED", "false", "cache todo reads", func(c *Config) *bool { return &c.Cache.Enabled }),
+	positiveDurationSetting("cache.ttl", "CACHE_TTL", "30s", "cache entry lifetime", func(c *Config) *time.Duration { return &c.Cache.TTL }),
+	intSetting("cache.size", "CACHE_SIZE", "1000", "maximum cached entries", 1, func(c *Config) *int { return &c.Cache.Size }),
+}
+
+// loaded is a resolved configuration.
+type loaded struct {
+	cfg      *Config
+	settings []resolvedSetting
+	// args are the positional arguments left after the flags
+	args []string
+	// configFile is the config file read, if any
+	configFile string
+}
+
+// loadSettings resolves every setting from flags, environment (looked up
+// with lookupEnv), the config file and defaults, in that order of
+// precedence. All problems found are returned joined together.
+func loadSettings(args []string, stderr io.Writer, lookupEnv func(string) (string, bool)) (*loaded, error) {
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	defaultConfigFile, _ := lookupEnv(ConfigFileEnv)
+	configFile := fs.String("config", defaultConfigFile, "YAML config file (env "+ConfigFileEnv+")")
+	flags := make(map[string]*string, len(settings))
+	for i := range settings {
+		s := &settings[i]
+		flags[s.key] = fs.String(s.key, "", fmt.Sprintf("%s (env %s, default %q)", s.usage, s.env, s.def))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	setFlags := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	var errs []error
+	file := map[string]string{}
+	if *configFile != "" {
+		var err error
+		if file, err = readConfigFile(*configFile); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	cfg := &Config{}
+	resolved := make([]resolvedSetting, 0, len(settings))
+	for i := range settings {
+		s := &settings[i]
+		r := resolvedSetting{setting: s, value: s.def, source: sourceDefault}
+		if v, ok := file[s.key]; ok {
+			r.value, r.source = v, sourceFile
+		}
+		// A variable set to the empty string overrides the file, so
+		// ALLOWED_ORIGINS= clears a list the file sets
+		if v, ok := lookupEnv(s.env); ok {
+			r.value, r.source = v, sourceEnv
+		}
+		if setFlags[s.key] {
+			r.value, r.source = *flags[s.key], sourceFlag
+		}
+
+		if err := s.apply(cfg, strings.TrimSpace(r.value)); err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", s.key, r.origin(), err))
+		}
+		resolved = append(resolved, r)
+	}
+
+	errs = append(errs, validate(cfg)...)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return &loaded{cfg: cfg, settings: resolved, args: fs.Args(), configFile: *configFile}, nil
+}
+
+// validate checks rules that span several settings.
+func validate(cfg *Config) []error {
+	var errs []error
+	if cfg.Server.AllowCredentials {
+		for _, origin := range cfg.Server.AllowedOrigins {
+			if origin == "*" {
+				errs = append(errs, errors.New("server.allowed_origins: \"*\" cannot be combined with server.allow_credentials=true"))
+			}
+		}
+	}
+	if len(errs) == 0 {
+		if _, err := cors.New(cfg.corsPolicy(), cfg.CORS.Routes); err != nil {
+			errs = append(errs, fmt.Errorf("cors.routes: %w", err))
+		}
+	}
+	if (cfg.TLS.CertFile == "") != (cfg.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls.cert_file and tls.key_file must be set together"))
+	}
+	if cfg.TLS.ClientCAFile != "" && !cfg.TLS.Enabled() {
+		errs = append(errs, errors.New("tls.client_ca_file: mutual TLS needs tls.cert_file"))
+	}
+	if cfg.Server.HTTPRedirectPort != "" {
+		if !cfg.TLS.Enabled() {
+			errs = append(errs, errors.New("server.http_redirect_port: redirecting to HTTPS needs tls.cert_file"))
+		}
+		if cfg.Server.HTTPRedirectPort == cfg.Server.Port {
+			errs = append(errs, fmt.Errorf("server.http_redirect_port: %s is already the HTTPS port", cfg.Server.HTTPRedirectPort))
+		}
+	}
+	if cfg.Server.EnableH2C && cfg.TLS.Enabled() {
+		errs = append(errs, errors.New("server.enable_h2c: HTTP/2 is negotiated over TLS already; h2c is for plaintext listeners"))
+	}
+	if strings.HasPrefix(cfg.Server.Listen, listener.UnixPrefix) {
+		errs = append(errs, socketClientIPErrors(cfg)...)
+	}
+	if cfg.Server.SocketTrustForwarded && cfg.Server.Listen == "" {
+		errs = append(errs, errors.New("server.socket_trust_forwarded: only applies to a unix:// or systemd socket; use server.trusted_proxies over TCP"))
+	}
+	if slices.Contains(cfg.RateLimit.KeyBy, RateLimitKeyAPIKey) && len(cfg.RateLimit.APIKeys) == 0 {
+		errs = append(errs, errors.New("rate_limit.key_by: api_key needs rate_limit.api_keys to verify keys against"))
+	}
+	if cfg.Server.EnableGRPC && cfg.Server.GRPCPort == cfg.Server.Port {
+		errs = append(errs, fmt.Errorf("server.grpc_port: %s is already the HTTP port", cfg.Server.GRPCPort))
+	}
+	return errs
+}
+
+// socketClientIPErrors rejects the settings that need a client IP on a Unix
+// socket listener, where every client has the same, empty address unless
+// server.socket_trust_forwarded takes it from the proxy. validate applies it
+// to unix:// listens; a systemd socket is checked once it is inherited, as
+// only then is its network known.
+func socketClientIPErrors(cfg *Config) []error {
+	if cfg.Server.SocketTrustForwarded {
+		return nil
+	}
+	var errs []error
+	if len(cfg.IPFilter.Routes) > 0 {
+		errs = append(errs, errors.New("ip_filter.routes: a Unix socket has no client IP to check; set server.socket_trust_forwarded behind a proxy"))
+	}
+	if cfg.Server.EnableRateLimit {
+		errs = append(errs, errors.New("server.enable_rate_limit: a Unix socket has no client IP to key on; set server.socket_trust_forwarded behind a proxy"))
+	}
+	return errs
+}
+
+// readConfigFile reads a YAML file into setting keys. Unknown keys are an
+// error, so a typo cannot silently leave a default in place.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	known := make(map[string]*setting, len(settings))
+	for i := range settings {
+		known[settings[i].key] = &settings[i]
+	}
+
+	values := make(map[string]string)
+	var errs []error
+	var walk func(prefix string, node map[string]any)
+	walk = func(prefix string, node map[string]any) {
+		for name, v := range node {
+			key := prefix + name
+			if child, ok := v.(map[string]any); ok {
+				walk(key+".", child)
+				continue
+			}
+			s, ok := known[key]
+			if !ok {
+				errs = append(errs, fmt.Errorf("config file %s: unknown key %q", path, key))
+				continue
+			}
+			switch v := v.(type) {
+			case nil:
+				values[key] = ""
+			case []any:
+				if !s.list {
+					errs = append(errs, fmt.Errorf("config file %s: %s takes a single value", path, key))
+					continue
+				}
+				items := make([]string, len(v))
+				for i, item := range v {
+					items[i] = fmt.Sprint(item)
+				}
+				values[key] = strings.Join(items, ",")
+			default:
+				values[key] = fmt.Sprint(v)
+			}
+		}
+	}
+	walk("", doc)
+	return values, errors.Join(errs...)
+}
+
+func stringSetting(key, env, def, usage string, field func(*Config) *string) setting {
+	return setting{key: key, env: env, def: def, usage: usage, apply: func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}}
+}
+
+func oneOfSetting(key, env, def, usage string, allowed []string, field func(*Config) *string) setting {
+	return setting{key: key, env: env, def: def, usage: usage, apply: func(c *Config, v string) error {
+		for _, a := range allowed {
+			if v == a {
+				*field(c) = v
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %s", v, strings.Join(allowed, ", "))
+	}}
+}
+
+func portSetting(key, env, def, usage string, field func(*Config) *string) setting {
+	return setting{key: key, env: env, def: def, usage: usage, apply: func(c *Config, v string) error {
+		if n, err := strconv.Atoi(v); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("%q is not a port between 1 and 65535", v)
+		}
+		*field(c) = v
+		return nil
+	}}
+}
+
+// optionalPortSetting is a portSetting that may be left empty.
+func optionalPortSetting(key, env, usage string, field func(*Config) *string) setting {
+	port := portSetting(key, env, "", usage, field)
+	apply := port.apply
+	port.apply = func(c *Config, v string) error {
+		if v == "" {
+			*field(c) = ""
+			return nil
+		}
+		return apply(c, v)
+	}
+	return port
+}
+
+func boolSetting(key, env, def, usage string, field func(*Config) *bool) setting {
+	return setting{key: key, env: env, def: def, usage: usage, apply: func(c *Config, v string) error {
+		switch strings.ToLower(v) {
+		case "1", "true", "yes", "on":
+			*field(c) = true
+		case "0", "false", "no", "off":
+			*field(c) = false
+		default:
+			return fmt.Errorf("%q is not a boolean (want true or false)", v)
+		}
+		return nil
+	}}
+}
+
+func intSetting(key, env, def, usage string, minimum int, field func(*Config) *int) setting {
+	return setting{key: key, env: env, def: def, usage: usage, apply: func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < minimum {
+			return fmt.Errorf("%q is not an integer of at least %d", v, minimum)
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func durationSetting(key, env, def, usage string, field func(*Config) *time.Duration) setting {
+	return setting{key: key, env: env, def: def, usage: usage, apply: func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return fmt.Errorf("%q is not a non-negative duration such as 500ms or 2m", v)
+		}
+		*field(c) = d
+		return nil
+	}}
+}
+
+func positiveDurationSetting(key, env, def, usage string, field func(*Config) *time.Duration) setting {
+	return setting{key: key, env: env, def: def, usage: usage, apply: func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("%q is not a positive duration such as 500ms or 2m", v)
+		}
+		*field(c) = d
+		return nil
+	}}
+}
+
+func limitSetting(key, env, def, usage string, field func(*Config) *ratelimit.Limit) setting {
+	return setting{key: key, env: env, def: def, usage: usage, apply: func(c *Config, v string) (err error) {
+		*field(c), err = ratelimit.ParseLimit(v)
+		return err
+	}}
+}
+
+// redactSecret hides a secret entirely.
+func redactSecret(v string) string {
+	if v == "" {
+		return v
+	}
+	return "xxxxx"
+}
+
+// redactURL hides the password of a URL-shaped value.
+func redactURL(v string) string {
+	u, err := url.Parse(v)
+	if err != nil || u.User == nil {
+		return v
+	}
+	if _, hasPassword := u.User.Password(); !hasPassword {
+		return v
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2)
+
+	require.NoError(t, c.Set(ctx, "a", []byte("1"), 0))
+	require.NoError(t, c.Set(ctx, "b", []byte("2"), 0))
+	// Reading a makes b the eviction candidate
+	_, ok, _ := c.Get(ctx, "a")
+	require.True(t, ok)
+	require.NoError(t, c.Set(ctx, "c", []byte("3"), 0))
+
+	_, ok, _ = c.Get(ctx, "b")
+	assert.False(t, ok, "b should have been evicted")
+	v, ok, _ := c.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", string(v))
+	assert.Equal(t, 2, c.Len())
+}
+
+func TestLRU_ExpiresEntries(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	require.NoError(t, c.Set(ctx, "short", []byte("x"), time.Second))
+	require.NoError(t, c.Set(ctx, "forever", []byte("y"), 0))
+
+	now = now.Add(time.Second)
+	_, ok, _ := c.Get(ctx, "short")
+	assert.False(t, ok)
+	_, ok, _ = c.Get(ctx, "forever")
+	assert.True(t, ok)
+	assert.Equal(t, 1, c.Len(), "expired entries are dropped on read")
+}
+
+func TestLRU_SetOverwritesAndDeleteIgnoresMissing(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10)
+
+	require.NoError(t, c.Set(ctx, "k", []byte("old"), 0))
+	require.NoError(t, c.Set(ctx, "k", []byte("new"), 0))
+	v, _, _ := c.Get(ctx, "k")
+	assert.Equal(t, "new", string(v))
+
+	require.NoError(t, c.Delete(ctx, "k", "missing"))
+	_, ok, _ := c.Get(ctx, "k")
+	assert.False(t, ok)
+}
@@ -0,0 +1,361 @@
+// Package cors implements Cross-Origin Resource Sharing: matching request
+// origins against exact, wildcard-subdomain and regular expression patterns,
+// answering preflight requests, and applying a different policy to route
+// groups that need one.
+package cors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Origin pattern forms besides an exact origin such as https://example.com.
+const (
+	// AnyOrigin allows every origin
+	AnyOrigin = "*"
+	// RegexPrefix starts a regular expression matched against the whole
+	// origin, ignoring case: ~^https://pr-[0-9]+\.preview\.example\.com$
+	RegexPrefix = "~"
+)
+
+// Policy describes which cross-origin requests are allowed.
+type Policy struct {
+	// AllowedOrigins holds exact origins, AnyOrigin, wildcard subdomain
+	// patterns such as https://*.example.com, and RegexPrefix expressions
+	AllowedOrigins   []string
+	AllowCredentials bool
+	AllowedMethods   []string
+	// AllowedHeaders are the request headers a preflight may ask for; "*"
+	// allows any
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read
+	ExposedHeaders []string
+	// MaxAge is how long browsers may cache a preflight result; 0 leaves it
+	// to the browser
+	MaxAge time.Duration
+}
+
+// Route overrides parts of the default policy for paths under Prefix. Nil
+// fields keep the default policy's value.
+type Route struct {
+	Prefix           string
+	AllowedOrigins   []string
+	AllowCredentials *bool
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	MaxAge           *time.Duration
+}
+
+// ValidateOrigin checks an origin pattern.
+func ValidateOrigin(pattern string) error {
+	_, err := newMatcher(pattern)
+	return err
+}
+
+// ParseRoute parses a route override of the form
+//
+//	/api/v1/public: origins=* https://*.example.com; methods=GET HEAD; credentials=false
+//
+// Fields are origins, credentials, methods, headers, exposed and max_age;
+// list values are separated by spaces.
+func ParseRoute(spec string) (Route, error) {
+	prefix, fields, ok := strings.Cut(spec, ":")
+	prefix = strings.TrimSpace(prefix)
+	if !ok || !strings.HasPrefix(prefix, "/") {
+		return Route{}, fmt.Errorf("%q is not PATH: field=value; ...", spec)
+	}
+
+	route := Route{Prefix: prefix}
+	for _, field := range strings.Split(fields, ";") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return Route{}, fmt.Errorf("route %s: %q is not field=value", prefix, strings.TrimSpace(field))
+		}
+		values := strings.Fields(value)
+		switch name = strings.TrimSpace(name); name {
+		case "origins":
+			for _, origin := range values {
+				if err := ValidateOrigin(origin); err != nil {
+					return Route{}, fmt.Errorf("route %s: %w", prefix, err)
+				}
+			}
+			route.AllowedOrigins = values
+		case "credentials":
+			allow, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				return Route{}, fmt.Errorf("route %s: credentials %q is not a boolean", prefix, strings.TrimSpace(value))
+			}
+			route.AllowCredentials = &allow
+		case "methods":
+			route.AllowedMethods = values
+		case "headers":
+			route.AllowedHeaders = values
+		case "exposed":
+			route.ExposedHeaders = values
+		case "max_age":
+			maxAge, err := time.ParseDuration(strings.TrimSpace(value))
+			if err != nil || maxAge < 0 {
+				return Route{}, fmt.Errorf("route %s: max_age %q is not a non-negative duration", prefix, strings.TrimSpace(value))
+			}
+			route.MaxAge = &maxAge
+		default:
+			return Route{}, fmt.Errorf("route %s: unknown field %q (want origins, credentials, methods, headers, exposed or max_age)", prefix, name)
+		}
+		if len(values) == 0 && name != "credentials" && name != "max_age" {
+			// An empty list would silently allow nothing
+			return Route{}, fmt.Errorf("route %s: %s needs at least one value", prefix, name)
+		}
+	}
+	return route, nil
+}
+
+// apply returns p with the route's overrides applied.
+func (r Route) apply(p Policy) Policy {
+	if r.AllowedOrigins != nil {
+		p.AllowedOrigins = r.AllowedOrigins
+	}
+	if r.AllowCredentials != nil {
+		p.AllowCredentials = *r.AllowCredentials
+	}
+	if r.AllowedMethods != nil {
+		p.AllowedMethods = r.AllowedMethods
+	}
+	if r.AllowedHeaders != nil {
+		p.AllowedHeaders = r.AllowedHeaders
+	}
+	if r.ExposedHeaders != nil {
+		p.ExposedHeaders = r.ExposedHeaders
+	}
+	if r.MaxAge != nil {
+		p.MaxAge = *r.MaxAge
+	}
+	return p
+}
+
+// CORS applies a default policy and its route overrides to requests.
+type CORS struct {
+	def *policy
+	// routes are ordered longest prefix first
+	routes []compiledRoute
+}
+
+type compiledRoute struct {
+	prefix string
+	policy *policy
+}
+
+// New compiles the default policy and route overrides.
+func New(def Policy, routes []Route) (*CORS, error) {
+	compiled, err := compile(def)
+	if err != nil {
+		return nil, err
+	}
+	c := &CORS{def: compiled}
+	for _, r := range routes {
+		p, err := compile(r.apply(def))
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %w", r.Prefix, err)
+		}
+		c.routes = append(c.routes, compiledRoute{prefix: strings.TrimSuffix(r.Prefix, "/"), policy: p})
+	}
+	slices.SortStableFunc(c.routes, func(a, b compiledRoute) int { return len(b.prefix) - len(a.prefix) })
+	return c, nil
+}
+
+// Handle sets the CORS response headers for r on h and reports whether r is
+// a preflight request, which the caller should answer with 204 No Content
+// without running its handler. A disallowed origin, method or header gets no
+// CORS headers, so the browser blocks the request.
+func (c *CORS) Handle(h http.Header, r *http.Request) (preflight bool) {
+	p := c.policyFor(r.URL.Path)
+	origin := r.Header.Get("Origin")
+	requestMethod := r.Header.Get("Access-Control-Request-Method")
+	preflight = r.Method == http.MethodOptions && origin != "" && requestMethod != ""
+
+	// Responses differ by origin, so shared caches must key on it
+	if preflight {
+		h.Add("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+	} else {
+		h.Add("Vary", "Origin")
+	}
+	if origin == "" || !p.allowsOrigin(origin) {
+		return preflight
+	}
+
+	if preflight {
+		if !slices.Contains(p.methods, strings.ToUpper(requestMethod)) {
+			return true
+		}
+		requested := parseHeaderList(r.Header.Get("Access-Control-Request-Headers"))
+		for _, name := range requested {
+			if !p.anyHeader && !p.headers[name] {
+				return true
+			}
+		}
+		h.Set("Access-Control-Allow-Methods", strings.Join(p.methods, ", "))
+		if len(requested) > 0 {
+			h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+		}
+		if p.maxAge != "" {
+			h.Set("Access-Control-Max-Age", p.maxAge)
+		}
+	} else if p.exposed != "" {
+		h.Set("Access-Control-Expose-Headers", p.exposed)
+	}
+
+	if p.anyOrigin && !p.credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	return preflight
+}
+
+func (c *CORS) policyFor(path string) *policy {
+	for _, r := range c.routes {
+		if path == r.prefix || strings.HasPrefix(path, r.prefix+"/") {
+			return r.policy
+		}
+	}
+	return c.def
+}
+
+// policy is a compiled Policy.
+type policy struct {
+	origins     []matcher
+	anyOrigin   bool
+	credentials bool
+	methods     []string
+	// headers holds allowed request headers in lower case
+	headers   map[string]bool
+	anyHeader bool
+	exposed   string
+	maxAge    string
+}
+
+func compile(p Policy) (*policy, error) {
+	c := &policy{credentials: p.AllowCredentials, headers: map[string]bool{}}
+	for _, pattern := range p.AllowedOrigins {
+		if pattern == AnyOrigin {
+			if p.AllowCredentials {
+				// Browsers refuse credentials with a wildcard, and echoing any
+				// origin instead would hand every site the user's session
+				return nil, errors.New(`origin "*" cannot be combined with credentials`)
+			}
+			c.anyOrigin = true
+			continue
+		}
+		m, err := newMatcher(pattern)
+		if err != nil {
+			return nil, err
+		}
+		c.origins = append(c.origins, m)
+	}
+	for _, method := range p.AllowedMethods {
+		c.methods = append(c.methods, strings.ToUpper(method))
+	}
+	for _, name := range p.AllowedHeaders {
+		if name == "*" {
+			c.anyHeader = true
+		}
+		c.headers[strings.ToLower(name)] = true
+	}
+	c.exposed = strings.Join(p.ExposedHeaders, ", ")
+	if p.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(p.MaxAge.Seconds()))
+	}
+	return c, nil
+}
+
+func (p *policy) allowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, m := range p.origins {
+		if m(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// matcher reports whether a lower-case origin matches a pattern.
+type matcher func(origin string) bool
+
+// subdomainChars are those a wildcard may stand for: host name labels and
+// the dots between them, but never a port or path.
+const subdomainChars = "abcdefghijklmnopqrstuvwxyz0123456789-."
+
+func newMatcher(pattern string) (matcher, error) {
+	if pattern == AnyOrigin {
+		return func(string) bool { return true }, nil
+	}
+	if expr, ok := strings.CutPrefix(pattern, RegexPrefix); ok {
+		// Origins are matched lower-cased, so the pattern's case must not matter
+		re, err := regexp.Compile(`(?i)^(?:` + expr + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("origin %q: %w", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+
+	pattern = strings.ToLower(pattern)
+	if prefix, suffix, ok := strings.Cut(pattern, "*"); ok {
+		// Only a whole leftmost label may be a wildcard: https://*.example.com
+		if !strings.HasSuffix(prefix, "://") || !strings.HasPrefix(suffix, ".") || strings.Contains(suffix, "*") {
+			return nil, fmt.Errorf("%q is not a wildcard origin such as https://*.example.com", pattern)
+		}
+		if err := validateExact(prefix + "x" + suffix); err != nil {
+			return nil, err
+		}
+		return func(origin string) bool {
+			sub, ok := strings.CutPrefix(origin, prefix)
+			if !ok {
+				return false
+			}
+			sub, ok = strings.CutSuffix(sub, suffix)
+			return ok && sub != "" && strings.Trim(sub, subdomainChars) == "" && !strings.HasPrefix(sub, ".") && !strings.HasSuffix(sub, ".")
+		}, nil
+	}
+
+	if err := validateExact(pattern); err != nil {
+		return nil, err
+	}
+	pattern = strings.TrimSuffix(pattern, "/")
+	return func(origin string) bool { return origin == pattern }, nil
+}
+
+func validateExact(origin string) error {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return fmt.Errorf("%q is not an origin such as https://app.example.com", origin)
+	}
+	return nil
+}
+
+// parseHeaderList splits a comma-separated header name list into lower-case
+// names.
+func parseHeaderList(v string) []string {
+	var names []string
+	for _, name := range strings.Split(v, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,162 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOriginPatterns(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		allowed []string
+		denied  []string
+	}{
+		{
+			pattern: "https://app.example.com",
+			allowed: []string{"https://app.example.com", "https://APP.example.com"},
+			denied:  []string{"http://app.example.com", "https://app.example.com:8443", "https://app.example.com.evil.com"},
+		},
+		{
+			pattern: "https://*.example.com",
+			allowed: []string{"https://app.example.com", "https://a.b.example.com"},
+			denied: []string{
+				"https://example.com", "http://app.example.com", "https://evilexample.com",
+				"https://app.example.com.evil.com", "https://evil.com/.example.com", "https://app.example.com:8443",
+			},
+		},
+		{
+			pattern: `~https://pr-[0-9]+\.preview\.example\.com`,
+			allowed: []string{"https://pr-42.preview.example.com"},
+			denied:  []string{"https://pr-x.preview.example.com", "https://pr-42.preview.example.com.evil.com"},
+		},
+		{
+			pattern: `~https://PR-[0-9]+\.Preview\.Example\.com`,
+			allowed: []string{"https://pr-42.preview.example.com", "https://PR-42.PREVIEW.example.com"},
+			denied:  []string{"https://pr-42.preview.example.org"},
+		},
+	} {
+		c, err := New(Policy{AllowedOrigins: []string{tc.pattern}}, nil)
+		require.NoError(t, err, tc.pattern)
+		for _, origin := range tc.allowed {
+			assert.True(t, c.def.allowsOrigin(origin), "%s should allow %s", tc.pattern, origin)
+		}
+		for _, origin := range tc.denied {
+			assert.False(t, c.def.allowsOrigin(origin), "%s should deny %s", tc.pattern, origin)
+		}
+	}
+
+	for _, pattern := range []string{"example.com", "https://app.*.example.com", "https://*example.com", "*.example.com", "~(", "https://example.com/path"} {
+		err := ValidateOrigin(pattern)
+		t.Logf("%s: %v", pattern, err)
+		assert.Error(t, err, pattern)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	c, err := New(Policy{
+		AllowedOrigins:   []string{"https://*.example.com"},
+		AllowCredentials: true,
+		AllowedMethods:   []string{"GET", "POST", "DELETE"},
+		AllowedHeaders:   []string{"Content-Type", "X-CSRF-Token"},
+		ExposedHeaders:   []string{"ETag", "Link"},
+		MaxAge:           10 * time.Minute,
+	}, nil)
+	require.NoError(t, err)
+
+	serve := func(method, origin string, header http.Header) (http.Header, bool) {
+		r := httptest.NewRequest(method, "/api/v1/todos", nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		h := http.Header{}
+		preflight := c.Handle(h, r)
+		t.Logf("%s from %q %v: preflight=%t %v", method, origin, header, preflight, h)
+		return h, preflight
+	}
+
+	// Actual request
+	h, preflight := serve(http.MethodGet, "https://app.example.com", nil)
+	assert.False(t, preflight)
+	assert.Equal(t, "https://app.example.com", h.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", h.Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "ETag, Link", h.Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "Origin", h.Get("Vary"))
+
+	// Preflight echoes the requested headers it allows
+	h, preflight = serve(http.MethodOptions, "https://app.example.com", http.Header{
+		"Access-Control-Request-Method":  {"DELETE"},
+		"Access-Control-Request-Headers": {"content-type, X-CSRF-Token"},
+	})
+	assert.True(t, preflight)
+	assert.Equal(t, "https://app.example.com", h.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST, DELETE", h.Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "content-type, x-csrf-token", h.Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", h.Get("Access-Control-Max-Age"))
+	assert.Empty(t, h.Get("Access-Control-Expose-Headers"))
+
+	// Disallowed headers, methods and origins get no CORS headers
+	for _, tc := range []struct {
+		origin string
+		header http.Header
+	}{
+		{"https://app.example.com", http.Header{"Access-Control-Request-Method": {"POST"}, "Access-Control-Request-Headers": {"X-Debug"}}},
+		{"https://app.example.com", http.Header{"Access-Control-Request-Method": {"PUT"}}},
+		{"https://evil.com", http.Header{"Access-Control-Request-Method": {"GET"}}},
+	} {
+		h, preflight = serve(http.MethodOptions, tc.origin, tc.header)
+		assert.True(t, preflight)
+		assert.Empty(t, h.Get("Access-Control-Allow-Origin"))
+	}
+
+	// OPTIONS without Access-Control-Request-Method is an ordinary request
+	_, preflight = serve(http.MethodOptions, "https://app.example.com", nil)
+	assert.False(t, preflight)
+}
+
+func TestRoutes(t *testing.T) {
+	public, err := ParseRoute("/api/v1/todos: origins=*; credentials=false; methods=GET HEAD")
+	require.NoError(t, err)
+	c, err := New(Policy{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowCredentials: true,
+		AllowedMethods:   []string{"GET", "POST"},
+	}, []Route{public})
+	require.NoError(t, err)
+
+	serve := func(path, origin string) http.Header {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Origin", origin)
+		h := http.Header{}
+		c.Handle(h, r)
+		return h
+	}
+
+	h := serve("/api/v1/todos/1", "https://anyone.example.org")
+	assert.Equal(t, "*", h.Get("Access-Control-Allow-Origin"), "the public route allows any origin")
+	assert.Empty(t, h.Get("Access-Control-Allow-Credentials"), "credentials header is left out rather than false")
+
+	assert.Empty(t, serve("/api/v1/todosx", "https://anyone.example.org").Get("Access-Control-Allow-Origin"), "prefixes match whole segments")
+	h = serve("/api/v1/sync", "https://app.example.com")
+	assert.Equal(t, "https://app.example.com", h.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", h.Get("Access-Control-Allow-Credentials"))
+
+	// A route inheriting credentials cannot allow every origin
+	wildcard, err := ParseRoute("/public: origins=*")
+	require.NoError(t, err)
+	_, err = New(Policy{AllowCredentials: true}, []Route{wildcard})
+	assert.ErrorContains(t, err, "route /public")
+
+	for _, spec := range []string{"public: origins=*", "/x: origins=", "/x: colour=red", "/x: credentials=maybe", "/x: origins=example.com"} {
+		_, err := ParseRoute(spec)
+		t.Logf("%q: %v", spec, err)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		url    string
+		driver Driver
+		dsn    string
+	}{
+		{"data/app.db", SQLite, "data/app.db"},
+		{":memory:", SQLite, ":memory:"},
+		{"sqlite://data/app.db", SQLite, "data/app.db"},
+		{"sqlite:///var/lib/todo-api/app.db", SQLite, "/var/lib/todo-api/app.db"},
+		{"postgres://todo:secret@db:5432/todos?sslmode=disable", Postgres, "postgres://todo:secret@db:5432/todos?sslmode=disable"},
+		{"postgresql://db/todos", Postgres, "postgresql://db/todos"},
+		{"mysql://todo:p%40ss@db/todos", MySQL, "todo:p@ss@tcp(db:3306)/todos?clientFoundRows=true&parseTime=true"},
+		{"mysql://todo:secret@db:3307/todos?tls=skip-verify", MySQL, "todo:secret@tcp(db:3307)/todos?clientFoundRows=true&parseTime=true&tls=skip-verify"},
+		{"memory://", Memory, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			src, err := Parse(tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.driver, src.Driver)
+			assert.Equal(t, tt.dsn, src.DSN)
+		})
+	}
+
+	for _, bad := range []string{"oracle://db/todos", "sqlite://", "mysql:///todos", "mysql://db/todos?timeout=soon"} {
+		_, err := Parse(bad)
+		t.Logf("Parse(%q): %v", bad, err)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestSource_DataDir(t *testing.T) {
+	assert.Equal(t, "data", Source{Driver: SQLite, DSN: "data/app.db?_busy_timeout=1"}.DataDir())
+	assert.Equal(t, "data", Source{Driver: SQLite, DSN: "file:data/app.db"}.DataDir())
+	assert.Equal(t, ".", Source{Driver: SQLite, DSN: ":memory:"}.DataDir())
+	assert.Equal(t, ".", Source{Driver: Postgres, DSN: "postgres://db/todos"}.DataDir())
+	assert.Equal(t, ".", Source{Driver: Memory}.DataDir())
+}
+
+func TestOpen_SQLiteCreatesDirectoryAndPool(t *testing.T) {
+	src := Source{Driver: SQLite, DSN: filepath.Join(t.TempDir(), "nested", "app.db")}
+
+	db, err := Open(src, DefaultPool(SQLite), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	require.NoError(t, sqlDB.Ping())
+	assert.Equal(t, 4, sqlDB.Stats().MaxOpenConnections)
+	assert.Equal(t, "sqlite", db.Dialector.Name())
+}
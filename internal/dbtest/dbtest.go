@@ -0,0 +1,205 @@
+// Package dbtest opens migrated databases for tests, on SQLite and on every
+// other dialect available on the machine.
+//
+// Postgres runs when TEST_POSTGRES_URL points at a server, or when initdb and
+// pg_ctl are installed, in which case a throwaway cluster is started. MySQL
+// runs when TEST_MYSQL_URL points at a server. Each test gets its own schema
+// or database, dropped when the test ends.
+package dbtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/drago44/golang-todo-api/internal/database"
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/migrate"
+	"gorm.io/gorm"
+)
+
+// Environment variables naming external test servers.
+const (
+	PostgresURLEnv = "TEST_POSTGRES_URL"
+	MySQLURLEnv    = "TEST_MYSQL_URL"
+)
+
+// SQLite returns a migrated SQLite database stored at path, or in a temporary
+// file when path is empty.
+func SQLite(t testing.TB, path string) *gorm.DB {
+	t.Helper()
+
+	if path == "" {
+		path = filepath.Join(t.TempDir(), "test.db")
+	}
+	return open(t, database.Source{Driver: database.SQLite, DSN: path})
+}
+
+// Each runs fn as a subtest against SQLite and every other available dialect.
+func Each(t *testing.T, fn func(t *testing.T, db *gorm.DB)) {
+	t.Helper()
+
+	t.Run(string(database.SQLite), func(t *testing.T) { fn(t, SQLite(t, "")) })
+	t.Run(string(database.Postgres), func(t *testing.T) { fn(t, Postgres(t)) })
+	t.Run(string(database.MySQL), func(t *testing.T) { fn(t, MySQL(t)) })
+}
+
+// Postgres returns a migrated database in a fresh schema, or skips the test
+// when no Postgres server is available.
+func Postgres(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	base := os.Getenv(PostgresURLEnv)
+	if base == "" {
+		base = startPostgres(t)
+	}
+
+	admin := openRaw(t, database.Source{Driver: database.Postgres, DSN: base})
+	schema := "test_" + randomSuffix()
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", PostgresURLEnv, err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return open(t, database.Source{Driver: database.Postgres, DSN: u.String()})
+}
+
+// MySQL returns a migrated database created for the test, or skips the test
+// when TEST_MYSQL_URL is not set.
+func MySQL(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	base := os.Getenv(MySQLURLEnv)
+	if base == "" {
+		t.Skipf("%s not set", MySQLURLEnv)
+	}
+
+	src, err := database.Parse(base)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", MySQLURLEnv, err)
+	}
+	admin := openRaw(t, src)
+	name := "test_" + randomSuffix()
+	if err := admin.Exec("CREATE DATABASE " + name).Error; err != nil {
+		t.Fatalf("creating database: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP DATABASE " + name) })
+
+	u, err := url.Parse(base)
+	if err != nil {
+		t.Fatalf("parsing %s: %v", MySQLURLEnv, err)
+	}
+	u.Path = "/" + name
+	src, err = database.Parse(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return open(t, src)
+}
+
+// open connects to src and applies every migration.
+func open(t testing.TB, src database.Source) *gorm.DB {
+	t.Helper()
+
+	db := openRaw(t, src)
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := migrate.New(sqlDB, db.Dialector.Name(), logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(context.Background()); err != nil {
+		t.Fatalf("migrating %s test database: %v", src.Driver, err)
+	}
+
+	t.Logf("%s test database created and migrated", src.Driver)
+	return db
+}
+
+func openRaw(t testing.TB, src database.Source) *gorm.DB {
+	t.Helper()
+
+	db, err := database.Open(src, database.DefaultPool(src.Driver), &gorm.Config{
+		// Tests provoke errors on purpose; keep their output readable
+		Logger: logging.NewGormLogger(logging.Discard(), 0),
+	})
+	if err != nil {
+		t.Fatalf("opening %s test database: %v", src.Driver, err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// startPostgres starts a throwaway cluster listening on a unix socket and
+// returns its URL, or skips the test when the server binaries are missing.
+func startPostgres(t testing.TB) string {
+	t.Helper()
+
+	bin := postgresBinDir()
+	if bin == "" {
+		t.Skipf("%s not set and no local postgres installation found", PostgresURLEnv)
+	}
+	if os.Geteuid() == 0 {
+		t.Skipf("%s not set and initdb refuses to run as root", PostgresURLEnv)
+	}
+
+	dir := t.TempDir()
+	data, sock := filepath.Join(dir, "data"), filepath.Join(dir, "sock")
+	if err := os.Mkdir(sock, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(name string, args ...string) {
+		out, err := exec.Command(filepath.Join(bin, name), args...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", name, err, out)
+		}
+	}
+	run("initdb", "-D", data, "-U", "postgres", "--auth=trust", "--no-sync", "-E", "UTF8")
+	run("pg_ctl", "-D", data, "-w", "-l", filepath.Join(dir, "postgres.log"),
+		"-o", fmt.Sprintf("-k %s -c listen_addresses='' -c fsync=off", sock), "start")
+	t.Cleanup(func() {
+		_ = exec.Command(filepath.Join(bin, "pg_ctl"), "-D", data, "-m", "immediate", "stop").Run()
+	})
+
+	return "postgres://postgres@/postgres?host=" + url.QueryEscape(sock) + "&sslmode=disable"
+}
+
+// postgresBinDir finds a directory holding initdb and pg_ctl.
+func postgresBinDir() string {
+	if path, err := exec.LookPath("initdb"); err == nil {
+		return filepath.Dir(path)
+	}
+	dirs, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if _, err := os.Stat(filepath.Join(dirs[i], "initdb")); err == nil {
+			return dirs[i]
+		}
+	}
+	return ""
+}
+
+func randomSuffix() string {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
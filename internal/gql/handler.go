@@ -0,0 +1,157 @@
+package gql
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/drago44/golang-todo-api/internal/todos"
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+// Request describes a GraphQL-over-HTTP request payload.
+type Request struct {
+	Query         string                 `json:"query" form:"query" binding:"required"`
+	OperationName string                 `json:"operationName" form:"operationName"`
+	Variables     map[string]interface{} `json:"variables" form:"-"`
+}
+
+// Handler serves the GraphQL endpoint and the optional GraphiQL page.
+type Handler struct {
+	schema          graphql.Schema
+	limits          Limits
+	graphiQLEnabled bool
+}
+
+// NewHandler creates a GraphQL handler backed by the provided TodoService.
+func NewHandler(svc todos.TodoService, logger *slog.Logger, limits Limits, graphiQLEnabled bool) (*Handler, error) {
+	schema, err := NewSchema(svc, logger.With("component", "graphql"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handler{schema: schema, limits: limits, graphiQLEnabled: graphiQLEnabled}, nil
+}
+
+// RegisterRoutes registers GraphQL routes on the provided router.
+func (h *Handler) RegisterRoutes(r gin.IRoutes) {
+	r.POST("/graphql", h.Serve)
+	r.GET("/graphql", h.Serve)
+
+	if h.graphiQLEnabled {
+		r.GET("/graphiql", h.GraphiQL)
+	}
+}
+
+// Serve handles GET and POST /graphql. Mutations are only accepted over POST.
+func (h *Handler) Serve(c *gin.Context) {
+	req := new(Request)
+	var err error
+	if c.Request.Method == http.MethodGet {
+		err = c.ShouldBindQuery(req)
+		if vars := c.Query("variables"); err == nil && vars != "" {
+			err = json.Unmarshal([]byte(vars), &req.Variables)
+		}
+	} else {
+		err = c.ShouldBindJSON(req)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResult(err))
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	if vr := graphql.ValidateDocument(&h.schema, doc, nil); !vr.IsValid {
+		c.JSON(http.StatusBadRequest, &graphql.Result{Errors: vr.Errors})
+		return
+	}
+
+	if err := checkLimits(doc, req.Variables, h.limits); err != nil {
+		c.JSON(http.StatusBadRequest, errorResult(err))
+		return
+	}
+
+	if c.Request.Method == http.MethodGet && hasMutation(doc, req.OperationName) {
+		c.Header("Allow", "POST")
+		c.JSON(http.StatusMethodNotAllowed, errorResult(errMutationOverGet))
+		return
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       c.Request.Context(),
+	})
+
+	c.JSON(http.StatusOK, result)
+}
+
+var errMutationOverGet = gqlerrors.NewFormattedError("mutations must be sent with POST")
+
+func errorResult(err error) *graphql.Result {
+	return &graphql.Result{Errors: []gqlerrors.FormattedError{gqlerrors.FormatError(err)}}
+}
+
+// hasMutation reports whether the operation selected for execution is a mutation.
+func hasMutation(doc *ast.Document, operationName string) bool {
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName != "" && (op.Name == nil || op.Name.Value != operationName) {
+			continue
+		}
+		if op.Operation == ast.OperationTypeMutation {
+			return true
+		}
+	}
+	return false
+}
+
+// GraphiQL serves an in-browser IDE pointed at /graphql.
+func (h *Handler) GraphiQL(c *gin.Context) {
+	// The page loads GraphiQL from unpkg and boots it with an inline script,
+	// which the API's default Content-Security-Policy blocks
+	if c.Writer.Header().Get("Content-Security-Policy") != "" {
+		c.Header("Content-Security-Policy", graphiQLPolicy)
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(graphiQLPage))
+}
+
+const graphiQLPolicy = "default-src 'self'; script-src 'self' 'unsafe-inline' https://unpkg.com; style-src 'self' 'unsafe-inline' https://unpkg.com; img-src 'self' data:; font-src https://unpkg.com; frame-ancestors 'none'"
+
+const graphiQLPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8" />
+  <title>GraphiQL - Golang Todo API</title>
+  <style>body { margin: 0; height: 100vh; } #graphiql { height: 100vh; }</style>
+  <link rel="stylesheet" href="https://unpkg.com/graphiql@3/graphiql.min.css" />
+</head>
+<body>
+  <div id="graphiql">Loading...</div>
+  <script crossorigin src="https://unpkg.com/react@18/umd/react.production.min.js"></script>
+  <script crossorigin src="https://unpkg.com/react-dom@18/umd/react-dom.production.min.js"></script>
+  <script crossorigin src="https://unpkg.com/graphiql@3/graphiql.min.js"></script>
+  <script>
+    const fetcher = GraphiQL.createFetcher({ url: '/graphql' });
+    ReactDOM.createRoot(document.getElementById('graphiql'))
+      .render(React.createElement(GraphiQL, { fetcher: fetcher }));
+  </script>
+</body>
+</html>`
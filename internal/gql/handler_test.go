@@ -0,0 +1,268 @@
+package gql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/todos"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Mock service for GraphQL resolver tests
+type mockTodoService struct{ mock.Mock }
+
+func (m *mockTodoService) CreateTodo(_ context.Context, req *todos.CreateTodoRequest) (*todos.Todo, error) {
+	args := m.Called(req)
+	if v := args.Get(0); v != nil {
+		return v.(*todos.Todo), args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+func (m *mockTodoService) GetAllTodos(_ context.Context) ([]todos.Todo, error) {
+	args := m.Called()
+	return args.Get(0).([]todos.Todo), args.Error(1)
+}
+
+func (m *mockTodoService) GetTodoByID(_ context.Context, id uint) (*todos.Todo, error) {
+	args := m.Called(id)
+	if v := args.Get(0); v != nil {
+		return v.(*todos.Todo), args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+func (m *mockTodoService) UpdateTodo(_ context.Context, id uint, req *todos.UpdateTodoRequest) (*todos.Todo, error) {
+	args := m.Called(id, req)
+	if v := args.Get(0); v != nil {
+		return v.(*todos.Todo), args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+func (m *mockTodoService) DeleteTodo(_ context.Context, id uint) error { return m.Called(id).Error(0) }
+
+func (m *mockTodoService) ExportTodos(_ context.Context, filter todos.TodoFilter, fn func(todos.Todo) error) error {
+	args := m.Called(filter)
+	for _, todo := range args.Get(0).([]todos.Todo) {
+		if err := fn(todo); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *mockTodoService) ListTodos(_ context.Context, filter todos.TodoFilter, limit, offset int) ([]todos.Todo, int64, error) {
+	args := m.Called(filter, limit, offset)
+	if v := args.Get(0); v != nil {
+		return v.([]todos.Todo), args.Get(1).(int64), args.Error(2)
+	}
+
+	return nil, 0, args.Error(2)
+}
+
+func (m *mockTodoService) ImportTodos(_ context.Context, items []todos.ImportItem, dryRun bool) (*todos.ImportResponse, error) {
+	args := m.Called(items, dryRun)
+	if v := args.Get(0); v != nil {
+		return v.(*todos.ImportResponse), args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+type gqlResponse struct {
+	Data   map[string]json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func setupRouter(t *testing.T, svc todos.TodoService, limits Limits, graphiQL bool) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	h, err := NewHandler(svc, logging.Discard(), limits, graphiQL)
+	require.NoError(t, err)
+
+	r := gin.New()
+	h.RegisterRoutes(r)
+
+	return r
+}
+
+func postQuery(t *testing.T, r http.Handler, query string, vars map[string]interface{}) (*httptest.ResponseRecorder, gqlResponse) {
+	t.Helper()
+
+	b, _ := json.Marshal(Request{Query: query, Variables: vars})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	t.Logf("POST /graphql: status=%d resp=%s", w.Code, w.Body.String())
+
+	var resp gqlResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	return w, resp
+}
+
+func TestGraphQL_TodosWithFilterAndPagination(t *testing.T) {
+	mockSvc := new(mockTodoService)
+	completed := true
+	filter := todos.TodoFilter{Completed: &completed, Search: "buy"}
+	mockSvc.On("ListTodos", filter, 1, 0).Return([]todos.Todo{
+		{ID: 1, Title: "Buy milk", Completed: true},
+	}, int64(2), nil).Once()
+	// Out-of-range arguments are clamped before they reach the service
+	mockSvc.On("ListTodos", todos.TodoFilter{}, maxPageSize, 0).Return([]todos.Todo{}, int64(2), nil).Once()
+	r := setupRouter(t, mockSvc, Limits{}, false)
+
+	w, resp := postQuery(t, r, `query($limit: Int) {
+		todos(filter: {completed: true, search: "buy"}, limit: $limit) {
+			totalCount hasMore items { id title completed }
+		}
+	}`, map[string]interface{}{"limit": 1})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, resp.Errors)
+	assert.JSONEq(t,
+		`{"totalCount":2,"hasMore":true,"items":[{"id":"1","title":"Buy milk","completed":true}]}`,
+		string(resp.Data["todos"]))
+
+	_, resp = postQuery(t, r, `{ todos(limit: 1000, offset: -5) { totalCount hasMore items { id } } }`, nil)
+	assert.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"totalCount":2,"hasMore":true,"items":[]}`, string(resp.Data["todos"]))
+
+	mockSvc.AssertExpectations(t)
+}
+
+func TestGraphQL_TodoNotFoundIsNull(t *testing.T) {
+	mockSvc := new(mockTodoService)
+	mockSvc.On("GetTodoByID", uint(7)).Return(nil, todos.ErrNotFound).Once()
+	r := setupRouter(t, mockSvc, Limits{}, false)
+
+	_, resp := postQuery(t, r, `{ todo(id: "7") { id } }`, nil)
+	assert.Empty(t, resp.Errors)
+	assert.Equal(t, "null", string(resp.Data["todo"]))
+
+	mockSvc.AssertExpectations(t)
+}
+
+func TestGraphQL_ErrorCodes(t *testing.T) {
+	var logs bytes.Buffer
+	mockSvc := new(mockTodoService)
+	mockSvc.On("GetTodoByID", uint(1)).Return(nil, context.DeadlineExceeded).Once()
+	mockSvc.On("GetTodoByID", uint(2)).Return(nil, errors.New("disk I/O error")).Once()
+	gin.SetMode(gin.TestMode)
+	h, err := NewHandler(mockSvc, logging.New(&logs, slog.LevelInfo), Limits{}, false)
+	require.NoError(t, err)
+	r := gin.New()
+	h.RegisterRoutes(r)
+
+	_, resp := postQuery(t, r, `{ todo(id: "1") { id } }`, nil)
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "TIMEOUT", resp.Errors[0].Extensions["code"])
+	assert.Empty(t, logs.String(), "timeouts are not internal errors")
+
+	_, resp = postQuery(t, r, `{ todo(id: "2") { id } }`, nil)
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "INTERNAL", resp.Errors[0].Extensions["code"])
+	assert.Equal(t, "internal error", resp.Errors[0].Message)
+	assert.Contains(t, logs.String(), "disk I/O error")
+	assert.Contains(t, logs.String(), `"component":"graphql"`)
+	t.Logf("logged: %s", logs.String())
+
+	mockSvc.AssertExpectations(t)
+}
+
+func TestGraphQL_Mutations(t *testing.T) {
+	mockSvc := new(mockTodoService)
+	done := true
+	mockSvc.On("CreateTodo", &todos.CreateTodoRequest{Title: "A"}).Return(&todos.Todo{ID: 1, Title: "A"}, nil).Once()
+	mockSvc.On("UpdateTodo", uint(1), &todos.UpdateTodoRequest{Completed: &done}).Return(&todos.Todo{ID: 1, Title: "A", Completed: true}, nil).Once()
+	mockSvc.On("DeleteTodo", uint(1)).Return(nil).Once()
+	mockSvc.On("CreateTodo", &todos.CreateTodoRequest{Title: "Dup"}).Return(nil, todos.ErrTitleExists).Once()
+	r := setupRouter(t, mockSvc, Limits{}, false)
+
+	_, resp := postQuery(t, r, `mutation {
+		created: createTodo(input: {title: "A"}) { id }
+		updated: updateTodo(id: "1", input: {completed: true}) { completed }
+		deleted: deleteTodo(id: "1")
+	}`, nil)
+	assert.Empty(t, resp.Errors)
+	assert.JSONEq(t, `{"id":"1"}`, string(resp.Data["created"]))
+	assert.JSONEq(t, `{"completed":true}`, string(resp.Data["updated"]))
+	assert.Equal(t, "true", string(resp.Data["deleted"]))
+
+	_, resp = postQuery(t, r, `mutation { createTodo(input: {title: "Dup"}) { id } }`, nil)
+	require.Len(t, resp.Errors, 1)
+	assert.Equal(t, "CONFLICT", resp.Errors[0].Extensions["code"])
+
+	mockSvc.AssertExpectations(t)
+}
+
+func TestGraphQL_RejectsMutationOverGet(t *testing.T) {
+	mockSvc := new(mockTodoService)
+	r := setupRouter(t, mockSvc, Limits{}, false)
+
+	q := url.Values{"query": {`mutation { deleteTodo(id: "1") }`}}
+	req := httptest.NewRequest(http.MethodGet, "/graphql?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	t.Logf("GET /graphql (mutation): status=%d resp=%s", w.Code, w.Body.String())
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	mockSvc.AssertNotCalled(t, "DeleteTodo", mock.Anything)
+}
+
+func TestGraphQL_DepthAndComplexityLimits(t *testing.T) {
+	mockSvc := new(mockTodoService)
+	r := setupRouter(t, mockSvc, Limits{MaxDepth: 2, MaxComplexity: 50}, false)
+
+	w, resp := postQuery(t, r, `{ todos { items { id } } }`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	require.Len(t, resp.Errors, 1)
+	assert.Contains(t, resp.Errors[0].Message, "depth")
+
+	r = setupRouter(t, mockSvc, Limits{MaxDepth: 5, MaxComplexity: 50}, false)
+	w, resp = postQuery(t, r, `query Q { ...Page } fragment Page on Query { todos(limit: 100) { items { id title } } }`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	require.Len(t, resp.Errors, 1)
+	assert.Contains(t, resp.Errors[0].Message, "complexity")
+
+	mockSvc.AssertNotCalled(t, "ListTodos")
+}
+
+func TestGraphQL_GraphiQLGatedByFlag(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		r := setupRouter(t, new(mockTodoService), Limits{}, enabled)
+
+		req := httptest.NewRequest(http.MethodGet, "/graphiql", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		t.Logf("GET /graphiql enabled=%v: status=%d", enabled, w.Code)
+
+		if enabled {
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), "graphiql")
+		} else {
+			assert.Equal(t, http.StatusNotFound, w.Code)
+		}
+	}
+}
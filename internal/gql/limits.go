@@ -0,0 +1,110 @@
+package gql
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits bounds the cost of a single GraphQL operation.
+type Limits struct {
+	// MaxDepth is the maximum selection nesting depth; zero disables the check.
+	MaxDepth int
+	// MaxComplexity is the maximum estimated number of resolved fields; zero disables the check.
+	MaxComplexity int
+}
+
+// checkLimits computes depth and complexity of every operation in the
+// document. It must run after validation so fragment cycles are already rejected.
+func checkLimits(doc *ast.Document, vars map[string]interface{}, limits Limits) error {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	for _, def := range doc.Definitions {
+		if frag, ok := def.(*ast.FragmentDefinition); ok {
+			fragments[frag.Name.Value] = frag
+		}
+	}
+
+	a := &analyzer{fragments: fragments, vars: vars}
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		depth, complexity := a.selectionSet(op.SelectionSet, 1)
+		if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+			return fmt.Errorf("query depth %d exceeds maximum of %d", depth, limits.MaxDepth)
+		}
+		if limits.MaxComplexity > 0 && complexity > limits.MaxComplexity {
+			return fmt.Errorf("query complexity %d exceeds maximum of %d", complexity, limits.MaxComplexity)
+		}
+	}
+	return nil
+}
+
+type analyzer struct {
+	fragments map[string]*ast.FragmentDefinition
+	vars      map[string]interface{}
+}
+
+// selectionSet returns the maximum depth and the complexity of a selection set.
+// Each field costs one; the children of paginated fields are multiplied by
+// their page size.
+func (a *analyzer) selectionSet(set *ast.SelectionSet, depth int) (maxDepth, complexity int) {
+	if set == nil {
+		return depth - 1, 0
+	}
+
+	maxDepth = depth
+	for _, sel := range set.Selections {
+		var d, c int
+		switch s := sel.(type) {
+		case *ast.Field:
+			d, c = a.selectionSet(s.SelectionSet, depth+1)
+			c = 1 + c*a.multiplier(s)
+		case *ast.InlineFragment:
+			d, c = a.selectionSet(s.SelectionSet, depth)
+		case *ast.FragmentSpread:
+			if frag, ok := a.fragments[s.Name.Value]; ok {
+				d, c = a.selectionSet(frag.SelectionSet, depth)
+			}
+		}
+		if d > maxDepth {
+			maxDepth = d
+		}
+		complexity += c
+	}
+	return maxDepth, complexity
+}
+
+// multiplier returns how many times a field's children are resolved.
+func (a *analyzer) multiplier(field *ast.Field) int {
+	if field.Name.Value != "todos" {
+		return 1
+	}
+
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "limit" {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil {
+				return clampPageSize(n)
+			}
+		case *ast.Variable:
+			if n, ok := a.vars[v.Name.Value].(float64); ok {
+				return clampPageSize(int(n))
+			}
+		}
+	}
+	return defaultPageSize
+}
+
+func clampPageSize(n int) int {
+	if n <= 0 || n > maxPageSize {
+		return maxPageSize
+	}
+	return n
+}
@@ -0,0 +1,265 @@
+// Package gql exposes the todo domain over GraphQL.
+package gql
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+
+	"github.com/drago44/golang-todo-api/internal/todos"
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// codedError attaches a stable machine-readable code to resolver errors.
+type codedError struct {
+	err  error
+	code string
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+
+func (e *codedError) Unwrap() error { return e.err }
+
+// Extensions implements gqlerrors.ExtendedError.
+func (e *codedError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+// mapError converts domain errors into coded GraphQL errors. Failures caused
+// by an expired or cancelled request context become TIMEOUT or CANCELED, as
+// in the REST API; unexpected errors are logged with the request's context
+// and replaced so database details never reach clients.
+func mapError(ctx context.Context, logger *slog.Logger, err error) error {
+	// Drivers report interrupted queries with their own errors, so the
+	// request context is checked as well as the error chain
+	ctxErr := ctx.Err()
+	switch {
+	case errors.Is(err, todos.ErrNotFound):
+		return &codedError{err: err, code: "NOT_FOUND"}
+	case errors.Is(err, todos.ErrTitleExists):
+		return &codedError{err: err, code: "CONFLICT"}
+	case errors.Is(err, todos.ErrTitleRequired):
+		return &codedError{err: err, code: "BAD_USER_INPUT"}
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctxErr, context.DeadlineExceeded):
+		return &codedError{err: errors.New("request timed out"), code: "TIMEOUT"}
+	case errors.Is(err, context.Canceled) || errors.Is(ctxErr, context.Canceled):
+		return &codedError{err: errors.New("request canceled"), code: "CANCELED"}
+	default:
+		logger.ErrorContext(ctx, "graphql internal error", "error", err.Error())
+		return &codedError{err: errors.New("internal error"), code: "INTERNAL"}
+	}
+}
+
+var todoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Todo",
+	Fields: graphql.Fields{
+		"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+		"title":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"description": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"completed":   &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"createdAt": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.DateTime),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(todos.Todo).CreatedAt, nil
+			},
+		},
+		"updatedAt": &graphql.Field{
+			Type: graphql.NewNonNull(graphql.DateTime),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(todos.Todo).UpdatedAt, nil
+			},
+		},
+	},
+})
+
+var todoPageType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "TodoPage",
+	Fields: graphql.Fields{
+		"items":      &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(todoType)))},
+		"totalCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"hasMore":    &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+	},
+})
+
+var todoFilterType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "TodoFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"completed": &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+		"search": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Case-insensitive substring match on title and description",
+		},
+	},
+})
+
+var createTodoInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "CreateTodoInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"title":       &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"description": &graphql.InputObjectFieldConfig{Type: graphql.String},
+	},
+})
+
+var updateTodoInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "UpdateTodoInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"title":       &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"description": &graphql.InputObjectFieldConfig{Type: graphql.String},
+		"completed":   &graphql.InputObjectFieldConfig{Type: graphql.Boolean},
+	},
+})
+
+// todoPage is the resolved value of the TodoPage type.
+type todoPage struct {
+	Items      []todos.Todo `json:"items"`
+	TotalCount int          `json:"totalCount"`
+	HasMore    bool         `json:"hasMore"`
+}
+
+// NewSchema builds the GraphQL schema delegating to the provided TodoService.
+// Unexpected resolver errors are logged to logger.
+func NewSchema(svc todos.TodoService, logger *slog.Logger) (graphql.Schema, error) {
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"todo": &graphql.Field{
+				Type: todoType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					todo, err := svc.GetTodoByID(p.Context, id)
+					if err != nil {
+						if errors.Is(err, todos.ErrNotFound) {
+							return nil, nil
+						}
+						return nil, mapError(p.Context, logger, err)
+					}
+					return *todo, nil
+				},
+			},
+			"todos": &graphql.Field{
+				Type: graphql.NewNonNull(todoPageType),
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: todoFilterType},
+					"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize},
+					"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					args, _ := p.Args["filter"].(map[string]interface{})
+					limit, _ := p.Args["limit"].(int)
+					offset, _ := p.Args["offset"].(int)
+					if limit <= 0 || limit > maxPageSize {
+						limit = maxPageSize
+					}
+					offset = max(offset, 0)
+
+					items, total, err := svc.ListTodos(p.Context, todoFilter(args), limit, offset)
+					if err != nil {
+						return nil, mapError(p.Context, logger, err)
+					}
+					return todoPage{
+						Items:      items,
+						TotalCount: int(total),
+						HasMore:    int64(offset+len(items)) < total,
+					}, nil
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createTodo": &graphql.Field{
+				Type: graphql.NewNonNull(todoType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createTodoInputType)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					input := p.Args["input"].(map[string]interface{})
+					req := &todos.CreateTodoRequest{}
+					req.Title, _ = input["title"].(string)
+					req.Description, _ = input["description"].(string)
+					todo, err := svc.CreateTodo(p.Context, req)
+					if err != nil {
+						return nil, mapError(p.Context, logger, err)
+					}
+					return *todo, nil
+				},
+			},
+			"updateTodo": &graphql.Field{
+				Type: graphql.NewNonNull(todoType),
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(updateTodoInputType)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					input := p.Args["input"].(map[string]interface{})
+					req := &todos.UpdateTodoRequest{}
+					req.Title, _ = input["title"].(string)
+					req.Description, _ = input["description"].(string)
+					if v, ok := input["completed"].(bool); ok {
+						req.Completed = &v
+					}
+					todo, err := svc.UpdateTodo(p.Context, id, req)
+					if err != nil {
+						return nil, mapError(p.Context, logger, err)
+					}
+					return *todo, nil
+				},
+			},
+			"deleteTodo": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					if err := svc.DeleteTodo(p.Context, id); err != nil {
+						return nil, mapError(p.Context, logger, err)
+					}
+					return true, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+func parseID(v interface{}) (uint, error) {
+	s, _ := v.(string)
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, &codedError{err: errors.New("invalid ID"), code: "BAD_USER_INPUT"}
+	}
+	return uint(id), nil
+}
+
+// todoFilter converts the TodoFilter input object into a repository filter.
+func todoFilter(args map[string]interface{}) todos.TodoFilter {
+	var filter todos.TodoFilter
+	if completed, ok := args["completed"].(bool); ok {
+		filter.Completed = &completed
+	}
+	filter.Search, _ = args["search"].(string)
+	return filter
+}
@@ -0,0 +1,248 @@
+// Package grpcapi exposes the todo domain over gRPC.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/grpcapi/todov1"
+	"github.com/drago44/golang-todo-api/internal/todos"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// watchPollInterval controls how often Watch streams look for new changes.
+const watchPollInterval = time.Second
+
+// Server implements todov1.TodoServiceServer on top of the todos services.
+type Server struct {
+	todov1.UnimplementedTodoServiceServer
+
+	todoService todos.TodoService
+	syncService todos.SyncService
+	grpcServer  *grpc.Server
+	logger      *slog.Logger
+	// closing is closed on shutdown so Watch streams end and GracefulStop can finish
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewServer creates a gRPC server with the TodoService and reflection registered.
+func NewServer(todoService todos.TodoService, syncService todos.SyncService, logger *slog.Logger) *Server {
+	s := &Server{
+		todoService: todoService,
+		syncService: syncService,
+		grpcServer:  grpc.NewServer(),
+		logger:      logger.With("component", "grpc"),
+		closing:     make(chan struct{}),
+	}
+	todov1.RegisterTodoServiceServer(s.grpcServer, s)
+	reflection.Register(s.grpcServer)
+
+	return s
+}
+
+// Serve accepts gRPC connections on the listener until Shutdown is called.
+func (s *Server) Serve(lis net.Listener) error {
+	return s.grpcServer.Serve(lis)
+}
+
+// Shutdown ends Watch streams and stops the server gracefully, forcing a stop
+// if in-flight RPCs do not finish before ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeOnce.Do(func() { close(s.closing) })
+
+	done := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+		return ctx.Err()
+	}
+}
+
+// CreateTodo creates a new todo item.
+func (s *Server) CreateTodo(ctx context.Context, req *todov1.CreateTodoRequest) (*todov1.Todo, error) {
+	todo, err := s.todoService.CreateTodo(ctx, &todos.CreateTodoRequest{
+		Title:       req.GetTitle(),
+		Description: req.GetDescription(),
+	})
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+
+	return toProto(todo), nil
+}
+
+// GetTodo fetches a todo by ID.
+func (s *Server) GetTodo(ctx context.Context, req *todov1.GetTodoRequest) (*todov1.Todo, error) {
+	id, err := toID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	todo, err := s.todoService.GetTodoByID(ctx, id)
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+
+	return toProto(todo), nil
+}
+
+// ListTodos returns all todo items.
+func (s *Server) ListTodos(ctx context.Context, _ *todov1.ListTodosRequest) (*todov1.ListTodosResponse, error) {
+	list, err := s.todoService.GetAllTodos(ctx)
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+
+	resp := &todov1.ListTodosResponse{Todos: make([]*todov1.Todo, 0, len(list))}
+	for i := range list {
+		resp.Todos = append(resp.Todos, toProto(&list[i]))
+	}
+
+	return resp, nil
+}
+
+// UpdateTodo updates the fields present in the request.
+func (s *Server) UpdateTodo(ctx context.Context, req *todov1.UpdateTodoRequest) (*todov1.Todo, error) {
+	id, err := toID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	update := &todos.UpdateTodoRequest{
+		Title:       req.GetTitle(),
+		Description: req.GetDescription(),
+		Completed:   req.Completed,
+	}
+	todo, err := s.todoService.UpdateTodo(ctx, id, update)
+	if err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+
+	return toProto(todo), nil
+}
+
+// DeleteTodo soft-deletes a todo by ID.
+func (s *Server) DeleteTodo(ctx context.Context, req *todov1.DeleteTodoRequest) (*emptypb.Empty, error) {
+	id, err := toID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.todoService.DeleteTodo(ctx, id); err != nil {
+		return nil, s.toStatus(ctx, err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// Watch streams changes after the requested token until the client goes away
+// or the server shuts down.
+func (s *Server) Watch(req *todov1.WatchRequest, stream todov1.TodoService_WatchServer) error {
+	token := req.GetSinceToken()
+	if _, err := todos.ParseChangeToken(token); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain every pending page before waiting for the next tick
+		for {
+			page, err := s.syncService.Changes(stream.Context(), token, 0)
+			if err != nil {
+				return s.toStatus(stream.Context(), err)
+			}
+			for i := range page.Changes {
+				if err := stream.Send(toEvent(&page.Changes[i])); err != nil {
+					return err
+				}
+			}
+			token = page.Token
+			if !page.HasMore {
+				break
+			}
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.closing:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case <-ticker.C:
+		}
+	}
+}
+
+// toStatus maps domain errors to gRPC status codes. Calls cut short by the
+// caller's deadline or cancellation report that, as the client already knows
+// why they ended. Unknown errors are logged and reported as Internal without
+// leaking details to the caller.
+func (s *Server) toStatus(ctx context.Context, err error) error {
+	// Drivers report interrupted queries with their own errors, so the
+	// request context is checked as well as the error chain
+	ctxErr := ctx.Err()
+	switch {
+	case errors.Is(err, todos.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, todos.ErrTitleExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, todos.ErrTitleRequired), errors.Is(err, todos.ErrInvalidSyncToken):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctxErr, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "deadline exceeded")
+	case errors.Is(err, context.Canceled) || errors.Is(ctxErr, context.Canceled):
+		return status.Error(codes.Canceled, "request canceled")
+	default:
+		s.logger.ErrorContext(ctx, "grpc internal error", "error", err.Error())
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func toID(id uint64) (uint, error) {
+	if id == 0 || id > uint64(^uint32(0)) {
+		return 0, status.Error(codes.InvalidArgument, "invalid ID")
+	}
+	return uint(id), nil
+}
+
+func toProto(todo *todos.Todo) *todov1.Todo {
+	return &todov1.Todo{
+		Id:          uint64(todo.ID),
+		Title:       todo.Title,
+		Description: todo.Description,
+		Completed:   todo.Completed,
+		CreatedAt:   timestamppb.New(todo.CreatedAt),
+		UpdatedAt:   timestamppb.New(todo.UpdatedAt),
+	}
+}
+
+func toEvent(todo *todos.Todo) *todov1.TodoEvent {
+	eventType := todov1.TodoEvent_TYPE_UPSERTED
+	if todo.DeletedAt.Valid {
+		eventType = todov1.TodoEvent_TYPE_DELETED
+	}
+
+	return &todov1.TodoEvent{
+		Type:  eventType,
+		Todo:  toProto(todo),
+		Token: todos.FormatChangeToken(todo.ChangeSeq),
+	}
+}
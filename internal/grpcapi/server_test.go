@@ -0,0 +1,166 @@
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/dbtest"
+	"github.com/drago44/golang-todo-api/internal/grpcapi/todov1"
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/todos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func setupClient(t *testing.T) (todov1.TodoServiceClient, *grpc.ClientConn, *Server) {
+	t.Helper()
+
+	db := dbtest.SQLite(t, "")
+
+	repo := todos.NewTodoRepository(db, logging.Discard())
+	srv := NewServer(todos.NewTodoService(repo, logging.Discard()), todos.NewSyncService(repo, logging.Discard()), logging.Discard())
+
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = srv.Serve(lis) }()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	})
+
+	return todov1.NewTodoServiceClient(conn), conn, srv
+}
+
+func TestGRPC_CRUDAndErrorCodes(t *testing.T) {
+	client, _, _ := setupClient(t)
+	ctx := context.Background()
+
+	created, err := client.CreateTodo(ctx, &todov1.CreateTodoRequest{Title: "A", Description: "d"})
+	require.NoError(t, err)
+	assert.NotZero(t, created.GetId())
+	t.Logf("CreateTodo: %v", created)
+
+	_, err = client.CreateTodo(ctx, &todov1.CreateTodoRequest{Title: "A"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = client.CreateTodo(ctx, &todov1.CreateTodoRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	done := true
+	updated, err := client.UpdateTodo(ctx, &todov1.UpdateTodoRequest{Id: created.GetId(), Completed: &done})
+	require.NoError(t, err)
+	assert.True(t, updated.GetCompleted())
+	assert.Equal(t, "d", updated.GetDescription())
+
+	list, err := client.ListTodos(ctx, &todov1.ListTodosRequest{})
+	require.NoError(t, err)
+	assert.Len(t, list.GetTodos(), 1)
+
+	_, err = client.DeleteTodo(ctx, &todov1.DeleteTodoRequest{Id: created.GetId()})
+	require.NoError(t, err)
+
+	_, err = client.GetTodo(ctx, &todov1.GetTodoRequest{Id: created.GetId()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.GetTodo(ctx, &todov1.GetTodoRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPC_WatchStreamsChanges(t *testing.T) {
+	client, _, srv := setupClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	created, err := client.CreateTodo(ctx, &todov1.CreateTodoRequest{Title: "A"})
+	require.NoError(t, err)
+
+	stream, err := client.Watch(ctx, &todov1.WatchRequest{})
+	require.NoError(t, err)
+
+	ev, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, todov1.TodoEvent_TYPE_UPSERTED, ev.GetType())
+	assert.Equal(t, created.GetId(), ev.GetTodo().GetId())
+	t.Logf("Watch event: %v", ev)
+
+	_, err = client.DeleteTodo(ctx, &todov1.DeleteTodoRequest{Id: created.GetId()})
+	require.NoError(t, err)
+
+	ev, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, todov1.TodoEvent_TYPE_DELETED, ev.GetType())
+	assert.NotEmpty(t, ev.GetToken())
+
+	// Shutdown ends open streams instead of waiting for clients to hang up
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	require.NoError(t, srv.Shutdown(shutdownCtx))
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestGRPC_ReflectionRegistered(t *testing.T) {
+	_, conn, _ := setupClient(t)
+
+	stream, err := grpc_reflection_v1.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&grpc_reflection_v1.ServerReflectionRequest{
+		MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_ListServices{},
+	}))
+
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+
+	var names []string
+	for _, svc := range resp.GetListServicesResponse().GetService() {
+		names = append(names, svc.GetName())
+	}
+	t.Logf("reflected services: %v", names)
+	assert.Contains(t, names, "todo.v1.TodoService")
+}
+
+func TestToStatus_ContextErrors(t *testing.T) {
+	var logs bytes.Buffer
+	srv := NewServer(nil, nil, logging.New(&logs, slog.LevelInfo))
+	ctx := context.Background()
+
+	err := srv.toStatus(ctx, fmt.Errorf("query: %w", context.DeadlineExceeded))
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	err = srv.toStatus(ctx, fmt.Errorf("query: %w", context.Canceled))
+	assert.Equal(t, codes.Canceled, status.Code(err))
+
+	// A driver error after the client went away is still a cancellation
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = srv.toStatus(canceled, errors.New("driver: bad connection"))
+	assert.Equal(t, codes.Canceled, status.Code(err))
+	assert.Empty(t, logs.String(), "cancellations and deadlines are not logged")
+
+	err = srv.toStatus(ctx, errors.New("disk I/O error"))
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.NotContains(t, status.Convert(err).Message(), "disk")
+	assert.Contains(t, logs.String(), "disk I/O error")
+	assert.Contains(t, logs.String(), `"component":"grpc"`)
+	t.Logf("logged: %s", logs.String())
+}
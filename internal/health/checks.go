@@ -0,0 +1,29 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DBPing returns a check that pings the database connection pool.
+func DBPing(db *sql.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// DiskSpace returns a check that fails when the filesystem holding dir has
+// less than minFreeBytes available to unprivileged users.
+func DiskSpace(dir string, minFreeBytes uint64) func(ctx context.Context) error {
+	return func(context.Context) error {
+		free, err := freeBytes(dir)
+		if err != nil {
+			return fmt.Errorf("checking free space of %s: %w", dir, err)
+		}
+		if free < minFreeBytes {
+			return fmt.Errorf("only %d MiB free in %s, need %d MiB", free>>20, dir, minFreeBytes>>20)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,218 @@
+// Package health serves liveness and readiness probes backed by a registry of
+// dependency checks.
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Status values reported by probes and individual checks.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// ErrShuttingDown is reported by readiness while the server drains.
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// Check is a named dependency probe. Run must honour ctx cancellation.
+type Check struct {
+	Name string
+	// Timeout bounds Run; zero uses the registry default
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of a single check in a verbose response.
+type CheckResult struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Response is the JSON body of /livez and /readyz.
+type Response struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// Registry holds liveness and readiness checks.
+type Registry struct {
+	timeout time.Duration
+
+	mu        sync.RWMutex
+	liveness  []Check
+	readiness []Check
+
+	shuttingDown atomic.Bool
+}
+
+// NewRegistry creates an empty registry whose checks time out after
+// defaultTimeout unless they set their own.
+func NewRegistry(defaultTimeout time.Duration) *Registry {
+	return &Registry{timeout: defaultTimeout}
+}
+
+// AddLivenessCheck registers a check that restarts the process when failing.
+// Only add checks that cannot be fixed without a restart.
+func (r *Registry) AddLivenessCheck(check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.liveness = append(r.liveness, check)
+}
+
+// AddReadinessCheck registers a check that takes the instance out of load
+// balancing while failing.
+func (r *Registry) AddReadinessCheck(check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.readiness = append(r.readiness, check)
+}
+
+// SetShuttingDown makes readiness fail so load balancers stop routing new
+// requests before the server stops accepting them.
+func (r *Registry) SetShuttingDown() {
+	r.shuttingDown.Store(true)
+}
+
+// RegisterRoutes registers /livez and /readyz on the given router.
+func (r *Registry) RegisterRoutes(routes gin.IRoutes) {
+	routes.GET("/livez", r.Livez)
+	routes.GET("/readyz", r.Readyz)
+}
+
+// Livez handles GET /livez.
+// @Summary Liveness probe
+// @Description Reports whether the process is alive. Add ?verbose for per-check results and ?exclude=<name> to skip checks
+// @Tags health
+// @Produce json
+// @Param verbose query bool false "Include per-check results"
+// @Param exclude query []string false "Names of checks to skip" collectionFormat(multi)
+// @Success 200 {object} Response
+// @Failure 503 {object} Response
+// @Router /livez [get]
+func (r *Registry) Livez(c *gin.Context) {
+	r.mu.RLock()
+	checks := append([]Check(nil), r.liveness...)
+	r.mu.RUnlock()
+
+	r.respond(c, checks, nil)
+}
+
+// Readyz handles GET /readyz.
+// @Summary Readiness probe
+// @Description Reports whether the instance can serve traffic: dependencies are healthy and it is not shutting down
+// @Tags health
+// @Produce json
+// @Param verbose query bool false "Include per-check results"
+// @Param exclude query []string false "Names of checks to skip" collectionFormat(multi)
+// @Success 200 {object} Response
+// @Failure 503 {object} Response
+// @Router /readyz [get]
+func (r *Registry) Readyz(c *gin.Context) {
+	r.mu.RLock()
+	checks := append([]Check(nil), r.readiness...)
+	r.mu.RUnlock()
+
+	var pre []CheckResult
+	if r.shuttingDown.Load() {
+		pre = append(pre, CheckResult{Name: "shutdown", Status: StatusFail, Error: ErrShuttingDown.Error()})
+	}
+
+	r.respond(c, checks, pre)
+}
+
+func (r *Registry) respond(c *gin.Context, checks []Check, pre []CheckResult) {
+	excluded := make(map[string]bool)
+	for _, name := range c.QueryArray("exclude") {
+		excluded[name] = true
+	}
+
+	selected := checks[:0]
+	for _, check := range checks {
+		if !excluded[check.Name] {
+			selected = append(selected, check)
+		}
+	}
+
+	results := append(pre, r.run(c.Request.Context(), selected)...)
+
+	resp := Response{Status: StatusOK}
+	for _, res := range results {
+		if res.Status != StatusOK {
+			resp.Status = StatusFail
+			break
+		}
+	}
+	if _, verbose := c.GetQuery("verbose"); verbose {
+		resp.Checks = results
+	}
+
+	status := http.StatusOK
+	if resp.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	// Probes must always reflect the current state
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, resp)
+}
+
+// run executes checks concurrently, each under its own timeout, and returns
+// results in registration order.
+func (r *Registry) run(ctx context.Context, checks []Check) []CheckResult {
+	results := make([]CheckResult, len(checks))
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = r.runOne(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (r *Registry) runOne(ctx context.Context, check Check) CheckResult {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = r.timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check.Run(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// Report the timeout even if the check ignores its context
+		err = ctx.Err()
+	}
+
+	res := CheckResult{
+		Name:       check.Name,
+		Status:     StatusOK,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
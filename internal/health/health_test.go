@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func probe(t *testing.T, reg *Registry, target string) (int, Response) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	reg.RegisterRoutes(r)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	t.Logf("GET %s: status=%d resp=%s", target, w.Code, w.Body.String())
+
+	var resp Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return w.Code, resp
+}
+
+func ok(context.Context) error { return nil }
+
+func TestReadyz_AllChecksPass(t *testing.T) {
+	reg := NewRegistry(time.Second)
+	reg.AddReadinessCheck(Check{Name: "database", Run: ok})
+	reg.AddReadinessCheck(Check{Name: "disk", Run: ok})
+
+	code, resp := probe(t, reg, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, resp.Status)
+	assert.Empty(t, resp.Checks, "checks are only listed in verbose mode")
+
+	code, resp = probe(t, reg, "/readyz?verbose")
+	assert.Equal(t, http.StatusOK, code)
+	require.Len(t, resp.Checks, 2)
+	assert.Equal(t, "database", resp.Checks[0].Name)
+	assert.Equal(t, "disk", resp.Checks[1].Name)
+}
+
+func TestReadyz_FailingAndExcludedChecks(t *testing.T) {
+	reg := NewRegistry(time.Second)
+	reg.AddReadinessCheck(Check{Name: "database", Run: ok})
+	reg.AddReadinessCheck(Check{Name: "queue", Run: func(context.Context) error { return errors.New("queue backlog too large") }})
+
+	code, resp := probe(t, reg, "/readyz?verbose")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusFail, resp.Status)
+	require.Len(t, resp.Checks, 2)
+	assert.Equal(t, StatusFail, resp.Checks[1].Status)
+	assert.Equal(t, "queue backlog too large", resp.Checks[1].Error)
+
+	code, _ = probe(t, reg, "/readyz?exclude=queue")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestReadyz_PerCheckTimeout(t *testing.T) {
+	reg := NewRegistry(time.Second)
+	reg.AddReadinessCheck(Check{
+		Name:    "stuck",
+		Timeout: 50 * time.Millisecond,
+		// Ignores its context on purpose
+		Run: func(context.Context) error { time.Sleep(time.Second); return nil },
+	})
+
+	start := time.Now()
+	code, resp := probe(t, reg, "/readyz?verbose")
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	require.Len(t, resp.Checks, 1)
+	assert.Equal(t, context.DeadlineExceeded.Error(), resp.Checks[0].Error)
+}
+
+func TestReadyz_FailsDuringShutdownWhileLivezPasses(t *testing.T) {
+	reg := NewRegistry(time.Second)
+	reg.AddReadinessCheck(Check{Name: "database", Run: ok})
+	reg.SetShuttingDown()
+
+	code, resp := probe(t, reg, "/readyz?verbose")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	require.Len(t, resp.Checks, 2)
+	assert.Equal(t, "shutdown", resp.Checks[0].Name)
+
+	code, resp = probe(t, reg, "/livez")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusOK, resp.Status)
+}
+
+func TestDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+
+	assert.NoError(t, DiskSpace(dir, 1)(context.Background()))
+	assert.Error(t, DiskSpace(dir, math.MaxUint64)(context.Background()))
+	assert.Error(t, DiskSpace(dir+"/missing", 1)(context.Background()))
+}
@@ -0,0 +1,141 @@
+// Package ipfilter restricts route groups to client IP ranges with CIDR
+// allow and deny lists, such as admin endpoints reachable only from a VPN.
+package ipfilter
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// CodeAccessDenied is the problem code of a request from a client IP a rule
+// does not admit.
+const CodeAccessDenied = "access_denied"
+
+// Rule restricts the paths under Prefix. A client IP in Deny is refused; so
+// is one outside Allow when Allow is not empty.
+type Rule struct {
+	Prefix string
+	Allow  []netip.Prefix
+	Deny   []netip.Prefix
+}
+
+// ParseRule parses a rule of the form
+//
+//	/metrics: allow=10.8.0.0/16 192.168.1.7; deny=10.8.9.0/24
+//
+// Addresses without a prefix length stand for that single address.
+func ParseRule(spec string) (Rule, error) {
+	prefix, fields, ok := strings.Cut(spec, ":")
+	prefix = strings.TrimSpace(prefix)
+	if !ok || !strings.HasPrefix(prefix, "/") {
+		return Rule{}, fmt.Errorf("%q is not PATH: allow=...; deny=...", spec)
+	}
+
+	rule := Rule{Prefix: strings.TrimSuffix(prefix, "/")}
+	for _, field := range strings.Split(fields, ";") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return Rule{}, fmt.Errorf("rule %s: %q is not allow=... or deny=...", prefix, strings.TrimSpace(field))
+		}
+		var list *[]netip.Prefix
+		switch name = strings.TrimSpace(name); name {
+		case "allow":
+			list = &rule.Allow
+		case "deny":
+			list = &rule.Deny
+		default:
+			return Rule{}, fmt.Errorf("rule %s: unknown field %q (want allow or deny)", prefix, name)
+		}
+		for _, entry := range strings.Fields(value) {
+			p, err := parsePrefix(entry)
+			if err != nil {
+				return Rule{}, fmt.Errorf("rule %s: %w", prefix, err)
+			}
+			*list = append(*list, p)
+		}
+	}
+	if len(rule.Allow) == 0 && len(rule.Deny) == 0 {
+		return Rule{}, fmt.Errorf("rule %s: needs an allow or deny list", prefix)
+	}
+	return rule, nil
+}
+
+func parsePrefix(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		p, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("%q is not a CIDR such as 10.8.0.0/16", entry)
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("%q is not an IP address or CIDR", entry)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// covers reports whether the rule applies to path, matching whole segments.
+func (r Rule) covers(path string) bool {
+	return r.Prefix == "" || path == r.Prefix || strings.HasPrefix(path, r.Prefix+"/")
+}
+
+// admits reports whether addr passes the rule, and if not, why.
+func (r Rule) admits(addr netip.Addr) (bool, string) {
+	for _, p := range r.Deny {
+		if p.Contains(addr) {
+			return false, "denied by " + p.String()
+		}
+	}
+	if len(r.Allow) == 0 {
+		return true, ""
+	}
+	for _, p := range r.Allow {
+		if p.Contains(addr) {
+			return true, ""
+		}
+	}
+	return false, "not in allow list"
+}
+
+// Decision is the outcome of Check.
+type Decision struct {
+	Allowed bool
+	// Rule is the prefix of the rule that refused the request
+	Rule string
+	// Reason explains a refusal
+	Reason string
+}
+
+// Check evaluates the rules covering path for the client IP clientIP. Every
+// covering rule must admit the client, so a rule on / applies everywhere and
+// a rule on /metrics narrows it further. A client IP that cannot be parsed
+// is refused by any covering rule.
+func Check(rules []Rule, path, clientIP string) Decision {
+	addr, err := netip.ParseAddr(clientIP)
+	addr = addr.Unmap()
+	for _, r := range rules {
+		if !r.covers(path) {
+			continue
+		}
+		if err != nil {
+			return Decision{Rule: ruleName(r), Reason: "client IP unknown"}
+		}
+		if ok, reason := r.admits(addr); !ok {
+			return Decision{Rule: ruleName(r), Reason: reason}
+		}
+	}
+	return Decision{Allowed: true}
+}
+
+func ruleName(r Rule) string {
+	if r.Prefix == "" {
+		return "/"
+	}
+	return r.Prefix
+}
@@ -0,0 +1,68 @@
+package ipfilter
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("/metrics/: allow=10.8.0.0/16 192.168.1.7 fd00::/8; deny=10.8.9.1/24")
+	require.NoError(t, err)
+	assert.Equal(t, "/metrics", rule.Prefix)
+	assert.Equal(t, "[10.8.0.0/16 192.168.1.7/32 fd00::/8]", formatPrefixes(rule.Allow))
+	assert.Equal(t, "[10.8.9.0/24]", formatPrefixes(rule.Deny), "host bits are masked")
+
+	for _, spec := range []string{
+		"metrics: allow=10.0.0.0/8",
+		"/metrics",
+		"/metrics: allow=",
+		"/metrics: permit=10.0.0.0/8",
+		"/metrics: allow=10.0.0.0/33",
+		"/metrics: allow=vpn.example.com",
+	} {
+		_, err := ParseRule(spec)
+		t.Logf("%q: %v", spec, err)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	var rules []Rule
+	for _, spec := range []string{
+		"/: deny=203.0.113.0/24",
+		"/metrics: allow=10.8.0.0/16 ::1; deny=10.8.9.0/24",
+	} {
+		rule, err := ParseRule(spec)
+		require.NoError(t, err)
+		rules = append(rules, rule)
+	}
+
+	for _, tc := range []struct {
+		path, ip string
+		allowed  bool
+		reason   string
+	}{
+		{"/api/v1/todos", "198.51.100.7", true, ""},
+		{"/api/v1/todos", "203.0.113.9", false, "denied by 203.0.113.0/24"},
+		{"/metrics", "10.8.1.2", true, ""},
+		{"/metrics", "::ffff:10.8.1.2", true, ""},
+		{"/metrics", "::1", true, ""},
+		{"/metrics/extra", "198.51.100.7", false, "not in allow list"},
+		{"/metrics", "10.8.9.3", false, "denied by 10.8.9.0/24"},
+		{"/metricsx", "198.51.100.7", true, ""},
+		{"/metrics", "", false, "client IP unknown"},
+	} {
+		d := Check(rules, tc.path, tc.ip)
+		t.Logf("%s from %q: %+v", tc.path, tc.ip, d)
+		assert.Equal(t, tc.allowed, d.Allowed, "%s from %s", tc.path, tc.ip)
+		assert.Equal(t, tc.reason, d.Reason, "%s from %s", tc.path, tc.ip)
+	}
+}
+
+func formatPrefixes(prefixes []netip.Prefix) string {
+	return fmt.Sprint(prefixes)
+}
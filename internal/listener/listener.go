@@ -0,0 +1,142 @@
+// Package listener opens the server's listening socket: TCP, a Unix domain
+// socket, or a socket inherited from systemd through socket activation.
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Listen address forms besides an empty spec, which means TCP on the
+// fallback address.
+const (
+	// UnixPrefix starts a Unix socket spec: unix:///run/todo.sock
+	UnixPrefix = "unix://"
+	// Systemd takes the first socket passed by systemd; "systemd:NAME" takes
+	// the one named NAME by FileDescriptorName=
+	Systemd = "systemd"
+)
+
+// firstActivatedFD is SD_LISTEN_FDS_START, the first inherited descriptor.
+const firstActivatedFD = 3
+
+// Validate checks a listen spec without opening anything.
+func Validate(spec string) error {
+	switch {
+	case spec == "", spec == Systemd:
+		return nil
+	case strings.HasPrefix(spec, Systemd+":"):
+		if strings.TrimPrefix(spec, Systemd+":") == "" {
+			return fmt.Errorf("listen %q: missing socket name after systemd:", spec)
+		}
+		return nil
+	case strings.HasPrefix(spec, UnixPrefix):
+		if path := strings.TrimPrefix(spec, UnixPrefix); !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("listen %q: want an absolute path such as unix:///run/todo.sock", spec)
+		}
+		return nil
+	default:
+		return fmt.Errorf("listen %q: want empty, unix:///path, systemd or systemd:NAME", spec)
+	}
+}
+
+// Listen opens the listener described by spec. An empty spec listens on TCP
+// tcpAddr. A Unix socket is created with mode and removed again when the
+// listener is closed.
+func Listen(spec, tcpAddr string, mode os.FileMode) (net.Listener, error) {
+	if err := Validate(spec); err != nil {
+		return nil, err
+	}
+	switch {
+	case spec == "":
+		return net.Listen("tcp", tcpAddr)
+	case strings.HasPrefix(spec, UnixPrefix):
+		return listenUnix(strings.TrimPrefix(spec, UnixPrefix), mode)
+	default:
+		name := strings.TrimPrefix(strings.TrimPrefix(spec, Systemd), ":")
+		return activated(name, os.Getpid(), os.Getenv, os.Unsetenv, firstActivatedFD)
+	}
+}
+
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	// The umask is process-wide, so narrowing it here would race with files
+	// other goroutines create; chmod the socket once it exists instead
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("setting socket permissions: %w", err)
+	}
+	// Closing the listener, as http.Server.Shutdown does, unlinks the file
+	ln.(*net.UnixListener).SetUnlinkOnClose(true)
+	return ln, nil
+}
+
+// removeStaleSocket deletes a socket file left behind by a process that did
+// not shut down cleanly. A socket something still listens on, or a file
+// that is not a socket, is an error rather than being removed.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("listen %s: file exists and is not a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("listen %s: another process is listening on it", path)
+	}
+	return os.Remove(path)
+}
+
+// activated returns the socket systemd passed to this process, named name
+// or the first one when name is empty. The descriptors start at firstFD.
+// Like sd_listen_fds(1), it unsets the LISTEN_* variables either way, so
+// child processes do not take the sockets for their own.
+func activated(name string, pid int, getenv func(string) string, unsetenv func(string) error, firstFD int) (net.Listener, error) {
+	defer func() {
+		for _, key := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+			unsetenv(key)
+		}
+	}()
+
+	if getenv("LISTEN_PID") != strconv.Itoa(pid) {
+		return nil, errors.New("listen systemd: no sockets passed to this process (LISTEN_PID unset or not ours)")
+	}
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, errors.New("listen systemd: LISTEN_FDS names no sockets")
+	}
+	names := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+
+	for i := range count {
+		if name != "" && (i >= len(names) || names[i] != name) {
+			continue
+		}
+		fd := firstFD + i
+		closeOnExec(fd)
+		f := os.NewFile(uintptr(fd), "systemd:"+name)
+		// FileListener dups the descriptor, so the original can be closed
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("listen systemd: descriptor %d: %w", fd, err)
+		}
+		return ln, nil
+	}
+	return nil, fmt.Errorf("listen systemd: no socket named %q in LISTEN_FDNAMES=%q", name, getenv("LISTEN_FDNAMES"))
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package listener
+
+// Systemd socket activation does not apply.
+func closeOnExec(int) {}
@@ -0,0 +1,117 @@
+//go:build unix
+
+package listener
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestValidate(t *testing.T) {
+	for _, spec := range []string{"", "unix:///run/todo.sock", "systemd", "systemd:http"} {
+		assert.NoError(t, Validate(spec), spec)
+	}
+	for _, spec := range []string{"unix://run/todo.sock", "systemd:", "tcp://0.0.0.0:80", "/run/todo.sock"} {
+		err := Validate(spec)
+		t.Logf("%q: %v", spec, err)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestListen_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todo.sock")
+
+	ln, err := Listen(UnixPrefix+path, "", 0o660)
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o660), info.Mode().Perm())
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go func() { _ = srv.Serve(ln) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		Dial: func(string, string) (net.Conn, error) { return net.Dial("unix", path) },
+	}}
+	resp, err := client.Get("http://unix/livez")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// A second server must not steal the socket of a running one
+	_, err = Listen(UnixPrefix+path, "", 0o660)
+	assert.ErrorContains(t, err, "another process is listening")
+
+	require.NoError(t, srv.Close())
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist, "closing removes the socket file")
+}
+
+func TestListen_RemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todo.sock")
+
+	// A crashed process leaves its socket file behind
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	ln, err := Listen(UnixPrefix+path, "", 0o600)
+	require.NoError(t, err)
+	ln.Close()
+
+	require.NoError(t, os.WriteFile(path, []byte("not a socket"), 0o600))
+	_, err = Listen(UnixPrefix+path, "", 0o600)
+	assert.ErrorContains(t, err, "not a socket")
+}
+
+func TestActivated(t *testing.T) {
+	// Stand in for systemd: two listening sockets at consecutive descriptors
+	const firstFD = 100
+	t.Cleanup(func() { unix.Close(firstFD) })
+	var addrs []string
+	for i := range 2 {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		f, err := ln.(*net.TCPListener).File()
+		require.NoError(t, err)
+		require.NoError(t, unix.Dup2(int(f.Fd()), firstFD+i))
+		addrs = append(addrs, ln.Addr().String())
+		f.Close()
+		ln.Close()
+	}
+
+	pid := os.Getpid()
+	env := map[string]string{
+		"LISTEN_PID":     strconv.Itoa(pid),
+		"LISTEN_FDS":     "2",
+		"LISTEN_FDNAMES": "grpc:http",
+	}
+	getenv := func(key string) string { return env[key] }
+	var unset []string
+	unsetenv := func(key string) error {
+		unset = append(unset, key)
+		return nil
+	}
+
+	ln, err := activated("http", pid, getenv, unsetenv, firstFD)
+	require.NoError(t, err)
+	assert.Equal(t, addrs[1], ln.Addr().String())
+	ln.Close()
+	assert.ElementsMatch(t, []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"}, unset, "children must not inherit the sockets' description")
+
+	_, err = activated("admin", pid, getenv, unsetenv, firstFD)
+	assert.ErrorContains(t, err, `no socket named "admin"`)
+	_, err = activated("", pid+1, getenv, unsetenv, firstFD)
+	assert.ErrorContains(t, err, "LISTEN_PID")
+}
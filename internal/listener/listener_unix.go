@@ -0,0 +1,9 @@
+//go:build unix
+
+package listener
+
+import "golang.org/x/sys/unix"
+
+func closeOnExec(fd int) {
+	unix.CloseOnExec(fd)
+}
@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &m), line)
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestNew_AddsRequestIDFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	ctx := WithRequestID(context.Background(), "abc-123")
+	logger.With("component", "test").InfoContext(ctx, "hello", "n", 1)
+	logger.DebugContext(ctx, "filtered out")
+	t.Logf("log output: %s", buf.String())
+
+	lines := decodeLines(t, &buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "hello", lines[0]["msg"])
+	assert.Equal(t, "abc-123", lines[0]["request_id"])
+	assert.Equal(t, "test", lines[0]["component"])
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("debug")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, level)
+
+	level, err = ParseLevel("WARN")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelWarn, level)
+
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestValidRequestID(t *testing.T) {
+	assert.True(t, ValidRequestID("req-123"))
+	assert.False(t, ValidRequestID(""))
+	assert.False(t, ValidRequestID("with space"))
+	assert.False(t, ValidRequestID("line\nbreak"))
+	assert.False(t, ValidRequestID(strings.Repeat("a", maxRequestIDLen+1)))
+	assert.Len(t, NewRequestID(), 32)
+}
+
+func TestGormLogger_OmitsQueryValues(t *testing.T) {
+	gl := NewGormLogger(Discard(), 0)
+
+	filter, ok := gl.(gorm.ParamsFilter)
+	require.True(t, ok, "GORM only consults the filter if the logger implements it")
+	sql, vars := filter.ParamsFilter(context.Background(), "INSERT INTO todos (title) VALUES (?)", "secret plans")
+	// Dialects render statements for Trace through ExplainSQL
+	explained := gormlogger.ExplainSQL(sql, nil, `'`, vars...)
+	t.Logf("explained: %s", explained)
+	assert.Equal(t, "INSERT INTO todos (title) VALUES (?)", explained)
+}
+
+func TestGormLogger_Trace(t *testing.T) {
+	var buf bytes.Buffer
+	gl := NewGormLogger(New(&buf, slog.LevelInfo), 50*time.Millisecond)
+	sql := func() (string, int64) { return "SELECT 1", 1 }
+
+	// Fast successful queries stay below info level
+	gl.Trace(context.Background(), time.Now(), sql, nil)
+	gl.Trace(context.Background(), time.Now().Add(-time.Second), sql, nil)
+	gl.Trace(context.Background(), time.Now(), sql, errors.New("disk I/O error"))
+	t.Logf("log output: %s", buf.String())
+
+	lines := decodeLines(t, &buf)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "slow database query", lines[0]["msg"])
+	assert.Equal(t, "WARN", lines[0]["level"])
+	assert.Equal(t, "SELECT 1", lines[0]["sql"])
+	assert.Equal(t, "database query failed", lines[1]["msg"])
+	assert.Equal(t, "disk I/O error", lines[1]["error"])
+}
@@ -0,0 +1,158 @@
+// Package metrics exposes Prometheus metrics for HTTP traffic, the database
+// connection pool and the todo domain.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/todos"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "todo_api"
+
+// unmatchedRoute labels requests that did not match any route, keeping the
+// route label bounded regardless of what paths clients send.
+const unmatchedRoute = "unmatched"
+
+// collectTimeout bounds the database query behind the domain gauges.
+const collectTimeout = 5 * time.Second
+
+// Metrics owns a dedicated registry and the application's collectors.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests            *prometheus.CounterVec
+	requestDuration     *prometheus.HistogramVec
+	rateLimitRejections prometheus.Counter
+	cacheLookups        *prometheus.CounterVec
+}
+
+// New creates a registry with Go runtime, process and HTTP collectors registered.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests processed, by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency, by method, route template and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		rateLimitRejections: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_rejections_total",
+			Help:      "Requests rejected by the rate limiter.",
+		}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cache_lookups_total",
+			Help:      "Todo cache lookups, by query and result (hit or miss).",
+		}, []string{"query", "result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.rateLimitRejections,
+		m.cacheLookups,
+	)
+
+	return m
+}
+
+// Middleware records request count and latency labelled by route template.
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		m.requests.WithLabelValues(c.Request.Method, route, status).Inc()
+		m.requestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// RateLimitRejected counts a request rejected by the rate limiter.
+func (m *Metrics) RateLimitRejected() {
+	m.rateLimitRejections.Inc()
+}
+
+// CacheLookup counts a todo cache lookup for query.
+func (m *Metrics) CacheLookup(query string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.WithLabelValues(query, result).Inc()
+}
+
+// RegisterDBStats exposes database/sql connection pool statistics.
+func (m *Metrics) RegisterDBStats(db *sql.DB, dbName string) error {
+	return m.registry.Register(collectors.NewDBStatsCollector(db, dbName))
+}
+
+// RegisterTodoCounts exposes the number of open and completed todos, queried
+// from repo on every scrape.
+func (m *Metrics) RegisterTodoCounts(repo todos.TodoRepository, logger *slog.Logger) error {
+	return m.registry.Register(&todoCollector{repo: repo, logger: logger})
+}
+
+// Handler serves the registry in the Prometheus exposition format. A failing
+// collector is logged and skipped instead of failing the whole scrape.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+		Registry:      m.registry,
+	})
+}
+
+var todosDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "todos"),
+	"Number of todos that are not deleted, by status.",
+	[]string{"status"}, nil,
+)
+
+// todoCollector reads domain gauges at scrape time so they are always exact.
+type todoCollector struct {
+	repo   todos.TodoRepository
+	logger *slog.Logger
+}
+
+func (c *todoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- todosDesc
+}
+
+func (c *todoCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	counts, err := c.repo.CountByStatus(ctx)
+	if err != nil {
+		c.logger.ErrorContext(ctx, "collecting todo metrics failed", "error", err.Error())
+		ch <- prometheus.NewInvalidMetric(todosDesc, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(todosDesc, prometheus.GaugeValue, float64(counts.Open), "open")
+	ch <- prometheus.MustNewConstMetric(todosDesc, prometheus.GaugeValue, float64(counts.Completed), "completed")
+}
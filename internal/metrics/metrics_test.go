@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drago44/golang-todo-api/internal/dbtest"
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/todos"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware_LabelsByRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := New()
+
+	r := gin.New()
+	r.Use(m.Middleware())
+	r.GET("/todos/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for _, path := range []string{"/todos/1", "/todos/2", "/nope"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues(http.MethodGet, "/todos/:id", "204")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues(http.MethodGet, unmatchedRoute, "404")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.requestDuration))
+}
+
+func TestHandler_ExposesDomainAndPoolMetrics(t *testing.T) {
+	db := dbtest.SQLite(t, "")
+
+	repo := todos.NewTodoRepository(db, logging.Discard())
+	require.NoError(t, repo.Create(context.Background(), &todos.Todo{Title: "A"}))
+	require.NoError(t, repo.Create(context.Background(), &todos.Todo{Title: "B", Completed: true}))
+	require.NoError(t, repo.Create(context.Background(), &todos.Todo{Title: "C", Completed: true}))
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+
+	m := New()
+	require.NoError(t, m.RegisterDBStats(sqlDB, "app"))
+	require.NoError(t, m.RegisterTodoCounts(repo, logging.Discard()))
+	m.RateLimitRejected()
+	m.CacheLookup(todos.CacheQueryGetAll, true)
+	m.CacheLookup(todos.CacheQueryGetAll, false)
+
+	srv := httptest.NewServer(m.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `todo_api_todos{status="open"} 1`)
+	assert.Contains(t, string(body), `todo_api_todos{status="completed"} 2`)
+	assert.Contains(t, string(body), `todo_api_rate_limit_rejections_total 1`)
+	assert.Contains(t, string(body), `todo_api_cache_lookups_total{query="get_all",result="hit"} 1`)
+	assert.Contains(t, string(body), `go_sql_open_connections{db_name="app"}`)
+}
@@ -0,0 +1,31 @@
+package migrate_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/drago44/golang-todo-api/internal/dbtest"
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/migrate"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// TestRoundTrip_EveryDialect rolls every migration back and reapplies it on
+// each available dialect; dbtest has already migrated up once.
+func TestRoundTrip_EveryDialect(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		ctx := context.Background()
+		sqlDB, err := db.DB()
+		require.NoError(t, err)
+		m, err := migrate.New(sqlDB, db.Dialector.Name(), logging.Discard())
+		require.NoError(t, err)
+
+		require.NoError(t, m.To(ctx, 0))
+		require.False(t, db.Migrator().HasTable("todos"))
+
+		require.NoError(t, m.Up(ctx))
+		require.NoError(t, m.Check(ctx))
+		require.True(t, db.Migrator().HasTable("todos"))
+	})
+}
@@ -0,0 +1,76 @@
+package migrate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrLocked is returned when another migrator holds the lock past LockTimeout.
+var ErrLocked = errors.New("migrations are locked by another process")
+
+const lockPollInterval = 100 * time.Millisecond
+
+// lock takes the single row in schema_migrations_lock. A row is only ever
+// inserted by one process, so the primary key serialises concurrent runs on
+// any database without relying on dialect-specific advisory locks.
+func (m *Migrator) lock(ctx context.Context) (release func(), err error) {
+	owner := lockOwner()
+	deadline := time.Now().Add(m.LockTimeout)
+
+	for {
+		_, err := m.db.ExecContext(ctx,
+			m.rebind("INSERT INTO schema_migrations_lock (id, owner, locked_at) VALUES (1, ?, ?)"),
+			owner, time.Now().Unix())
+		if err == nil {
+			return func() {
+				// Release even when the migration's context was canceled
+				_, _ = m.db.ExecContext(context.WithoutCancel(ctx),
+					m.rebind("DELETE FROM schema_migrations_lock WHERE id = 1 AND owner = ?"), owner)
+			}, nil
+		}
+
+		var holder string
+		var lockedAt int64
+		switch qerr := m.db.QueryRowContext(ctx,
+			"SELECT owner, locked_at FROM schema_migrations_lock WHERE id = 1",
+		).Scan(&holder, &lockedAt); {
+		case errors.Is(qerr, context.Canceled), errors.Is(qerr, context.DeadlineExceeded):
+			return nil, qerr
+		case qerr != nil:
+			// Released between our insert and select, or the insert failed
+			// for another reason; retrying tells the two apart
+			holder = "unknown"
+		case time.Since(time.Unix(lockedAt, 0)) > m.StaleLockAge:
+			m.logger.WarnContext(ctx, "taking over stale migration lock",
+				"holder", holder, "locked_at", time.Unix(lockedAt, 0).UTC())
+			if _, err := m.db.ExecContext(ctx,
+				m.rebind("DELETE FROM schema_migrations_lock WHERE id = 1 AND owner = ? AND locked_at = ?"),
+				holder, lockedAt); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w (holder %s): %v", ErrLocked, holder, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// lockOwner identifies this process in the lock row.
+func lockOwner() string {
+	host, _ := os.Hostname()
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return fmt.Sprintf("%s/%d/%s", host, os.Getpid(), hex.EncodeToString(b[:]))
+}
@@ -0,0 +1,407 @@
+// Package migrate applies the versioned schema migrations embedded in the
+// binary and records them in the schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Errors returned when the schema does not match the binary.
+var (
+	// ErrSchemaTooNew means the database was migrated by a newer binary.
+	ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+	// ErrPending means migrations known to the binary have not been applied.
+	ErrPending = errors.New("database schema has pending migrations")
+	// ErrUnknownVersion means a target version has no migration.
+	ErrUnknownVersion = errors.New("unknown migration version")
+)
+
+// Migration is a single schema change. Up and Down run inside a transaction
+// together with the bookkeeping in schema_migrations.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, tx *sql.Tx) error
+	Down    func(ctx context.Context, tx *sql.Tx) error
+}
+
+// Status describes a migration and whether it has been applied.
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Unknown marks versions recorded in the database but not in this binary
+	Unknown bool
+}
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	logger     *slog.Logger
+	migrations []Migration
+	// tablesReady skips the bookkeeping DDL once it has run, keeping Check
+	// read-only for readiness probes
+	tablesReady atomic.Bool
+
+	// LockTimeout bounds how long to wait for another migrator to finish
+	LockTimeout time.Duration
+	// StaleLockAge is the age after which a lock left by a crashed process is taken over
+	StaleLockAge time.Duration
+}
+
+// New returns a migrator for the migrations embedded in the binary for
+// dialect, one of "sqlite", "postgres" or "mysql" as in gorm.Dialector.Name.
+func New(db *sql.DB, dialect string, logger *slog.Logger) (*Migrator, error) {
+	migrations, err := load(sqlFiles, path.Join("sql", dialect), goMigrations[dialect])
+	if err != nil {
+		return nil, fmt.Errorf("loading %s migrations: %w", dialect, err)
+	}
+	return &Migrator{
+		db:           db,
+		dialect:      dialect,
+		logger:       logger,
+		migrations:   migrations,
+		LockTimeout:  time.Minute,
+		StaleLockAge: 15 * time.Minute,
+	}, nil
+}
+
+// load reads <version>_<name>.up.sql / .down.sql pairs from dir, merges them
+// with extra and returns them ordered by version.
+func load(fsys fs.FS, dir string, extra []Migration) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		if !ok || !strings.HasSuffix(file, ".sql") || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: want <version>_<name>.up.sql or .down.sql", file)
+		}
+		num, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version", file)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = execScript(string(body))
+		} else {
+			m.Down = execScript(string(body))
+		}
+	}
+
+	for _, m := range extra {
+		if _, dup := byVersion[m.Version]; dup {
+			return nil, fmt.Errorf("migration %d is defined twice", m.Version)
+		}
+		byVersion[m.Version] = &m
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == nil || m.Down == nil {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be contiguous from 1: missing %d", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// execScript runs a SQL script statement by statement, since not every
+// driver accepts several statements in one call. Statements end with a
+// semicolon at the end of a line.
+func execScript(script string) func(ctx context.Context, tx *sql.Tx) error {
+	var stmts []string
+	var stmt strings.Builder
+	for _, line := range strings.SplitAfter(script, "\n") {
+		stmt.WriteString(line)
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			stmts = append(stmts, stmt.String())
+			stmt.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(stmt.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+
+	return func(ctx context.Context, tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// rebind rewrites ? placeholders into the dialect's form.
+func (m *Migrator) rebind(query string) string {
+	if m.dialect != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Latest returns the highest version known to the binary.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the highest applied version, 0 for an empty database.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	if err := m.ensureTables(ctx); err != nil {
+		return 0, err
+	}
+	return m.version(ctx)
+}
+
+func (m *Migrator) version(ctx context.Context) (int, error) {
+	var version int
+	err := m.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// Check reports whether the schema matches the binary exactly. It returns
+// ErrSchemaTooNew or ErrPending otherwise.
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	switch latest := m.Latest(); {
+	case version > latest:
+		return fmt.Errorf("%w: database is at version %d, binary knows up to %d", ErrSchemaTooNew, version, latest)
+	case version < latest:
+		return fmt.Errorf("%w: database is at version %d, binary expects %d", ErrPending, version, latest)
+	}
+	return nil
+}
+
+// Status lists every known migration plus any applied version the binary
+// does not know, ordered by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.ensureTables(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]Status)
+	for rows.Next() {
+		var s Status
+		if err := rows.Scan(&s.Version, &s.Name, &s.AppliedAt); err != nil {
+			return nil, err
+		}
+		s.Applied = true
+		applied[s.Version] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s, ok := applied[mig.Version]
+		if !ok {
+			s = Status{Version: mig.Version, Name: mig.Name}
+		}
+		delete(applied, mig.Version)
+		statuses = append(statuses, s)
+	}
+	for _, s := range applied {
+		s.Unknown = true
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the most recently applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(current int) error {
+		if current == 0 {
+			return nil
+		}
+		return m.migrate(ctx, current, current-1)
+	})
+}
+
+// To migrates up or down until the schema is at version. Version 0 rolls
+// back every migration.
+func (m *Migrator) To(ctx context.Context, version int) error {
+	if version < 0 || version > m.Latest() {
+		return fmt.Errorf("%w: %d (known versions: 0-%d)", ErrUnknownVersion, version, m.Latest())
+	}
+	return m.withLock(ctx, func(current int) error {
+		return m.migrate(ctx, current, version)
+	})
+}
+
+// withLock holds the migration lock while fn runs. fn receives the current
+// version; a schema newer than the binary is rejected before fn is called.
+func (m *Migrator) withLock(ctx context.Context, fn func(current int) error) error {
+	if err := m.ensureTables(ctx); err != nil {
+		return err
+	}
+
+	release, err := m.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	current, err := m.version(ctx)
+	if err != nil {
+		return err
+	}
+	if current > m.Latest() {
+		return fmt.Errorf("%w: database is at version %d, binary knows up to %d", ErrSchemaTooNew, current, m.Latest())
+	}
+	return fn(current)
+}
+
+// migrate steps one migration at a time from current to target.
+func (m *Migrator) migrate(ctx context.Context, current, target int) error {
+	for current < target {
+		mig := m.migrations[current]
+		if err := m.apply(ctx, mig, true); err != nil {
+			return err
+		}
+		current++
+	}
+	for current > target {
+		mig := m.migrations[current-1]
+		if err := m.apply(ctx, mig, false); err != nil {
+			return err
+		}
+		current--
+	}
+	return nil
+}
+
+func (m *Migrator) apply(ctx context.Context, mig Migration, up bool) (err error) {
+	direction, run := "up", mig.Up
+	if !up {
+		direction, run = "down", mig.Down
+	}
+	start := time.Now()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+			err = fmt.Errorf("migration %d_%s %s: %w", mig.Version, mig.Name, direction, err)
+		}
+	}()
+
+	if err = run(ctx, tx); err != nil {
+		return err
+	}
+	if up {
+		_, err = tx.ExecContext(ctx,
+			m.rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+			mig.Version, mig.Name, time.Now().UTC())
+	} else {
+		_, err = tx.ExecContext(ctx, m.rebind("DELETE FROM schema_migrations WHERE version = ?"), mig.Version)
+	}
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	m.logger.InfoContext(ctx, "migration applied",
+		"version", mig.Version,
+		"name", mig.Name,
+		"direction", direction,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	return nil
+}
+
+func (m *Migrator) ensureTables(ctx context.Context) error {
+	if m.tablesReady.Load() {
+		return nil
+	}
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version integer PRIMARY KEY,
+			name varchar(255) NOT NULL,
+			applied_at timestamp NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+			id integer PRIMARY KEY CHECK (id = 1),
+			owner varchar(255) NOT NULL,
+			locked_at bigint NOT NULL
+		)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := m.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("creating migration tables: %w", err)
+		}
+	}
+	m.tablesReady.Store(true)
+	return nil
+}
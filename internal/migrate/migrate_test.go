@@ -0,0 +1,233 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/todos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_journal_mode=WAL")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func newTestMigrator(t *testing.T, db *sql.DB) *Migrator {
+	t.Helper()
+
+	m, err := New(db, "sqlite", logging.Discard())
+	require.NoError(t, err)
+	return m
+}
+
+// schemaOf describes tables, columns and indexes so two databases can be compared.
+func schemaOf(t *testing.T, db *sql.DB) map[string][]string {
+	t.Helper()
+
+	schema := make(map[string][]string)
+	rows, err := db.Query("SELECT name, type, tbl_name FROM sqlite_master WHERE name NOT LIKE 'sqlite_%' AND name NOT LIKE 'schema_migrations%' ORDER BY name")
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var name, typ, table string
+		require.NoError(t, rows.Scan(&name, &typ, &table))
+		schema[table] = append(schema[table], typ+":"+name)
+	}
+	require.NoError(t, rows.Err())
+
+	for table := range schema {
+		cols, err := db.Query("SELECT name, type, \"notnull\", COALESCE(dflt_value, ''), pk FROM pragma_table_info(?) ORDER BY cid", table)
+		require.NoError(t, err)
+		for cols.Next() {
+			var name, typ, dflt string
+			var notNull, pk int
+			require.NoError(t, cols.Scan(&name, &typ, &notNull, &dflt, &pk))
+			schema[table] = append(schema[table], fmt.Sprintf("%s %s notnull=%d pk=%d default=%s", name, typ, notNull, pk, dflt))
+		}
+		require.NoError(t, cols.Close())
+	}
+	return schema
+}
+
+func TestUp_MatchesEntitySchema(t *testing.T) {
+	dir := t.TempDir()
+
+	migrated := openTestDB(t, filepath.Join(dir, "migrated.db"))
+	m := newTestMigrator(t, migrated)
+	require.NoError(t, m.Up(context.Background()))
+
+	gdb, err := gorm.Open(sqlite.Open(filepath.Join(dir, "auto.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&todos.Todo{}))
+	auto, err := gdb.DB()
+	require.NoError(t, err)
+
+	want := schemaOf(t, auto)["todos"]
+	t.Logf("entity schema: %v", want)
+	assert.Equal(t, want, schemaOf(t, migrated)["todos"],
+		"migrations and the todos.Todo entity have drifted apart")
+	assert.NoError(t, m.Check(context.Background()))
+}
+
+func TestUp_AdoptsAutoMigratedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+
+	// A database from before versioned migrations, with rows predating delta sync
+	gdb, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, gdb.AutoMigrate(&todos.Todo{}))
+	require.NoError(t, gdb.Exec("INSERT INTO todos (title, created_at, updated_at) VALUES ('a', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP), ('b', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)").Error)
+
+	db := openTestDB(t, path)
+	m := newTestMigrator(t, db)
+	require.NoError(t, m.Up(context.Background()))
+
+	version, err := m.Version(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, m.Latest(), version)
+
+	var unsynced int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM todos WHERE change_seq = 0").Scan(&unsynced))
+	assert.Zero(t, unsynced, "existing rows must be backfilled with change tokens")
+}
+
+func TestDownAndTo(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t, filepath.Join(t.TempDir(), "app.db"))
+	m := newTestMigrator(t, db)
+	require.NoError(t, m.Up(ctx))
+
+	require.NoError(t, m.Down(ctx))
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, m.Latest()-1, version)
+	assert.ErrorIs(t, m.Check(ctx), ErrPending)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, m.Latest())
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[len(statuses)-1].Applied)
+	t.Logf("status after down: %+v", statuses)
+
+	require.NoError(t, m.To(ctx, 0))
+	var tables int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'todos'").Scan(&tables))
+	assert.Zero(t, tables)
+
+	require.NoError(t, m.To(ctx, m.Latest()))
+	assert.NoError(t, m.Check(ctx))
+	assert.ErrorIs(t, m.To(ctx, m.Latest()+1), ErrUnknownVersion)
+}
+
+func TestSchemaTooNew(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t, filepath.Join(t.TempDir(), "app.db"))
+	m := newTestMigrator(t, db)
+	require.NoError(t, m.Up(ctx))
+
+	// Simulate a newer binary having migrated the database
+	_, err := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'from_the_future', ?)", m.Latest()+1, time.Now())
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, m.Check(ctx), ErrSchemaTooNew)
+	assert.ErrorIs(t, m.Up(ctx), ErrSchemaTooNew)
+	assert.ErrorIs(t, m.Down(ctx), ErrSchemaTooNew)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	last := statuses[len(statuses)-1]
+	assert.True(t, last.Unknown)
+	assert.Equal(t, "from_the_future", last.Name)
+}
+
+func TestUp_ConcurrentRunsApplyOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.db")
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		m := newTestMigrator(t, openTestDB(t, path))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = m.Up(context.Background())
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+
+	db := openTestDB(t, path)
+	var applied int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied))
+	assert.Equal(t, newTestMigrator(t, db).Latest(), applied)
+}
+
+func TestLock_TimesOutAndTakesOverStaleLocks(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t, filepath.Join(t.TempDir(), "app.db"))
+	m := newTestMigrator(t, db)
+	m.LockTimeout = 200 * time.Millisecond
+	require.NoError(t, m.ensureTables(ctx))
+
+	_, err := db.Exec("INSERT INTO schema_migrations_lock (id, owner, locked_at) VALUES (1, 'other-host/42/abcd', ?)", time.Now().Unix())
+	require.NoError(t, err)
+
+	err = m.Up(ctx)
+	t.Logf("up while locked: %v", err)
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.Contains(t, err.Error(), "other-host/42/abcd")
+
+	// The same lock is abandoned once it is older than StaleLockAge
+	_, err = db.Exec("UPDATE schema_migrations_lock SET locked_at = ?", time.Now().Add(-time.Hour).Unix())
+	require.NoError(t, err)
+	require.NoError(t, m.Up(ctx))
+
+	var held int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM schema_migrations_lock").Scan(&held))
+	assert.Zero(t, held, "lock must be released after migrating")
+}
+
+func TestLoad_Validation(t *testing.T) {
+	up := &fstest.MapFile{Data: []byte("SELECT 1;")}
+
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+	}{
+		{"missing down", fstest.MapFS{"m/0001_a.up.sql": up}},
+		{"gap", fstest.MapFS{"m/0001_a.up.sql": up, "m/0001_a.down.sql": up, "m/0003_c.up.sql": up, "m/0003_c.down.sql": up}},
+		{"bad name", fstest.MapFS{"m/first.up.sql": up}},
+		{"conflicting names", fstest.MapFS{"m/0001_a.up.sql": up, "m/0001_b.down.sql": up}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(tt.files, "m", nil)
+			t.Logf("load: %v", err)
+			assert.Error(t, err)
+		})
+	}
+
+	migrations, err := load(fstest.MapFS{"m/0001_a.up.sql": up, "m/0001_a.down.sql": up}, "m", nil)
+	require.NoError(t, err)
+	require.Len(t, migrations, 1)
+	assert.Equal(t, "a", migrations[0].Name)
+}
@@ -0,0 +1,80 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+)
+
+// Every dialect has the same versions under sql/<dialect>, as SQL files or
+// Go migrations.
+//
+//go:embed sql
+var sqlFiles embed.FS
+
+// goMigrations holds migrations that need logic SQL alone cannot express, per
+// dialect. Their versions interleave with the embedded SQL files.
+var goMigrations = map[string][]Migration{
+	"sqlite": {
+		{
+			Version: 2,
+			Name:    "add_sync_columns",
+			Up:      addSyncColumnsUp,
+			Down:    addSyncColumnsDown,
+		},
+	},
+}
+
+// addSyncColumnsUp adds the delta sync columns and assigns change tokens to
+// existing rows so that a full sync (since=0) includes them. SQLite databases
+// created by AutoMigrate may already have the columns.
+func addSyncColumnsUp(ctx context.Context, tx *sql.Tx) error {
+	for _, col := range []struct{ name, ddl string }{
+		{"change_seq", "ALTER TABLE `todos` ADD COLUMN `change_seq` integer NOT NULL DEFAULT 0"},
+		{"field_clocks", "ALTER TABLE `todos` ADD COLUMN `field_clocks` text"},
+	} {
+		exists, err := hasColumn(ctx, tx, "todos", col.name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, col.ddl); err != nil {
+			return err
+		}
+	}
+
+	stmts := []string{
+		"CREATE INDEX IF NOT EXISTS `idx_todos_change_seq` ON `todos`(`change_seq`)",
+		"UPDATE todos SET change_seq = (SELECT COALESCE(MAX(change_seq), 0) FROM todos) + id WHERE change_seq = 0",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addSyncColumnsDown(ctx context.Context, tx *sql.Tx) error {
+	stmts := []string{
+		"DROP INDEX IF EXISTS `idx_todos_change_seq`",
+		"ALTER TABLE `todos` DROP COLUMN `field_clocks`",
+		"ALTER TABLE `todos` DROP COLUMN `change_seq`",
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasColumn(ctx context.Context, tx *sql.Tx, table, column string) (bool, error) {
+	var n int
+	err := tx.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column,
+	).Scan(&n)
+	return n > 0, err
+}
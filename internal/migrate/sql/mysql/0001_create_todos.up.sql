@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS todos (
+    id bigint unsigned NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    title text NOT NULL,
+    description text,
+    completed boolean DEFAULT false,
+    created_at datetime(3),
+    updated_at datetime(3),
+    deleted_at datetime(3) NULL,
+    -- MySQL has neither partial indexes nor unique indexes on whole TEXT
+    -- columns: the title hash is NULL once deleted, and NULLs never collide
+    title_not_deleted binary(32) AS (IF(deleted_at IS NULL, UNHEX(SHA2(title, 256)), NULL)) STORED,
+    INDEX idx_todos_deleted_at (deleted_at),
+    UNIQUE INDEX idx_todos_title_not_deleted (title_not_deleted)
+);
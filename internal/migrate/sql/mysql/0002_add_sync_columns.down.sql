@@ -0,0 +1,2 @@
+DROP INDEX idx_todos_change_seq ON todos;
+ALTER TABLE todos DROP COLUMN field_clocks, DROP COLUMN change_seq;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS todos (
+    id bigserial PRIMARY KEY,
+    title text NOT NULL,
+    description text,
+    completed boolean DEFAULT false,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_todos_deleted_at ON todos (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_todos_title_not_deleted ON todos (title) WHERE deleted_at IS NULL;
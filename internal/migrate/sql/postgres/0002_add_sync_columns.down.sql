@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_todos_change_seq;
+ALTER TABLE todos DROP COLUMN field_clocks;
+ALTER TABLE todos DROP COLUMN change_seq;
@@ -0,0 +1,5 @@
+ALTER TABLE todos ADD COLUMN change_seq bigint NOT NULL DEFAULT 0;
+ALTER TABLE todos ADD COLUMN field_clocks text;
+CREATE INDEX idx_todos_change_seq ON todos (change_seq);
+-- Every row starts at 0, so ids are unique change tokens
+UPDATE todos SET change_seq = id WHERE change_seq = 0;
@@ -0,0 +1,6 @@
+-- A single counter row whose lock serialises change token assignment
+CREATE TABLE todo_change_seq (
+    id integer PRIMARY KEY CHECK (id = 1),
+    last_seq bigint NOT NULL
+);
+INSERT INTO todo_change_seq (id, last_seq) SELECT 1, COALESCE(MAX(change_seq), 0) FROM todos;
@@ -0,0 +1,12 @@
+-- IF NOT EXISTS adopts databases created by the former AutoMigrate startup
+CREATE TABLE IF NOT EXISTS `todos` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `title` text NOT NULL,
+    `description` text,
+    `completed` numeric DEFAULT false,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `deleted_at` datetime
+);
+CREATE INDEX IF NOT EXISTS `idx_todos_deleted_at` ON `todos`(`deleted_at`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_todos_title_not_deleted` ON `todos`(`title`) WHERE deleted_at IS NULL;
@@ -0,0 +1,279 @@
+// Package problem renders RFC 9457 problem details (application/problem+json)
+// and maps domain errors to them through a central registry.
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// ContentType is the media type of problem detail responses.
+const ContentType = "application/problem+json"
+
+// typeBase prefixes the stable code to build the problem type URI reference.
+const typeBase = "/problems/"
+
+// Stable machine codes for errors that are not tied to a domain package.
+const (
+	CodeValidationFailed = "validation_failed"
+	CodeMalformedRequest = "malformed_request"
+	CodeInvalidParameter = "invalid_parameter"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodePayloadTooLarge  = "payload_too_large"
+	CodeRateLimited      = "rate_limited"
+	CodeTimeout          = "request_timeout"
+	CodeCanceled         = "request_canceled"
+	CodeInternal         = "internal_error"
+)
+
+// Problem describes an RFC 9457 problem details payload.
+type Problem struct {
+	Type     string `json:"type" example:"/problems/todo_not_found"`
+	Title    string `json:"title" example:"Not Found"`
+	Status   int    `json:"status" example:"404"`
+	Detail   string `json:"detail,omitempty" example:"todo not found"`
+	Instance string `json:"instance,omitempty" example:"/api/v1/todos/42"`
+	// Code is a stable machine-readable error code.
+	Code string `json:"code" example:"todo_not_found"`
+	// Errors lists per-field validation failures.
+	Errors []FieldError `json:"errors,omitempty"`
+	// CorrelationID identifies the server log entry of an internal error.
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// FieldError describes a validation failure of a single request field.
+type FieldError struct {
+	Field   string `json:"field" example:"title"`
+	Message string `json:"message" example:"is required"`
+}
+
+// mapping describes how a registered domain error is rendered.
+type mapping struct {
+	target error
+	status int
+	code   string
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []mapping
+)
+
+// Register maps a domain error (matched with errors.Is) to an HTTP status and
+// a stable code. Domain packages call it once during initialization.
+func Register(target error, status int, code string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry = append(registry, mapping{target: target, status: status, code: code})
+}
+
+func lookup(err error) (mapping, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for _, m := range registry {
+		if errors.Is(err, m.target) {
+			return m, true
+		}
+	}
+	return mapping{}, false
+}
+
+func init() {
+	// Report JSON field names rather than Go struct field names
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return f.Name
+			}
+			return name
+		})
+	}
+}
+
+// New builds a problem with the given status, code and detail.
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   typeBase + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Write renders the problem, filling in the request path as the instance.
+func Write(c *gin.Context, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// Error renders err as a problem. Registered domain errors keep their message;
+// failures caused by an expired or cancelled request context become 504/503;
+// anything else is logged with a correlation ID and hidden from the client.
+func Error(c *gin.Context, err error) {
+	if m, ok := lookup(err); ok {
+		Write(c, New(m.status, m.code, err.Error()))
+		return
+	}
+
+	// Drivers report interrupted queries with their own errors, so the
+	// request context is checked as well as the error chain
+	ctxErr := c.Request.Context().Err()
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctxErr, context.DeadlineExceeded):
+		Timeout(c)
+	case errors.Is(err, context.Canceled) || errors.Is(ctxErr, context.Canceled):
+		Canceled(c)
+	default:
+		Internal(c, err)
+	}
+}
+
+// Timeout renders a 504 problem for a request that exceeded its deadline.
+func Timeout(c *gin.Context) {
+	Write(c, New(http.StatusGatewayTimeout, CodeTimeout, "The request took too long to process."))
+}
+
+// Canceled renders a 503 problem for a request whose context was cancelled,
+// typically because the client disconnected or the server is shutting down.
+func Canceled(c *gin.Context) {
+	Write(c, New(http.StatusServiceUnavailable, CodeCanceled, "The request was cancelled before it completed."))
+}
+
+// Internal logs err with a correlation ID and renders a generic 500 problem.
+func Internal(c *gin.Context, err error) {
+	id := CorrelationID(c)
+	slog.ErrorContext(c.Request.Context(), "internal error",
+		"correlation_id", id,
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"error", err.Error(),
+	)
+
+	p := New(http.StatusInternalServerError, CodeInternal, "An unexpected error occurred.")
+	p.CorrelationID = id
+	Write(c, p)
+}
+
+// BadParameter renders a 400 problem for an invalid path or query parameter.
+func BadParameter(c *gin.Context, name, message string) {
+	p := New(http.StatusBadRequest, CodeInvalidParameter, "Invalid "+name)
+	p.Errors = []FieldError{{Field: name, Message: message}}
+	Write(c, p)
+}
+
+// PayloadTooLarge renders a 413 problem for a request body over limit bytes.
+func PayloadTooLarge(c *gin.Context, limit int64) {
+	Write(c, New(http.StatusRequestEntityTooLarge, CodePayloadTooLarge,
+		"The request body exceeds the limit of "+strconv.FormatInt(limit, 10)+" bytes."))
+}
+
+// BindError renders a 400 problem for a request body gin failed to bind,
+// listing per-field validation errors when available. A body cut off by
+// http.MaxBytesReader renders a 413 instead.
+func BindError(c *gin.Context, err error) {
+	var (
+		verrs    validator.ValidationErrors
+		typeErr  *json.UnmarshalTypeError
+		syntax   *json.SyntaxError
+		tooLarge *http.MaxBytesError
+	)
+
+	switch {
+	case errors.As(err, &tooLarge):
+		PayloadTooLarge(c, tooLarge.Limit)
+	case errors.As(err, &verrs):
+		p := New(http.StatusBadRequest, CodeValidationFailed, "The request body failed validation.")
+		for _, fe := range verrs {
+			p.Errors = append(p.Errors, FieldError{Field: fieldPath(fe), Message: validationMessage(fe)})
+		}
+		Write(c, p)
+	case errors.As(err, &typeErr):
+		p := New(http.StatusBadRequest, CodeValidationFailed, "The request body failed validation.")
+		p.Errors = []FieldError{{Field: typeErr.Field, Message: "must be of type " + typeErr.Type.String()}}
+		Write(c, p)
+	case strings.HasPrefix(err.Error(), unknownFieldPrefix):
+		// encoding/json reports DisallowUnknownFields failures only as text
+		field := strings.Trim(strings.TrimPrefix(err.Error(), unknownFieldPrefix), `"`)
+		p := New(http.StatusBadRequest, CodeValidationFailed, "The request body failed validation.")
+		p.Errors = []FieldError{{Field: field, Message: "is not a known field"}}
+		Write(c, p)
+	case errors.As(err, &syntax), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		Write(c, New(http.StatusBadRequest, CodeMalformedRequest, "The request body is not valid JSON."))
+	default:
+		Write(c, New(http.StatusBadRequest, CodeMalformedRequest, err.Error()))
+	}
+}
+
+// unknownFieldPrefix starts the error of a json.Decoder with
+// DisallowUnknownFields meeting a field the target has no room for.
+const unknownFieldPrefix = "json: unknown field "
+
+// NotFound renders a 404 problem for unknown routes.
+func NotFound(c *gin.Context) {
+	Write(c, New(http.StatusNotFound, CodeNotFound, "The requested resource does not exist."))
+}
+
+// MethodNotAllowed renders a 405 problem for known routes with the wrong method.
+func MethodNotAllowed(c *gin.Context) {
+	Write(c, New(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "The method is not allowed for the requested resource."))
+}
+
+// CorrelationID returns the request ID assigned by the RequestID middleware,
+// falling back to a valid X-Request-ID header or a freshly generated ID.
+func CorrelationID(c *gin.Context) string {
+	if id := logging.RequestID(c.Request.Context()); id != "" {
+		return id
+	}
+	if id := c.GetHeader(logging.RequestIDHeader); logging.ValidRequestID(id) {
+		return id
+	}
+	return logging.NewRequestID()
+}
+
+// fieldPath strips the top-level struct name from the validator namespace.
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.IndexByte(ns, '.'); i >= 0 {
+		return ns[i+1:]
+	}
+	return fe.Field()
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "max":
+		return "must be at most " + fe.Param() + " characters"
+	case "min":
+		return "must be at least " + fe.Param() + " characters"
+	case "oneof":
+		return "must be one of: " + fe.Param()
+	default:
+		return "failed the '" + fe.Tag() + "' validation"
+	}
+}
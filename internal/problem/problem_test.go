@@ -0,0 +1,74 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errWidgetMissing = errors.New("widget missing")
+
+func init() {
+	Register(errWidgetMissing, http.StatusNotFound, "widget_missing")
+}
+
+func serve(t *testing.T, h gin.HandlerFunc) (*httptest.ResponseRecorder, Problem) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/widgets/:id", h)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/widgets/1", nil))
+	t.Logf("GET /widgets/1: status=%d resp=%s", w.Code, w.Body.String())
+
+	var p Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+
+	return w, p
+}
+
+func TestError_RegisteredErrorIsMappedThroughWrapping(t *testing.T) {
+	w, p := serve(t, func(c *gin.Context) {
+		Error(c, fmt.Errorf("loading: %w", errWidgetMissing))
+	})
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "widget_missing", p.Code)
+	assert.Equal(t, "/problems/widget_missing", p.Type)
+	assert.Equal(t, "Not Found", p.Title)
+	assert.Equal(t, "/widgets/1", p.Instance)
+}
+
+func TestError_UnknownErrorIsHidden(t *testing.T) {
+	w, p := serve(t, func(c *gin.Context) {
+		Error(c, errors.New("UNIQUE constraint failed: todos.title"))
+	})
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, CodeInternal, p.Code)
+	assert.NotContains(t, p.Detail, "constraint")
+	assert.NotEmpty(t, p.CorrelationID)
+}
+
+func TestBindError_TypeMismatchListsField(t *testing.T) {
+	_, p := serve(t, func(c *gin.Context) {
+		var body struct {
+			Completed bool `json:"completed"`
+		}
+		BindError(c, json.Unmarshal([]byte(`{"completed":"yes"}`), &body))
+	})
+
+	assert.Equal(t, CodeValidationFailed, p.Code)
+	require.Len(t, p.Errors, 1)
+	assert.Equal(t, "completed", p.Errors[0].Field)
+}
@@ -0,0 +1,181 @@
+// Package ratelimit implements token-bucket rate limiting behind a Store
+// interface, so buckets can live in process or in a shared store.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests per Period on average, and up to Burst requests at
+// once. A zero Burst means Requests.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// ParseLimit parses "requests/period" or "requests/period/burst", such as
+// "100/1m" or "20/1m/5". A period without a number means one unit, so
+// "100/m" is "100/1m".
+func ParseLimit(s string) (Limit, error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) != 2 && len(parts) != 3 {
+		return Limit{}, fmt.Errorf("rate limit %q: want requests/period or requests/period/burst", s)
+	}
+
+	requests, err := strconv.Atoi(parts[0])
+	if err != nil || requests <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: requests must be a positive integer", s)
+	}
+	period := parts[1]
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q: period must be a positive duration", s)
+	}
+	if d < time.Duration(requests) {
+		// Buckets refill one token per period/requests, which must not round to zero
+		return Limit{}, fmt.Errorf("rate limit %q: more than one request per nanosecond", s)
+	}
+
+	limit := Limit{Requests: requests, Period: d}
+	if len(parts) == 3 {
+		limit.Burst, err = strconv.Atoi(parts[2])
+		if err != nil || limit.Burst <= 0 {
+			return Limit{}, fmt.Errorf("rate limit %q: burst must be a positive integer", s)
+		}
+	}
+	return limit, nil
+}
+
+// String formats l so that ParseLimit reads it back.
+func (l Limit) String() string {
+	s := strconv.Itoa(l.Requests) + "/" + l.Period.String()
+	if l.Burst > 0 {
+		s += "/" + strconv.Itoa(l.Burst)
+	}
+	return s
+}
+
+// Capacity is the bucket size.
+func (l Limit) Capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+// interval is the time it takes to refill one token.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// Result describes the bucket after a Take.
+type Result struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left
+	Remaining int
+	// RetryAfter is how long until the next token, when not allowed
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again
+	ResetAfter time.Duration
+}
+
+// Store holds token buckets. Take must refill and charge the bucket for key
+// atomically, so a shared implementation (for example a Redis script) can
+// enforce one limit across instances.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// MemoryStore keeps buckets in process memory.
+type MemoryStore struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	nextSweep time.Time
+}
+
+// bucket is stored as the instant it will be full again, which is all the
+// state a token bucket needs: tokens = capacity - (fullAt - now) / interval.
+type bucket struct {
+	fullAt time.Time
+}
+
+const sweepInterval = time.Minute
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	now := s.now()
+	interval := limit.interval()
+	capacity := time.Duration(limit.Capacity()) * interval
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{fullAt: now}
+		s.buckets[key] = b
+	}
+	// A full bucket holds capacity worth of refill time; anything beyond that
+	// is lost, so start from now at the earliest
+	debt := max(b.fullAt.Sub(now), 0)
+
+	if debt+interval > capacity {
+		return Result{
+			RetryAfter: debt + interval - capacity,
+			ResetAfter: debt,
+		}, nil
+	}
+
+	debt += interval
+	b.fullAt = now.Add(debt)
+	return Result{
+		Allowed:    true,
+		Remaining:  int((capacity - debt) / interval),
+		ResetAfter: debt,
+	}, nil
+}
+
+// sweep drops buckets that have refilled completely; they are identical to
+// the fresh bucket Take would create. Callers must hold s.mu.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Before(s.nextSweep) {
+		return
+	}
+	s.nextSweep = now.Add(sweepInterval)
+	for key, b := range s.buckets {
+		if !b.fullAt.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// Len returns the number of buckets held.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.buckets)
+}
+
+// Seconds rounds d up to whole seconds, as rate limit headers expect.
+func Seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Limit
+	}{
+		{"100/1m", Limit{Requests: 100, Period: time.Minute}},
+		{"100/m", Limit{Requests: 100, Period: time.Minute}},
+		{"20/1m/5", Limit{Requests: 20, Period: time.Minute, Burst: 5}},
+		{" 5/10s ", Limit{Requests: 5, Period: 10 * time.Second}},
+		{"1000/1us", Limit{Requests: 1000, Period: time.Microsecond}},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+
+		again, err := ParseLimit(got.String())
+		require.NoError(t, err)
+		assert.Equal(t, got, again, "String round-trips")
+	}
+
+	for _, bad := range []string{"", "100", "0/1m", "x/1m", "100/soon", "100/-1m", "100/1m/0", "1/2/3/4", "2/1ns", "1001/1us"} {
+		_, err := ParseLimit(bad)
+		t.Logf("ParseLimit(%q): %v", bad, err)
+		assert.Error(t, err, bad)
+	}
+}
+
+func newTestStore() (*MemoryStore, *time.Time) {
+	s := NewMemoryStore()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestMemoryStore_TokenBucket(t *testing.T) {
+	ctx := context.Background()
+	s, now := newTestStore()
+	// One token every 10s, bursts of 3
+	limit := Limit{Requests: 6, Period: time.Minute, Burst: 3}
+
+	for want := 2; want >= 0; want-- {
+		res, err := s.Take(ctx, "k", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, want, res.Remaining)
+	}
+
+	res, err := s.Take(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 10*time.Second, res.RetryAfter)
+	assert.Equal(t, 30*time.Second, res.ResetAfter)
+	t.Logf("rejected: %+v", res)
+
+	// A rejected request costs nothing; one token is back after 10s
+	*now = now.Add(10 * time.Second)
+	res, err = s.Take(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// Other keys have their own bucket
+	res, err = s.Take(ctx, "other", limit)
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Remaining)
+
+	// Idle time never refills beyond the burst
+	*now = now.Add(time.Hour)
+	res, err = s.Take(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Remaining)
+}
+
+func TestMemoryStore_SweepsFullBuckets(t *testing.T) {
+	ctx := context.Background()
+	s, now := newTestStore()
+	limit := Limit{Requests: 60, Period: time.Minute}
+
+	_, err := s.Take(ctx, "a", limit)
+	require.NoError(t, err)
+	_, err = s.Take(ctx, "b", limit)
+	require.NoError(t, err)
+	assert.Equal(t, 2, s.Len())
+
+	*now = now.Add(2 * sweepInterval)
+	_, err = s.Take(ctx, "c", limit)
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.Len(), "refilled buckets are dropped")
+}
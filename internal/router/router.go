@@ -4,24 +4,44 @@ package router
 import (
 	"net/http"
 
+	"github.com/drago44/golang-todo-api/internal/gql"
+	"github.com/drago44/golang-todo-api/internal/health"
+	"github.com/drago44/golang-todo-api/internal/problem"
+	"github.com/drago44/golang-todo-api/internal/session"
 	"github.com/drago44/golang-todo-api/internal/todos"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
+// StreamingRoutes are the routes whose responses stream for as long as the
+// client keeps reading, such as exports. The request timeout must not apply
+// to them.
+var StreamingRoutes = []string{"/api/v1/todos/export"}
+
 // Router contains the Gin engine and handlers configuration.
 type Router struct {
 	engine         *gin.Engine
 	todoHandler    *todos.TodoHandler
+	syncHandler    *todos.SyncHandler
+	graphqlHandler *gql.Handler
+	metricsHandler http.Handler
+	sessionHandler *session.Handler
+	health         *health.Registry
 	swaggerEnabled bool
 }
 
-// New creates a new Router and sets up routes.
-func New(engine *gin.Engine, todoHandler *todos.TodoHandler, swaggerEnabled bool) *Router {
+// New creates a new Router and sets up routes. A nil metricsHandler leaves
+// /metrics unregistered, and a nil sessionHandler /api/v1/session.
+func New(engine *gin.Engine, todoHandler *todos.TodoHandler, syncHandler *todos.SyncHandler, graphqlHandler *gql.Handler, metricsHandler http.Handler, sessionHandler *session.Handler, healthRegistry *health.Registry, swaggerEnabled bool) *Router {
 	r := &Router{
 		engine:         engine,
 		todoHandler:    todoHandler,
+		syncHandler:    syncHandler,
+		graphqlHandler: graphqlHandler,
+		metricsHandler: metricsHandler,
+		sessionHandler: sessionHandler,
+		health:         healthRegistry,
 		swaggerEnabled: swaggerEnabled,
 	}
 	r.setupRoutes()
@@ -30,24 +50,59 @@ func New(engine *gin.Engine, todoHandler *todos.TodoHandler, swaggerEnabled bool
 
 // setupRoutes sets up all routes
 func (r *Router) setupRoutes() {
+	// Unknown routes and methods answer with problem details too
+	r.engine.HandleMethodNotAllowed = true
+	r.engine.NoRoute(problem.NotFound)
+	r.engine.NoMethod(problem.MethodNotAllowed)
+
 	// Simple routes
 	r.engine.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "API is running"})
 	})
 
+	// Liveness and readiness probes
+	r.health.RegisterRoutes(r.engine)
+
+	if r.metricsHandler != nil {
+		// Prometheus scrape endpoint
+		r.engine.GET("/metrics", gin.WrapH(r.metricsHandler))
+	}
+
 	if r.swaggerEnabled {
 		// Serve Swagger UI using generated docs package
-		r.engine.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+		r.engine.GET("/swagger/*any", swaggerCSP, ginSwagger.WrapHandler(swaggerFiles.Handler))
 	}
 
+	// GraphQL endpoint (and GraphiQL when enabled)
+	r.graphqlHandler.RegisterRoutes(r.engine)
+
 	// API v1 group
 	v1 := r.engine.Group("/api/v1")
 
 	// Register Todo routes through the injected handler
 	r.todoHandler.RegisterTodoRoutes(v1)
+
+	// Register delta sync routes for offline-first clients
+	r.syncHandler.RegisterSyncRoutes(v1)
+
+	if r.sessionHandler != nil {
+		// Cookie sessions for browser clients
+		r.sessionHandler.RegisterRoutes(v1)
+	}
 }
 
 // GetEngine returns the *gin.Engine for running the server
 func (r *Router) GetEngine() *gin.Engine {
 	return r.engine
 }
+
+// swaggerPolicy lets Swagger UI run its inline bootstrap script and styles,
+// which the API's default Content-Security-Policy blocks.
+const swaggerPolicy = "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'none'"
+
+// swaggerCSP swaps in swaggerPolicy when a Content-Security-Policy is set.
+func swaggerCSP(c *gin.Context) {
+	if c.Writer.Header().Get("Content-Security-Policy") != "" {
+		c.Header("Content-Security-Policy", swaggerPolicy)
+	}
+}
@@ -1,10 +1,15 @@
 package router
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/drago44/golang-todo-api/internal/gql"
+	"github.com/drago44/golang-todo-api/internal/health"
+	"github.com/drago44/golang-todo-api/internal/logging"
 	"github.com/drago44/golang-todo-api/internal/todos"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -14,7 +19,7 @@ import (
 // Mock service to use with real TodoHandler for route wiring
 type mockService struct{ mock.Mock }
 
-func (m *mockService) CreateTodo(req *todos.CreateTodoRequest) (*todos.Todo, error) {
+func (m *mockService) CreateTodo(_ context.Context, req *todos.CreateTodoRequest) (*todos.Todo, error) {
 	args := m.Called(req)
 	if v := args.Get(0); v != nil {
 		return v.(*todos.Todo), args.Error(1)
@@ -23,12 +28,12 @@ func (m *mockService) CreateTodo(req *todos.CreateTodoRequest) (*todos.Todo, err
 	return nil, args.Error(1)
 }
 
-func (m *mockService) GetAllTodos() ([]todos.Todo, error) {
+func (m *mockService) GetAllTodos(_ context.Context) ([]todos.Todo, error) {
 	args := m.Called()
 	return args.Get(0).([]todos.Todo), args.Error(1)
 }
 
-func (m *mockService) GetTodoByID(id uint) (*todos.Todo, error) {
+func (m *mockService) GetTodoByID(_ context.Context, id uint) (*todos.Todo, error) {
 	args := m.Called(id)
 	if v := args.Get(0); v != nil {
 		return v.(*todos.Todo), args.Error(1)
@@ -37,7 +42,7 @@ func (m *mockService) GetTodoByID(id uint) (*todos.Todo, error) {
 	return nil, args.Error(1)
 }
 
-func (m *mockService) UpdateTodo(id uint, req *todos.UpdateTodoRequest) (*todos.Todo, error) {
+func (m *mockService) UpdateTodo(_ context.Context, id uint, req *todos.UpdateTodoRequest) (*todos.Todo, error) {
 	args := m.Called(id, req)
 	if v := args.Get(0); v != nil {
 		return v.(*todos.Todo), args.Error(1)
@@ -45,7 +50,35 @@ func (m *mockService) UpdateTodo(id uint, req *todos.UpdateTodoRequest) (*todos.
 
 	return nil, args.Error(1)
 }
-func (m *mockService) DeleteTodo(id uint) error { return m.Called(id).Error(0) }
+func (m *mockService) DeleteTodo(_ context.Context, id uint) error { return m.Called(id).Error(0) }
+
+func (m *mockService) ExportTodos(_ context.Context, filter todos.TodoFilter, fn func(todos.Todo) error) error {
+	args := m.Called(filter)
+	for _, todo := range args.Get(0).([]todos.Todo) {
+		if err := fn(todo); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *mockService) ListTodos(_ context.Context, filter todos.TodoFilter, limit, offset int) ([]todos.Todo, int64, error) {
+	args := m.Called(filter, limit, offset)
+	if v := args.Get(0); v != nil {
+		return v.([]todos.Todo), args.Get(1).(int64), args.Error(2)
+	}
+
+	return nil, 0, args.Error(2)
+}
+
+func (m *mockService) ImportTodos(_ context.Context, items []todos.ImportItem, dryRun bool) (*todos.ImportResponse, error) {
+	args := m.Called(items, dryRun)
+	if v := args.Get(0); v != nil {
+		return v.(*todos.ImportResponse), args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
 
 func TestRouter_HealthAndTodosRoute(t *testing.T) {
 	gin.SetMode(gin.TestMode)
@@ -56,7 +89,10 @@ func TestRouter_HealthAndTodosRoute(t *testing.T) {
 	mockSvc.On("GetAllTodos").Return([]todos.Todo{}, nil).Once()
 	h := todos.NewTodoHandler(mockSvc)
 
-	r := New(engine, h, false)
+	gh, err := gql.NewHandler(mockSvc, logging.Discard(), gql.Limits{}, false)
+	assert.NoError(t, err)
+
+	r := New(engine, h, todos.NewSyncHandler(nil), gh, nil, nil, health.NewRegistry(time.Second), false)
 
 	// Health
 	req := httptest.NewRequest(http.MethodGet, "/health", nil)
@@ -73,20 +109,54 @@ func TestRouter_HealthAndTodosRoute(t *testing.T) {
 	t.Logf("GET /api/v1/todos status=%d body=%s", w2.Code, w2.Body.String())
 
 	// Ensure routes are registered
-	var hasHealth, hasTodos bool
+	var hasHealth, hasProbes, hasTodos bool
 
 	for _, ri := range r.GetEngine().Routes() {
 		if ri.Path == "/health" && ri.Method == http.MethodGet {
 			hasHealth = true
 		}
 
+		if ri.Path == "/readyz" && ri.Method == http.MethodGet {
+			hasProbes = true
+		}
+
 		if ri.Path == "/api/v1/todos" && ri.Method == http.MethodGet {
 			hasTodos = true
 		}
 	}
 
 	assert.True(t, hasHealth)
+	assert.True(t, hasProbes)
 	assert.True(t, hasTodos)
 
 	mockSvc.AssertExpectations(t)
 }
+
+func TestRouter_MetricsRouteOnlyWhenEnabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	gh, err := gql.NewHandler(new(mockService), logging.Discard(), gql.Limits{}, false)
+	assert.NoError(t, err)
+
+	metricsHandler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("# metrics\n"))
+	})
+
+	for _, tc := range []struct {
+		name    string
+		handler http.Handler
+		want    int
+	}{
+		{"disabled", nil, http.StatusNotFound},
+		{"enabled", metricsHandler, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := New(gin.New(), todos.NewTodoHandler(new(mockService)), todos.NewSyncHandler(nil), gh, tc.handler, nil, health.NewRegistry(time.Second), false)
+
+			w := httptest.NewRecorder()
+			r.GetEngine().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			t.Logf("GET /metrics (%s) status=%d", tc.name, w.Code)
+			assert.Equal(t, tc.want, w.Code)
+		})
+	}
+}
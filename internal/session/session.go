@@ -0,0 +1,234 @@
+// Package session provides cookie sessions for browser clients and the CSRF
+// protection they need. Sessions are stateless: the cookie carries the
+// session ID and expiry, signed with HMAC-SHA256, so any instance sharing the
+// secret accepts it and nothing is stored server side.
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/problem"
+	"github.com/gin-gonic/gin"
+)
+
+// MinSecretLength is the shortest signing secret accepted, in bytes.
+const MinSecretLength = 32
+
+// Stable error codes exposed in problem responses.
+const (
+	CodeSessionRequired  = "session_required"
+	CodeCSRFTokenInvalid = "csrf_token_invalid"
+)
+
+// contextKey stores the request's *Session in the gin context.
+const contextKey = "session"
+
+// Config describes cookie sessions. Sessions are off unless Secret is set.
+type Config struct {
+	// Secret signs session cookies and CSRF tokens; at least MinSecretLength bytes
+	Secret string
+	// TTL is how long a session lasts after it is created
+	TTL time.Duration
+	// CookieName names the session cookie
+	CookieName string
+	// Secure restricts the cookies to HTTPS
+	Secure bool
+}
+
+// Enabled reports whether sessions are configured.
+func (c Config) Enabled() bool {
+	return c.Secret != ""
+}
+
+// Session is an authenticated browser session.
+type Session struct {
+	ID        string    `json:"id" example:"9f1c2a7be04d4c5e8a1f3b6d7e9a0c12"`
+	ExpiresAt time.Time `json:"expires_at" example:"2025-01-02T15:04:05Z"`
+}
+
+// Manager issues and verifies session cookies.
+type Manager struct {
+	cfg Config
+	now func() time.Time
+}
+
+// NewManager returns a Manager signing with cfg.Secret.
+func NewManager(cfg Config) *Manager {
+	return &Manager{cfg: cfg, now: time.Now}
+}
+
+// FromContext returns the session the Middleware found on the request.
+func FromContext(c *gin.Context) (*Session, bool) {
+	s, ok := c.Get(contextKey)
+	if !ok {
+		return nil, false
+	}
+	return s.(*Session), true
+}
+
+// Middleware authenticates requests carrying a valid session cookie. The
+// session is available through FromContext. Invalid or expired cookies are
+// ignored, leaving the request anonymous.
+//
+// Anyone can start a session, so a session is not a user identity: keying
+// per-client limits on it would let a client start a new one for every
+// fresh bucket it wants.
+func (m *Manager) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cookie, err := c.Cookie(m.cfg.CookieName); err == nil {
+			if s, err := m.parse(cookie); err == nil {
+				c.Set(contextKey, s)
+			}
+		}
+		c.Next()
+	}
+}
+
+// Start creates a session and sets its cookie on the response.
+func (m *Manager) Start(c *gin.Context) *Session {
+	s := &Session{ID: randomHex(16), ExpiresAt: m.now().Add(m.cfg.TTL).UTC().Truncate(time.Second)}
+	c.Set(contextKey, s)
+	m.setCookie(c, m.cfg.CookieName, m.encode(s), s.ExpiresAt, true)
+	return s
+}
+
+// End clears the session cookie. The cookie itself stays valid until it
+// expires, as nothing server side records sessions.
+func (m *Manager) End(c *gin.Context) {
+	m.setCookie(c, m.cfg.CookieName, "", time.Unix(0, 0), true)
+}
+
+// encode renders the cookie value: id.expiry.signature
+func (m *Manager) encode(s *Session) string {
+	payload := s.ID + "." + strconv.FormatInt(s.ExpiresAt.Unix(), 10)
+	return payload + "." + m.sign("session", payload)
+}
+
+func (m *Manager) parse(cookie string) (*Session, error) {
+	id, rest, _ := strings.Cut(cookie, ".")
+	expiry, sig, _ := strings.Cut(rest, ".")
+	if !hmac.Equal([]byte(sig), []byte(m.sign("session", id+"."+expiry))) {
+		return nil, errors.New("session cookie signature mismatch")
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{ID: id, ExpiresAt: time.Unix(unix, 0).UTC()}
+	if !m.now().Before(s.ExpiresAt) {
+		return nil, errors.New("session expired")
+	}
+	return s, nil
+}
+
+// sign returns the base64url HMAC of purpose and payload. The purpose keeps a
+// signature made for one kind of value from verifying another.
+func (m *Manager) sign(purpose, payload string) string {
+	mac := hmac.New(sha256.New, []byte(m.cfg.Secret))
+	mac.Write([]byte(purpose + "|" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (m *Manager) setCookie(c *gin.Context, name, value string, expires time.Time, httpOnly bool) {
+	sameSite := http.SameSiteLaxMode
+	if !httpOnly {
+		sameSite = http.SameSiteStrictMode
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   m.cfg.Secure,
+		HttpOnly: httpOnly,
+		SameSite: sameSite,
+	})
+}
+
+// Handler serves the session endpoints.
+type Handler struct {
+	sessions *Manager
+}
+
+// NewHandler creates a Handler for sessions.
+func NewHandler(sessions *Manager) *Handler {
+	return &Handler{sessions: sessions}
+}
+
+// RegisterRoutes registers the session routes under the provided router group.
+func (h *Handler) RegisterRoutes(rg *gin.RouterGroup) {
+	rg.POST("/session", h.Create)
+	rg.GET("/session", h.Get)
+	rg.DELETE("/session", h.Delete)
+}
+
+// Create handles POST /session and starts a browser session.
+// @Summary Start a session
+// @Description Start a cookie session for a browser client. The response sets the session cookie and a CSRF token (cookie and X-CSRF-Token header) to send back on unsafe requests. A request that already has a valid session gets it back unchanged
+// @Tags session
+// @Produce json
+// @Produce application/problem+json
+// @Success 200 {object} Session
+// @Success 201 {object} Session
+// @Failure 403 {object} problem.Problem
+// @Router /session [post]
+func (h *Handler) Create(c *gin.Context) {
+	if s, ok := FromContext(c); ok {
+		// CSRF has checked the request, so its token is valid already
+		if token := c.GetHeader(CSRFHeader); token != "" {
+			c.Header(CSRFHeader, token)
+		}
+		c.JSON(http.StatusOK, s)
+		return
+	}
+	s := h.sessions.Start(c)
+	// A token left over, if any, was bound to an earlier session
+	h.sessions.issueCSRF(c, s.ID)
+	c.JSON(http.StatusCreated, s)
+}
+
+// Get handles GET /session and returns the current session.
+// @Summary Get the current session
+// @Tags session
+// @Produce json
+// @Produce application/problem+json
+// @Success 200 {object} Session
+// @Failure 401 {object} problem.Problem
+// @Router /session [get]
+func (h *Handler) Get(c *gin.Context) {
+	s, ok := FromContext(c)
+	if !ok {
+		problem.Write(c, problem.New(http.StatusUnauthorized, CodeSessionRequired, "No valid session cookie was sent."))
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// Delete handles DELETE /session and clears the session cookie.
+// @Summary End the session
+// @Tags session
+// @Produce application/problem+json
+// @Success 204
+// @Failure 403 {object} problem.Problem
+// @Router /session [delete]
+func (h *Handler) Delete(c *gin.Context) {
+	h.sessions.End(c)
+	c.Status(http.StatusNoContent)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,140 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(m *Manager) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(m.Middleware(), m.CSRF())
+	NewHandler(m).RegisterRoutes(r.Group("/"))
+	r.GET("/todos", func(c *gin.Context) {
+		if s, ok := FromContext(c); ok {
+			c.String(http.StatusOK, s.ID)
+		}
+	})
+	r.POST("/todos", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	return r
+}
+
+func newTestManager() *Manager {
+	return NewManager(Config{Secret: strings.Repeat("s", MinSecretLength), TTL: time.Hour, CookieName: "todo_session"})
+}
+
+// client carries cookies between requests like a browser.
+type client struct {
+	t       *testing.T
+	r       *gin.Engine
+	cookies map[string]*http.Cookie
+}
+
+func (c *client) do(method, path string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for k, values := range header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	c.r.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		c.cookies[cookie.Name] = cookie
+	}
+	c.t.Logf("%s %s: %d %s", method, path, w.Code, w.Body.String())
+	return w
+}
+
+func TestSession_StartAndAuthenticate(t *testing.T) {
+	m := newTestManager()
+	browser := &client{t: t, r: newTestServer(m), cookies: map[string]*http.Cookie{}}
+
+	assert.Equal(t, http.StatusUnauthorized, browser.do(http.MethodGet, "/session", nil).Code)
+
+	w := browser.do(http.MethodPost, "/session", nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	cookie := browser.cookies["todo_session"]
+	require.NotNil(t, cookie)
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+
+	// Starting again keeps the session rather than minting another
+	token := browser.cookies[CSRFCookieName].Value
+	w = browser.do(http.MethodPost, "/session", http.Header{CSRFHeader: {token}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Result().Cookies())
+	assert.Equal(t, token, w.Header().Get(CSRFHeader))
+	assert.Equal(t, cookie, browser.cookies["todo_session"])
+
+	w = browser.do(http.MethodGet, "/todos", nil)
+	id, _, _ := strings.Cut(cookie.Value, ".")
+	assert.Equal(t, id, w.Body.String(), "the session ID identifies the user")
+
+	// A tampered or expired cookie leaves the request anonymous
+	browser.cookies["todo_session"] = &http.Cookie{Name: "todo_session", Value: "other" + strings.TrimPrefix(cookie.Value, id)}
+	assert.Equal(t, http.StatusUnauthorized, browser.do(http.MethodGet, "/session", nil).Code)
+	browser.cookies["todo_session"] = cookie
+	m.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	assert.Equal(t, http.StatusUnauthorized, browser.do(http.MethodGet, "/session", nil).Code)
+}
+
+func TestCSRF(t *testing.T) {
+	m := newTestManager()
+	r := newTestServer(m)
+	browser := &client{t: t, r: r, cookies: map[string]*http.Cookie{}}
+
+	// Anonymous requests have nothing to forge, and get no token
+	w := browser.do(http.MethodGet, "/todos", nil)
+	assert.Empty(t, w.Result().Cookies())
+	assert.Empty(t, w.Header().Get(CSRFHeader))
+	assert.Equal(t, http.StatusCreated, browser.do(http.MethodPost, "/session", nil).Code)
+	token := browser.cookies[CSRFCookieName].Value
+	assert.False(t, browser.cookies[CSRFCookieName].HttpOnly, "scripts must read the token")
+
+	// Cookie-authenticated writes need the token echoed in the header
+	w = browser.do(http.MethodPost, "/todos", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), CodeCSRFTokenInvalid)
+	assert.Equal(t, http.StatusCreated, browser.do(http.MethodPost, "/todos", http.Header{CSRFHeader: {token}}).Code)
+
+	// Safe requests keep a valid token and echo it
+	w = browser.do(http.MethodGet, "/todos", nil)
+	assert.Equal(t, token, w.Header().Get(CSRFHeader))
+	assert.Empty(t, w.Result().Cookies(), "a valid token is not reissued")
+
+	// A token bound to another session does not verify, even when planted in
+	// the cookie as well
+	other := &client{t: t, r: r, cookies: map[string]*http.Cookie{}}
+	other.do(http.MethodPost, "/session", nil)
+	foreign := other.cookies[CSRFCookieName].Value
+	browser.cookies[CSRFCookieName] = &http.Cookie{Name: CSRFCookieName, Value: foreign}
+	assert.Equal(t, http.StatusForbidden, browser.do(http.MethodPost, "/todos", http.Header{CSRFHeader: {foreign}}).Code)
+
+	// A safe request replaces the foreign token with one for this session
+	w = browser.do(http.MethodGet, "/todos", nil)
+	fresh := w.Header().Get(CSRFHeader)
+	assert.NotEqual(t, foreign, fresh)
+	assert.Equal(t, http.StatusNoContent, browser.do(http.MethodDelete, "/session", http.Header{CSRFHeader: {fresh}}).Code)
+
+	// Bearer clients send no session cookie, so they are never checked, but
+	// an Authorization header does not exempt a request that has a session
+	bearer := http.Header{"Authorization": {"Bearer abc"}}
+	script := &client{t: t, r: r, cookies: map[string]*http.Cookie{}}
+	w = script.do(http.MethodPost, "/todos", bearer)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get(CSRFHeader))
+	browser.cookies["todo_session"] = other.cookies["todo_session"]
+	assert.Equal(t, http.StatusForbidden, browser.do(http.MethodPost, "/todos", bearer).Code)
+	assert.Equal(t, http.StatusForbidden, browser.do(http.MethodDelete, "/session", bearer).Code)
+}
@@ -0,0 +1,180 @@
+// Package tlsconfig builds the server's TLS configuration, reloading the
+// certificate when its files change and optionally verifying client
+// certificates against a CA for mutual TLS.
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Client certificate policies for mutual TLS.
+const (
+	// ClientAuthRequire rejects connections without a valid client certificate
+	ClientAuthRequire = "require"
+	// ClientAuthVerifyIfGiven verifies a client certificate when one is sent,
+	// so callers without one (such as health probes) still connect
+	ClientAuthVerifyIfGiven = "verify_if_given"
+)
+
+// Supported minimum protocol versions.
+const (
+	Version12 = "1.2"
+	Version13 = "1.3"
+)
+
+// Config describes TLS termination. TLS is off unless CertFile is set.
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile enables mutual TLS with clients signed by these CAs
+	ClientCAFile string
+	// ClientAuth is ClientAuthRequire or ClientAuthVerifyIfGiven
+	ClientAuth string
+	// MinVersion is Version12 or Version13
+	MinVersion string
+	// ReloadInterval is how often the certificate files are checked for
+	// changes; 0 disables reloading
+	ReloadInterval time.Duration
+}
+
+// Enabled reports whether TLS is configured.
+func (c Config) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// New returns a server TLS configuration serving the certificate of cfg
+// through certs, which the caller should Watch to pick up renewals.
+func New(cfg Config, logger *slog.Logger) (*tls.Config, *CertReloader, error) {
+	certs, err := NewCertReloader(cfg.CertFile, cfg.KeyFile, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+	if cfg.MinVersion == Version13 {
+		tlsCfg.MinVersion = tls.VersionTLS13
+	}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("client CA %s: no PEM certificates found", cfg.ClientCAFile)
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+		if cfg.ClientAuth == ClientAuthVerifyIfGiven {
+			tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return tlsCfg, certs, nil
+}
+
+// CertReloader serves a certificate and key pair from disk, re-reading them
+// when their modification times change. A pair that fails to load is logged
+// and the previous certificate kept, so a half-written renewal does not take
+// the server down.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+
+	cert atomic.Pointer[tls.Certificate]
+
+	mu       sync.Mutex
+	modTimes [2]time.Time
+}
+
+// NewCertReloader loads the pair, failing if it cannot.
+func NewCertReloader(certFile, keyFile string, logger *slog.Logger) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger.With("component", "tls"),
+	}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// Reload re-reads the pair if either file changed since the last load, and
+// reports whether it did.
+func (r *CertReloader) Reload() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTimes := [2]time.Time{modTime(r.certFile), modTime(r.keyFile)}
+	if r.cert.Load() != nil && modTimes == r.modTimes {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	r.cert.Store(&cert)
+	r.modTimes = modTimes
+	return true, nil
+}
+
+// Watch calls Reload every interval until ctx is done. A zero interval
+// returns immediately.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			switch {
+			case err != nil:
+				r.logger.Error("TLS certificate reload failed; keeping the current one", "error", err.Error())
+			case reloaded:
+				r.logger.Info("TLS certificate reloaded", "cert_file", r.certFile, "not_after", r.NotAfter())
+			}
+		}
+	}
+}
+
+// NotAfter returns the expiry of the certificate being served.
+func (r *CertReloader) NotAfter() time.Time {
+	cert := r.cert.Load()
+	if cert == nil || cert.Leaf == nil {
+		return time.Time{}
+	}
+	return cert.Leaf.NotAfter
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
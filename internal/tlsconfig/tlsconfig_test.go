@@ -0,0 +1,174 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a certificate generated for the test, signed by parent or
+// self-signed when parent is nil.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pair tls.Certificate
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCert{cert: cert, key: key, pair: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}}
+}
+
+// write stores the certificate and key as PEM files in dir.
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestCertReloader_ReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	first := newTestCert(t, "first", nil)
+	certFile, keyFile := first.write(t, dir, "server")
+
+	r, err := NewCertReloader(certFile, keyFile, logging.Discard())
+	require.NoError(t, err)
+	served, _ := r.GetCertificate(nil)
+	assert.Equal(t, first.cert.Raw, served.Certificate[0])
+
+	reloaded, err := r.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "unchanged files are not re-read")
+
+	// A renewal is picked up once the files change
+	second := newTestCert(t, "second", nil)
+	second.write(t, dir, "server")
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	reloaded, err = r.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	served, _ = r.GetCertificate(nil)
+	assert.Equal(t, second.cert.Raw, served.Certificate[0])
+	assert.WithinDuration(t, second.cert.NotAfter, r.NotAfter(), 0)
+
+	// A broken renewal keeps the current certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("garbage"), 0o600))
+	_, err = r.Reload()
+	t.Logf("broken renewal: %v", err)
+	assert.Error(t, err)
+	served, _ = r.GetCertificate(nil)
+	assert.Equal(t, second.cert.Raw, served.Certificate[0])
+
+	_, err = NewCertReloader(filepath.Join(dir, "missing.crt"), keyFile, logging.Discard())
+	assert.Error(t, err)
+}
+
+func TestNew_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "internal CA", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := newTestCert(t, "server", ca).write(t, dir, "server")
+	client := newTestCert(t, "caller", ca)
+	stranger := newTestCert(t, "stranger", nil)
+
+	for _, tc := range []struct {
+		clientAuth    string
+		clientCert    *testCert
+		wantConnected bool
+	}{
+		{ClientAuthRequire, client, true},
+		{ClientAuthRequire, nil, false},
+		{ClientAuthRequire, stranger, false},
+		{ClientAuthVerifyIfGiven, nil, true},
+		{ClientAuthVerifyIfGiven, stranger, false},
+	} {
+		tlsCfg, _, err := New(Config{
+			CertFile:     certFile,
+			KeyFile:      keyFile,
+			ClientCAFile: caFile,
+			ClientAuth:   tc.clientAuth,
+			MinVersion:   Version13,
+		}, logging.Discard())
+		require.NoError(t, err)
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		srv := &http.Server{
+			Handler:  http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }),
+			ErrorLog: log.New(io.Discard, "", 0),
+		}
+		go func() { _ = srv.Serve(tls.NewListener(ln, tlsCfg)) }()
+
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.cert)
+		clientTLS := &tls.Config{RootCAs: roots}
+		if tc.clientCert != nil {
+			// Send the certificate even when the server's CA list does not name its issuer
+			pair := tc.clientCert.pair
+			clientTLS.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return &pair, nil }
+		}
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+		resp, err := httpClient.Get("https://" + ln.Addr().String())
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		name := "no client certificate"
+		if tc.clientCert != nil {
+			name = tc.clientCert.cert.Subject.CommonName
+		}
+		t.Logf("%s with %s: err=%v", tc.clientAuth, name, err)
+		if tc.wantConnected {
+			assert.NoError(t, err, "%s with %s", tc.clientAuth, name)
+		} else {
+			assert.Error(t, err, "%s with %s", tc.clientAuth, name)
+		}
+		_ = srv.Close()
+	}
+}
@@ -9,8 +9,9 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/drago44/golang-todo-api/internal/dbtest"
+	"github.com/drago44/golang-todo-api/internal/logging"
 	"github.com/gin-gonic/gin"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -18,17 +19,8 @@ import (
 func BenchmarkCreateAndList(b *testing.B) {
 	gin.SetMode(gin.ReleaseMode)
 
-	file := filepath.Join(b.TempDir(), "bench.db")
-	dsn := file + "?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000&_foreign_keys=ON&_cache_size=-20000"
-
-	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{PrepareStmt: true, SkipDefaultTransaction: true})
-	if err != nil {
-		b.Fatalf("open sqlite: %v", err)
-	}
-
-	if err := db.AutoMigrate(&Todo{}); err != nil {
-		b.Fatalf("migrate: %v", err)
-	}
+	db := dbtest.SQLite(b, filepath.Join(b.TempDir(), "bench.db")).
+		Session(&gorm.Session{PrepareStmt: true, SkipDefaultTransaction: true})
 
 	if sqlDB, err2 := db.DB(); err2 == nil {
 		// Few conns for WAL; it's a single-process benchmark
@@ -36,8 +28,8 @@ func BenchmarkCreateAndList(b *testing.B) {
 		sqlDB.SetMaxIdleConns(2)
 	}
 
-	repo := NewTodoRepository(db)
-	svc := NewTodoService(repo)
+	repo := NewTodoRepository(db, logging.Discard())
+	svc := NewTodoService(repo, logging.Discard())
 	h := NewTodoHandler(svc)
 	r := gin.New()
 	rg := r.Group("/")
@@ -0,0 +1,236 @@
+package todos
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/cache"
+)
+
+// Cached queries, used as the metrics label for lookups.
+const (
+	CacheQueryGetByID = "get_by_id"
+	CacheQueryGetAll  = "get_all"
+)
+
+const (
+	cacheKeyAll    = "todos:all"
+	cacheKeyPrefix = "todos:id:"
+)
+
+// cachedTodoRepository serves GetByID and GetAll from a cache.Store and
+// invalidates the affected keys on every write. Other reads pass through.
+type cachedTodoRepository struct {
+	next     TodoRepository
+	store    cache.Store
+	ttl      time.Duration
+	onLookup func(query string, hit bool)
+	logger   *slog.Logger
+
+	// generation counts invalidations, shared with transaction copies. A
+	// read-through fill is dropped if it changed while the value was loaded,
+	// since the value may predate the write that caused it.
+	generation *atomic.Uint64
+
+	// dirty collects keys written inside WithinTx; they are invalidated once
+	// the transaction commits. nil outside a transaction.
+	dirty *[]string
+}
+
+// WithCache wraps repo with a read-through cache. Entries live for ttl, which
+// also bounds staleness when several instances share a database: another
+// instance's invalidation cannot stop this one filling an entry it loaded
+// before the write. onLookup, if non-nil, is called with the query name and
+// whether it was a hit.
+func WithCache(repo TodoRepository, store cache.Store, ttl time.Duration, logger *slog.Logger, onLookup func(query string, hit bool)) TodoRepository {
+	return &cachedTodoRepository{
+		next:       repo,
+		store:      store,
+		ttl:        ttl,
+		onLookup:   onLookup,
+		logger:     logger.With("component", "todo_cache"),
+		generation: new(atomic.Uint64),
+	}
+}
+
+func (r *cachedTodoRepository) WithinTx(ctx context.Context, fn func(repo TodoRepository) error) error {
+	if r.dirty != nil {
+		return fn(r)
+	}
+
+	var dirty []string
+	err := r.next.WithinTx(ctx, func(repo TodoRepository) error {
+		tx := *r
+		tx.next, tx.dirty = repo, &dirty
+		return fn(&tx)
+	})
+	if err == nil {
+		r.invalidate(ctx, dirty...)
+	}
+	return err
+}
+
+func (r *cachedTodoRepository) Create(ctx context.Context, todo *Todo) error {
+	if err := r.next.Create(ctx, todo); err != nil {
+		return err
+	}
+	r.invalidate(ctx, cacheKeyAll)
+	return nil
+}
+
+func (r *cachedTodoRepository) GetAll(ctx context.Context) ([]Todo, error) {
+	if r.dirty != nil {
+		return r.next.GetAll(ctx)
+	}
+
+	var todos []Todo
+	if r.lookup(ctx, CacheQueryGetAll, cacheKeyAll, &todos) {
+		// gob decodes an empty list as nil, which would render as null
+		if todos == nil {
+			todos = []Todo{}
+		}
+		return todos, nil
+	}
+	gen := r.generation.Load()
+	todos, err := r.next.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.fill(ctx, gen, cacheKeyAll, todos)
+	return todos, nil
+}
+
+func (r *cachedTodoRepository) GetByID(ctx context.Context, id uint) (*Todo, error) {
+	if r.dirty != nil {
+		return r.next.GetByID(ctx, id)
+	}
+
+	key := todoCacheKey(id)
+	var todo Todo
+	if r.lookup(ctx, CacheQueryGetByID, key, &todo) {
+		return &todo, nil
+	}
+	gen := r.generation.Load()
+	got, err := r.next.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r.fill(ctx, gen, key, got)
+	return got, nil
+}
+
+func (r *cachedTodoRepository) GetByIDUnscoped(ctx context.Context, id uint) (*Todo, error) {
+	return r.next.GetByIDUnscoped(ctx, id)
+}
+
+func (r *cachedTodoRepository) ExistsByTitle(ctx context.Context, title string) (bool, error) {
+	return r.next.ExistsByTitle(ctx, title)
+}
+
+func (r *cachedTodoRepository) Update(ctx context.Context, todo *Todo) error {
+	if err := r.next.Update(ctx, todo); err != nil {
+		return err
+	}
+	r.invalidate(ctx, todoCacheKey(todo.ID), cacheKeyAll)
+	return nil
+}
+
+func (r *cachedTodoRepository) Delete(ctx context.Context, id uint) error {
+	if err := r.next.Delete(ctx, id); err != nil {
+		return err
+	}
+	r.invalidate(ctx, todoCacheKey(id), cacheKeyAll)
+	return nil
+}
+
+func (r *cachedTodoRepository) ChangesSince(ctx context.Context, since uint64, limit int) ([]Todo, error) {
+	return r.next.ChangesSince(ctx, since, limit)
+}
+
+func (r *cachedTodoRepository) LatestChangeSeq(ctx context.Context) (uint64, error) {
+	return r.next.LatestChangeSeq(ctx)
+}
+
+func (r *cachedTodoRepository) CountByStatus(ctx context.Context) (TodoCounts, error) {
+	return r.next.CountByStatus(ctx)
+}
+
+func (r *cachedTodoRepository) Each(ctx context.Context, filter TodoFilter, fn func(Todo) error) error {
+	return r.next.Each(ctx, filter, fn)
+}
+
+func (r *cachedTodoRepository) List(ctx context.Context, filter TodoFilter, limit, offset int) ([]Todo, int64, error) {
+	return r.next.List(ctx, filter, limit, offset)
+}
+
+// lookup decodes the cached value for key into dst. A store or decoding
+// failure is logged and treated as a miss, so the cache never fails a read.
+func (r *cachedTodoRepository) lookup(ctx context.Context, query, key string, dst any) bool {
+	data, ok, err := r.store.Get(ctx, key)
+	if err != nil {
+		r.logger.WarnContext(ctx, "cache get failed", "key", key, "error", err.Error())
+	}
+	if ok {
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(dst); err != nil {
+			r.logger.WarnContext(ctx, "cache entry undecodable", "key", key, "error", err.Error())
+			ok = false
+		}
+	}
+	if r.onLookup != nil {
+		r.onLookup(query, ok)
+	}
+	return ok
+}
+
+// fill stores value under key, loaded when the generation was gen. gob keeps
+// fields the JSON encoding hides, such as FieldClocks, which a later Update
+// writes back.
+func (r *cachedTodoRepository) fill(ctx context.Context, gen uint64, key string, value any) {
+	if r.generation.Load() != gen {
+		return
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		r.logger.WarnContext(ctx, "cache entry unencodable", "key", key, "error", err.Error())
+		return
+	}
+	if err := r.store.Set(ctx, key, buf.Bytes(), r.ttl); err != nil {
+		r.logger.WarnContext(ctx, "cache set failed", "key", key, "error", err.Error())
+		return
+	}
+	if r.generation.Load() != gen {
+		// An invalidation ran between the check and the Set; undo the fill
+		r.deleteKeys(ctx, key)
+	}
+}
+
+// invalidate drops keys now, or at commit when called inside WithinTx.
+func (r *cachedTodoRepository) invalidate(ctx context.Context, keys ...string) {
+	if r.dirty != nil {
+		*r.dirty = append(*r.dirty, keys...)
+		return
+	}
+	if len(keys) == 0 {
+		return
+	}
+	// Bump before deleting, so a concurrent fill either sees the new
+	// generation or lands before the delete
+	r.generation.Add(1)
+	r.deleteKeys(ctx, keys...)
+}
+
+func (r *cachedTodoRepository) deleteKeys(ctx context.Context, keys ...string) {
+	if err := r.store.Delete(ctx, keys...); err != nil {
+		// Entries expire after the TTL; until then readers may see old data
+		r.logger.ErrorContext(ctx, "cache invalidation failed", "keys", keys, "error", err.Error())
+	}
+}
+
+func todoCacheKey(id uint) string {
+	return cacheKeyPrefix + strconv.FormatUint(uint64(id), 10)
+}
@@ -0,0 +1,214 @@
+package todos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/cache"
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lookupCounter records cache lookups as "query/hit" or "query/miss".
+type lookupCounter map[string]int
+
+func (c lookupCounter) observe(query string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	c[query+"/"+result]++
+}
+
+func newCachedRepo(t *testing.T) (TodoRepository, TodoRepository, lookupCounter) {
+	t.Helper()
+
+	backing := NewMemoryTodoRepository(logging.Discard())
+	lookups := lookupCounter{}
+	return WithCache(backing, cache.NewLRU(100), time.Minute, logging.Discard(), lookups.observe), backing, lookups
+}
+
+func TestCache_ReadThroughAndInvalidation(t *testing.T) {
+	ctx := context.Background()
+	repo, backing, lookups := newCachedRepo(t)
+
+	todo := &Todo{Title: "A"}
+	require.NoError(t, repo.Create(ctx, todo))
+	todo.touchField(FieldTitle, time.Now())
+
+	for range 2 {
+		got, err := repo.GetByID(ctx, todo.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "A", got.Title)
+	}
+	assert.Equal(t, lookupCounter{"get_by_id/miss": 1, "get_by_id/hit": 1}, lookups)
+
+	list, err := repo.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	// Writes through the decorator invalidate both the todo and the list
+	todo.Title = "B"
+	require.NoError(t, repo.Update(ctx, todo))
+	got, err := repo.GetByID(ctx, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "B", got.Title)
+	require.NoError(t, repo.Create(ctx, &Todo{Title: "C"}))
+	list, err = repo.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	require.NoError(t, repo.Delete(ctx, todo.ID))
+	_, err = repo.GetByID(ctx, todo.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	t.Logf("lookups: %v", lookups)
+
+	list, err = repo.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	// Writes that bypass the decorator stay invisible until the TTL expires
+	require.NoError(t, backing.Create(ctx, &Todo{Title: "D"}))
+	list, err = repo.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+}
+
+func TestCache_KeepsFieldClocks(t *testing.T) {
+	ctx := context.Background()
+	repo, _, _ := newCachedRepo(t)
+
+	todo := &Todo{Title: "A"}
+	todo.touchField(FieldTitle, time.Now())
+	require.NoError(t, repo.Create(ctx, todo))
+
+	_, err := repo.GetByID(ctx, todo.ID)
+	require.NoError(t, err)
+	cached, err := repo.GetByID(ctx, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, todo.FieldClocks, cached.FieldClocks)
+}
+
+func TestCache_EmptyListIsNotNil(t *testing.T) {
+	repo, _, lookups := newCachedRepo(t)
+
+	for range 2 {
+		list, err := repo.GetAll(context.Background())
+		require.NoError(t, err)
+		assert.NotNil(t, list)
+		assert.Empty(t, list)
+	}
+	assert.Equal(t, 1, lookups["get_all/hit"])
+}
+
+func TestCache_InvalidatesOnCommitOnly(t *testing.T) {
+	ctx := context.Background()
+	repo, _, _ := newCachedRepo(t)
+
+	todo := &Todo{Title: "A"}
+	require.NoError(t, repo.Create(ctx, todo))
+	_, err := repo.GetByID(ctx, todo.ID)
+	require.NoError(t, err)
+
+	errAbort := errors.New("abort")
+	err = repo.WithinTx(ctx, func(tx TodoRepository) error {
+		got, err := tx.GetByID(ctx, todo.ID)
+		require.NoError(t, err)
+		got.Title = "rolled back"
+		require.NoError(t, tx.Update(ctx, got))
+
+		// Reads inside the transaction see its own writes, not the cache
+		again, err := tx.GetByID(ctx, todo.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "rolled back", again.Title)
+		return errAbort
+	})
+	require.ErrorIs(t, err, errAbort)
+
+	got, err := repo.GetByID(ctx, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "A", got.Title)
+
+	require.NoError(t, repo.WithinTx(ctx, func(tx TodoRepository) error {
+		got.Title = "committed"
+		return tx.Update(ctx, got)
+	}))
+	got, err = repo.GetByID(ctx, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "committed", got.Title)
+}
+
+// racingRepository runs afterRead once a read has loaded its value, standing
+// in for a write that lands before the reader fills the cache.
+type racingRepository struct {
+	TodoRepository
+	afterRead func()
+}
+
+func (r *racingRepository) GetByID(ctx context.Context, id uint) (*Todo, error) {
+	got, err := r.TodoRepository.GetByID(ctx, id)
+	if r.afterRead != nil {
+		afterRead := r.afterRead
+		r.afterRead = nil
+		afterRead()
+	}
+	return got, err
+}
+
+func TestCache_DropsFillRacingAnInvalidation(t *testing.T) {
+	ctx := context.Background()
+	backing := &racingRepository{TodoRepository: NewMemoryTodoRepository(logging.Discard())}
+	repo := WithCache(backing, cache.NewLRU(100), time.Minute, logging.Discard(), nil)
+
+	todo := &Todo{Title: "A"}
+	require.NoError(t, repo.Create(ctx, todo))
+
+	backing.afterRead = func() {
+		updated := *todo
+		updated.Title = "B"
+		require.NoError(t, repo.Update(ctx, &updated))
+	}
+	got, err := repo.GetByID(ctx, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "A", got.Title, "the racing reader returns what it loaded")
+
+	// ...but does not cache it over the write
+	got, err = repo.GetByID(ctx, todo.ID)
+	require.NoError(t, err)
+	t.Logf("after race: %q", got.Title)
+	assert.Equal(t, "B", got.Title)
+}
+
+// failingStore fails every call, like an unreachable remote cache.
+type failingStore struct{}
+
+var errStoreDown = errors.New("store down")
+
+func (failingStore) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errStoreDown
+}
+
+func (failingStore) Set(context.Context, string, []byte, time.Duration) error {
+	return errStoreDown
+}
+
+func (failingStore) Delete(context.Context, ...string) error {
+	return errStoreDown
+}
+
+func TestCache_StoreFailuresFallThrough(t *testing.T) {
+	ctx := context.Background()
+	repo := WithCache(NewMemoryTodoRepository(logging.Discard()), failingStore{}, time.Minute, logging.Discard(), nil)
+
+	todo := &Todo{Title: "A"}
+	require.NoError(t, repo.Create(ctx, todo))
+	got, err := repo.GetByID(ctx, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "A", got.Title)
+	list, err := repo.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+}
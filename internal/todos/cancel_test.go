@@ -0,0 +1,101 @@
+package todos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/problem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// createSlowInsertDB returns a database whose todo inserts fire a trigger
+// that scans a 10^12-row cross join, so an INSERT only finishes when it is
+// interrupted.
+func createSlowInsertDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db := createFileTestDB(t, filepath.Join(t.TempDir(), "slow.db"))
+	require.NoError(t, db.Exec("CREATE TABLE numbers (n INTEGER)").Error)
+	require.NoError(t, db.Exec(
+		"WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < 1000) INSERT INTO numbers SELECT n FROM seq",
+	).Error)
+	require.NoError(t, db.Exec(`CREATE TRIGGER slow_insert AFTER INSERT ON todos BEGIN
+		SELECT COUNT(*) FROM numbers a, numbers b, numbers c, numbers d;
+	END`).Error)
+
+	return db
+}
+
+func TestRepository_CancelInterruptsQuery(t *testing.T) {
+	repo := NewTodoRepository(createSlowInsertDB(t), logging.Discard())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := repo.Create(ctx, &Todo{Title: "slow"})
+	elapsed := time.Since(start)
+	t.Logf("create returned after %s: %v", elapsed, err)
+
+	require.Error(t, err)
+	assert.Less(t, elapsed, 5*time.Second, "query kept running after cancellation")
+
+	// The interrupted transaction must not leave a row behind
+	exists, err := repo.ExistsByTitle(context.Background(), "slow")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestHandler_ClientDisconnectCancelsQuery(t *testing.T) {
+	repo := NewTodoRepository(createSlowInsertDB(t), logging.Discard())
+	r := setupRouter(NewTodoHandler(NewTodoService(repo, logging.Discard())))
+
+	// A client disconnect cancels the request context in net/http
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	req := httptest.NewRequest(http.MethodPost, "/todos", bytes.NewReader([]byte(`{"title":"slow"}`))).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	r.ServeHTTP(w, req)
+	elapsed := time.Since(start)
+	t.Logf("HTTP POST /todos (disconnected after 100ms): %s status=%d resp=%s", elapsed, w.Code, w.Body.String())
+
+	assert.Less(t, elapsed, 5*time.Second, "query kept running after the client went away")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	var resp problem.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, problem.CodeCanceled, resp.Code)
+}
+
+func TestHandler_DeadlineReturnsGatewayTimeout(t *testing.T) {
+	repo := NewTodoRepository(createSlowInsertDB(t), logging.Discard())
+	r := setupRouter(NewTodoHandler(NewTodoService(repo, logging.Discard())))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodPost, "/todos", bytes.NewReader([]byte(`{"title":"slow"}`))).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	t.Logf("HTTP POST /todos (100ms deadline): status=%d resp=%s", w.Code, w.Body.String())
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+
+	var resp problem.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, problem.CodeTimeout, resp.Code)
+}
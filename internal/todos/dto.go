@@ -1,5 +1,11 @@
 package todos
 
+import (
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/problem"
+)
+
 // CreateTodoRequest describes payload to create a new todo item.
 type CreateTodoRequest struct {
 	Title       string `json:"title" binding:"required"`
@@ -12,3 +18,94 @@ type UpdateTodoRequest struct {
 	Description string `json:"description"`
 	Completed   *bool  `json:"completed"`
 }
+
+// SyncChangesResponse describes a page of changes returned to sync clients.
+type SyncChangesResponse struct {
+	// Changes are ordered by change token; deleted todos carry deleted_at.
+	Changes []Todo `json:"changes"`
+	// Token should be passed as `since` on the next pull.
+	Token   string `json:"token"`
+	HasMore bool   `json:"has_more"`
+}
+
+// SyncFieldValue carries a client-side field value and when it was modified.
+type SyncFieldValue struct {
+	Value      interface{} `json:"value" swaggertype:"string"`
+	ModifiedAt time.Time   `json:"modified_at"`
+}
+
+// SyncChange describes a single client-side change pushed to the server.
+type SyncChange struct {
+	// ID of the todo to change; zero creates a new todo.
+	ID uint `json:"id"`
+	// ClientRef is an opaque client identifier echoed back in the result.
+	ClientRef string `json:"client_ref"`
+	// BaseToken is the change token the client last pulled for this todo.
+	BaseToken  string                    `json:"base_token"`
+	Deleted    bool                      `json:"deleted"`
+	ModifiedAt time.Time                 `json:"modified_at"`
+	Fields     map[string]SyncFieldValue `json:"fields"`
+}
+
+// SyncRequest describes a batch of client changes.
+type SyncRequest struct {
+	// Strategy is "lww" (per-field last-writer-wins, default) or "report".
+	Strategy string       `json:"strategy" enums:"lww,report"`
+	Changes  []SyncChange `json:"changes" binding:"required"`
+}
+
+// SyncConflict describes a field whose server and client values diverged.
+type SyncConflict struct {
+	Field            string      `json:"field"`
+	ServerValue      interface{} `json:"server_value" swaggertype:"string"`
+	ClientValue      interface{} `json:"client_value" swaggertype:"string"`
+	ServerModifiedAt time.Time   `json:"server_modified_at"`
+	// Resolution is "server" when last-writer-wins kept the server value,
+	// or "unresolved" when the client must decide.
+	Resolution string `json:"resolution"`
+}
+
+// SyncResult describes the outcome of applying a single SyncChange.
+type SyncResult struct {
+	ClientRef string         `json:"client_ref,omitempty"`
+	ID        uint           `json:"id"`
+	Status    string         `json:"status" enums:"created,applied,unchanged,conflict,deleted,rejected"`
+	Error     string         `json:"error,omitempty"`
+	Conflicts []SyncConflict `json:"conflicts,omitempty"`
+	Todo      *Todo          `json:"todo,omitempty"`
+}
+
+// SyncResponse describes the outcome of a pushed batch.
+type SyncResponse struct {
+	Results []SyncResult `json:"results"`
+	// Token is the latest change token after the batch was applied.
+	Token string `json:"token"`
+}
+
+// ImportItem is a todo read from an import file.
+type ImportItem struct {
+	// Row is the line number in CSV and todo.txt files, or the 1-based
+	// position in a JSON array.
+	Row         int    `json:"row"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Completed   bool   `json:"completed"`
+
+	// invalid holds errors found while reading the row
+	invalid []problem.FieldError
+}
+
+// ImportResponse describes the outcome of an import.
+type ImportResponse struct {
+	DryRun bool `json:"dry_run"`
+	// Total is the number of todos read from the file.
+	Total   int `json:"total"`
+	Created int `json:"created"`
+	// Errors lists row-level validation errors and title conflicts; any
+	// error prevents the whole import.
+	Errors []problem.FieldError `json:"errors,omitempty"`
+	// Preview lists the todos a dry run would create.
+	Preview []ImportItem `json:"preview,omitempty"`
+	// Todos lists the created todos.
+	Todos []Todo `json:"todos,omitempty"`
+}
@@ -15,4 +15,48 @@ type Todo struct {
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index" swaggerignore:"true"`
+	// ChangeSeq is the change token assigned by the last write (including
+	// soft deletes). It is rendered as the string FormatChangeToken returns,
+	// so clients can send it back as a sync base_token.
+	ChangeSeq uint64 `json:"change_token,string" gorm:"not null;default:0;index"`
+	// FieldClocks records when each syncable field was last modified.
+	FieldClocks FieldClocks `json:"-" gorm:"serializer:json"`
+}
+
+// Syncable field names used by FieldClocks and the sync API.
+const (
+	FieldTitle       = "title"
+	FieldDescription = "description"
+	FieldCompleted   = "completed"
+)
+
+// FieldClocks maps a field name to the time it was last modified.
+type FieldClocks map[string]time.Time
+
+// touchField records that the named field was modified at the given time.
+func (t *Todo) touchField(name string, at time.Time) {
+	if t.FieldClocks == nil {
+		t.FieldClocks = make(FieldClocks, 3)
+	}
+	t.FieldClocks[name] = at.UTC()
+}
+
+// fieldModifiedAt returns when the named field was last modified, falling back
+// to UpdatedAt for rows written before field clocks were tracked.
+func (t *Todo) fieldModifiedAt(name string) time.Time {
+	if at, ok := t.FieldClocks[name]; ok {
+		return at
+	}
+	return t.UpdatedAt
+}
+
+// lastModifiedAt returns the most recent field modification time.
+func (t *Todo) lastModifiedAt() time.Time {
+	last := t.UpdatedAt
+	for _, at := range t.FieldClocks {
+		if at.After(last) {
+			last = at
+		}
+	}
+	return last
 }
@@ -0,0 +1,58 @@
+package todos
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/drago44/golang-todo-api/internal/problem"
+)
+
+// Domain errors returned by TodoService and repository.
+var (
+	ErrTitleRequired = errors.New("title is required")
+	ErrTitleExists   = errors.New("todo with this title already exists")
+	ErrNotFound      = errors.New("todo not found")
+)
+
+// Sync errors returned by SyncService.
+var (
+	ErrInvalidSyncToken    = errors.New("invalid sync token")
+	ErrInvalidSyncStrategy = errors.New("invalid sync strategy")
+	ErrUnknownSyncField    = errors.New("unknown sync field")
+	ErrInvalidSyncValue    = errors.New("invalid sync field value")
+)
+
+// Import errors returned while reading an import file.
+var (
+	ErrImportFormat  = errors.New("unsupported import format")
+	ErrImportMapping = errors.New("invalid import column mapping")
+	ErrImportFile    = errors.New("import file cannot be parsed")
+	ErrImportTooMany = errors.New("import file has too many rows")
+)
+
+// Stable error codes exposed in problem responses.
+const (
+	CodeTodoNotFound        = "todo_not_found"
+	CodeTitleRequired       = "todo_title_required"
+	CodeTitleExists         = "todo_title_exists"
+	CodeInvalidSyncToken    = "sync_invalid_token"
+	CodeInvalidSyncStrategy = "sync_invalid_strategy"
+	CodeImportFormat        = "import_invalid_format"
+	CodeImportMapping       = "import_invalid_mapping"
+	CodeImportFile          = "import_malformed_file"
+	CodeImportTooMany       = "import_too_many_rows"
+	CodeImportRejected      = "import_rejected"
+	CodeExportNotAcceptable = "export_not_acceptable"
+)
+
+func init() {
+	problem.Register(ErrNotFound, http.StatusNotFound, CodeTodoNotFound)
+	problem.Register(ErrTitleRequired, http.StatusBadRequest, CodeTitleRequired)
+	problem.Register(ErrTitleExists, http.StatusConflict, CodeTitleExists)
+	problem.Register(ErrInvalidSyncToken, http.StatusBadRequest, CodeInvalidSyncToken)
+	problem.Register(ErrInvalidSyncStrategy, http.StatusBadRequest, CodeInvalidSyncStrategy)
+	problem.Register(ErrImportFormat, http.StatusBadRequest, CodeImportFormat)
+	problem.Register(ErrImportMapping, http.StatusBadRequest, CodeImportMapping)
+	problem.Register(ErrImportFile, http.StatusBadRequest, CodeImportFile)
+	problem.Register(ErrImportTooMany, http.StatusRequestEntityTooLarge, CodeImportTooMany)
+}
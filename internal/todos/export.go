@@ -0,0 +1,324 @@
+package todos
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export file formats.
+const (
+	ExportCSV      = "csv"
+	ExportJSONL    = "jsonl"
+	ExportMarkdown = "md"
+	ExportTodoTxt  = "todotxt"
+)
+
+// exportFormat describes how a format is served and written.
+type exportFormat struct {
+	name      string
+	mediaType string
+	// accept lists further media types that negotiate to this format
+	accept     []string
+	extension  string
+	newEncoder func(w io.Writer) exportEncoder
+}
+
+// exportEncoder writes todos in one format.
+type exportEncoder interface {
+	Encode(todo Todo) error
+	// Close writes anything that follows the last todo and flushes.
+	Close() error
+}
+
+// exportFormats are listed in preference order; the first is the default.
+var exportFormats = []exportFormat{
+	{name: ExportCSV, mediaType: "text/csv", extension: "csv", newEncoder: newCSVEncoder},
+	{name: ExportJSONL, mediaType: "application/jsonl", accept: []string{"application/x-ndjson", "application/jsonlines"}, extension: "jsonl", newEncoder: newJSONLEncoder},
+	{name: ExportMarkdown, mediaType: "text/markdown", extension: "md", newEncoder: newMarkdownEncoder},
+	{name: ExportTodoTxt, mediaType: "text/plain", extension: "txt", newEncoder: newTodoTxtEncoder},
+}
+
+// exportFormatByName returns the format called name.
+func exportFormatByName(name string) (exportFormat, bool) {
+	for _, f := range exportFormats {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return exportFormat{}, false
+}
+
+// exportFormatForAccept returns the format an Accept header prefers. Each
+// format takes the q-value of the most specific media range matching it, so
+// "text/*;q=0.5, text/markdown" prefers Markdown; ties go to the earlier
+// format. An empty header accepts the default.
+func exportFormatForAccept(accept string) (exportFormat, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return exportFormats[0], true
+	}
+
+	var (
+		best  exportFormat
+		bestQ float64
+	)
+	for _, f := range exportFormats {
+		q, specificity := 0.0, -1
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			s := f.matches(mediaType)
+			if s <= specificity {
+				continue
+			}
+			specificity, q = s, 1
+			if v, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(v, 64); err != nil {
+					q = 0
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// matches reports how specifically a media range names the format: 2 for
+// its own type, 1 for type/*, 0 for */* and -1 when it does not match.
+func (f exportFormat) matches(mediaRange string) int {
+	if mediaRange == f.mediaType || slices.Contains(f.accept, mediaRange) {
+		return 2
+	}
+	if mediaRange == "*/*" {
+		return 0
+	}
+	if prefix, ok := strings.CutSuffix(mediaRange, "*"); ok && strings.HasPrefix(f.mediaType, prefix) {
+		return 1
+	}
+	return -1
+}
+
+// exportWriteWindow is how long the client has to take each stretch of an
+// export. The server's WriteTimeout covers the whole response, which would
+// cut a large export off, so the write deadline is pushed forward instead
+// as rows are written.
+const exportWriteWindow = 10 * time.Second
+
+// writeDeadline renews a response's write deadline. Writers that do not
+// support deadlines, such as httptest.ResponseRecorder, are left alone.
+type writeDeadline struct {
+	rc      *http.ResponseController
+	renewed time.Time
+}
+
+func newWriteDeadline(w http.ResponseWriter) *writeDeadline {
+	d := &writeDeadline{rc: http.NewResponseController(w)}
+	d.renew()
+	return d
+}
+
+// renew moves the deadline exportWriteWindow ahead, at most every half
+// window so writing a row rarely touches the connection.
+func (d *writeDeadline) renew() {
+	if now := time.Now(); now.Sub(d.renewed) >= exportWriteWindow/2 {
+		d.renewed = now
+		_ = d.rc.SetWriteDeadline(now.Add(exportWriteWindow))
+	}
+}
+
+// exportColumns are the CSV header. Import reads the title, description and
+// completed columns by name and ignores the rest.
+var exportColumns = []string{"id", "title", "description", "completed", "created_at", "updated_at"}
+
+type csvEncoder struct {
+	w       *csv.Writer
+	started bool
+}
+
+func newCSVEncoder(w io.Writer) exportEncoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) header() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+	return e.w.Write(exportColumns)
+}
+
+func (e *csvEncoder) Encode(todo Todo) error {
+	if err := e.header(); err != nil {
+		return err
+	}
+	return e.w.Write([]string{
+		strconv.FormatUint(uint64(todo.ID), 10),
+		csvCell(todo.Title),
+		csvCell(todo.Description),
+		strconv.FormatBool(todo.Completed),
+		todo.CreatedAt.UTC().Format(time.RFC3339),
+		todo.UpdatedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (e *csvEncoder) Close() error {
+	if err := e.header(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// csvCell quotes text a spreadsheet would run as a formula, following the
+// OWASP advice on CSV injection.
+func csvCell(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+type jsonlEncoder struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONLEncoder(w io.Writer) exportEncoder {
+	buf := bufio.NewWriter(w)
+	return &jsonlEncoder{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+// Encode writes the todo as the API returns it, one per line.
+func (e *jsonlEncoder) Encode(todo Todo) error { return e.enc.Encode(todo) }
+
+func (e *jsonlEncoder) Close() error { return e.buf.Flush() }
+
+type markdownEncoder struct {
+	buf   *bufio.Writer
+	count int
+}
+
+func newMarkdownEncoder(w io.Writer) exportEncoder {
+	buf := bufio.NewWriter(w)
+	_, _ = buf.WriteString("# Todos\n\n")
+	return &markdownEncoder{buf: buf}
+}
+
+// markdownEscaper keeps titles and descriptions from being read as markup.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`, `<`, `\<`, `>`, `\>`, `#`, `\#`, `|`, `\|`,
+)
+
+// Encode writes the todo as a task list item with its description indented
+// below the title.
+func (e *markdownEncoder) Encode(todo Todo) error {
+	e.count++
+	box := "[ ]"
+	if todo.Completed {
+		box = "[x]"
+	}
+	_, err := fmt.Fprintf(e.buf, "- %s %s\n", box, markdownEscaper.Replace(strings.Join(strings.Fields(todo.Title), " ")))
+	for _, line := range strings.Split(todo.Description, "\n") {
+		if line = strings.TrimSpace(line); line != "" && err == nil {
+			_, err = fmt.Fprintf(e.buf, "  %s  \n", markdownEscaper.Replace(line))
+		}
+	}
+	return err
+}
+
+func (e *markdownEncoder) Close() error {
+	if e.count == 0 {
+		_, _ = e.buf.WriteString("_No todos._\n")
+	}
+	return e.buf.Flush()
+}
+
+type todoTxtEncoder struct {
+	buf *bufio.Writer
+}
+
+func newTodoTxtEncoder(w io.Writer) exportEncoder {
+	return &todoTxtEncoder{buf: bufio.NewWriter(w)}
+}
+
+func (e *todoTxtEncoder) Encode(todo Todo) error {
+	_, err := e.buf.WriteString(todoTxtLine(todo) + "\n")
+	return err
+}
+
+func (e *todoTxtEncoder) Close() error { return e.buf.Flush() }
+
+// todoTxtLine renders a todo as a todo.txt task. Description lines in the
+// form import writes (Priority, Projects, Contexts, Created, Completed and
+// key: value tags) are turned back into todo.txt syntax; todo.txt has no
+// place for other description text, so it is left out.
+func todoTxtLine(todo Todo) string {
+	var (
+		priority                 string
+		projects, contexts, tags []string
+		created                  = todo.CreatedAt.UTC().Format(time.DateOnly)
+		closed                   = todo.UpdatedAt.UTC().Format(time.DateOnly)
+	)
+	for _, line := range strings.Split(todo.Description, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ": ")
+		if !ok {
+			continue
+		}
+		switch {
+		case key == "Priority" && isTodoTxtPriority("("+value+")"):
+			priority = value
+		case key == "Projects":
+			projects = append(projects, todoTxtWords("+", value)...)
+		case key == "Contexts":
+			contexts = append(contexts, todoTxtWords("@", value)...)
+		case key == "Created" && isTodoTxtDate(value):
+			created = value
+		case key == "Completed" && isTodoTxtDate(value):
+			closed = value
+		case !strings.ContainsAny(key, " :") && value != "" && !strings.ContainsAny(value, " "):
+			tags = append(tags, key+":"+value)
+		}
+	}
+
+	var parts []string
+	if todo.Completed {
+		parts = append(parts, "x", closed, created)
+		if priority != "" {
+			// Completed tasks drop the leading priority and keep it as a tag
+			tags = append(tags, "pri:"+priority)
+		}
+	} else {
+		if priority != "" {
+			parts = append(parts, "("+priority+")")
+		}
+		parts = append(parts, created)
+	}
+	parts = append(parts, strings.Fields(todo.Title)...)
+	parts = append(parts, projects...)
+	parts = append(parts, contexts...)
+	parts = append(parts, tags...)
+	return strings.Join(parts, " ")
+}
+
+// todoTxtWords turns a comma-separated list into prefixed todo.txt words.
+func todoTxtWords(prefix, list string) []string {
+	var words []string
+	for _, w := range strings.Split(list, ",") {
+		if w = strings.TrimSpace(w); w != "" && !strings.Contains(w, " ") {
+			words = append(words, prefix+w)
+		}
+	}
+	return words
+}
@@ -0,0 +1,181 @@
+package todos
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportTodos_Handler(t *testing.T) {
+	repo := NewMemoryTodoRepository(logging.Discard())
+	day := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i, todo := range []*Todo{
+		{Title: "Buy milk", Description: "2 litres", CreatedAt: day},
+		{Title: "=HYPERLINK(\"x\")", Completed: true, CreatedAt: day.AddDate(0, 0, 1)},
+		{Title: "Call *mom*", Description: "Priority: A\nProjects: Family", CreatedAt: day.AddDate(0, 0, 7)},
+	} {
+		todo.UpdatedAt = todo.CreatedAt
+		require.NoError(t, repo.Create(context.Background(), todo), i)
+	}
+	r := setupRouter(NewTodoHandler(NewTodoService(repo, logging.Discard())))
+
+	get := func(query, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/todos/export"+query, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		t.Logf("GET /todos/export%s Accept=%q: status=%d type=%q disposition=%q\n%s",
+			query, accept, w.Code, w.Header().Get("Content-Type"), w.Header().Get("Content-Disposition"), w.Body.String())
+		return w
+	}
+
+	// CSV is the default, with spreadsheet formulas defused
+	w := get("", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Regexp(t, `^attachment; filename=todos-\d{4}-\d{2}-\d{2}\.csv$`, w.Header().Get("Content-Disposition"))
+	records, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+	assert.Equal(t, exportColumns, records[0])
+	assert.Equal(t, []string{"1", "Buy milk", "2 litres", "false", "2024-03-01T09:00:00Z", "2024-03-01T09:00:00Z"}, records[1])
+	assert.Equal(t, `'=HYPERLINK("x")`, records[2][1])
+
+	// The Accept header picks the format when format is not given
+	w = get("?status=open", "application/x-ndjson")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/jsonl; charset=utf-8", w.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 2)
+	var todo Todo
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &todo))
+	assert.Equal(t, "Call *mom*", todo.Title)
+
+	w = get("?format=md&from=2024-03-02&to=2024-03-08", "text/csv")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".md")
+	assert.Equal(t, "# Todos\n\n- [x] =HYPERLINK(\"x\")\n- [ ] Call \\*mom\\*\n  Priority: A  \n  Projects: Family  \n", w.Body.String())
+
+	w = get("?format=todotxt&to=2024-03-01", "")
+	assert.Equal(t, "2024-03-01 Buy milk\n", w.Body.String())
+	w = get("?format=md&status=completed&from=2025-01-01", "")
+	assert.Equal(t, "# Todos\n\n_No todos._\n", w.Body.String())
+
+	// Unsupported formats and bad filters are rejected before streaming
+	w = get("", "application/xml")
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	assert.Contains(t, w.Body.String(), CodeExportNotAcceptable)
+	for _, query := range []string{"?format=xlsx", "?status=done", "?from=yesterday", "?from=2024-03-02&to=2024-03-01"} {
+		w = get(query, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		assert.Empty(t, w.Header().Get("Content-Disposition"), query)
+	}
+}
+
+func TestExportFormatForAccept(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                                    ExportCSV,
+		"*/*":                                 ExportCSV,
+		"text/markdown, text/csv":             ExportCSV,
+		"text/*;q=0.5, text/markdown":         ExportMarkdown,
+		"text/csv;q=0.2, text/plain;q=0.9":    ExportTodoTxt,
+		"application/*":                       ExportJSONL,
+		"application/json, */*;q=0.1":         ExportCSV,
+		"text/csv;q=0, application/jsonlines": ExportJSONL,
+		"application/jsonl; charset=utf-8":    ExportJSONL,
+		"application/json, application/xml":   "",
+		"text/csv;q=0":                        "",
+	} {
+		f, ok := exportFormatForAccept(accept)
+		t.Logf("%q: %q %t", accept, f.name, ok)
+		assert.Equal(t, want, f.name, accept)
+		assert.Equal(t, want != "", ok, accept)
+	}
+}
+
+func TestExportTodos_ErrorBeforeStreaming(t *testing.T) {
+	mockSvc := new(mockTodoService)
+	r := setupRouter(NewTodoHandler(mockSvc))
+	mockSvc.On("ExportTodos", TodoFilter{}).Return([]Todo{{ID: 1, Title: "A"}}, errors.New("connection reset")).Once()
+
+	req := httptest.NewRequest(http.MethodGet, "/todos/export?format=jsonl", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	t.Logf("status=%d resp=%s", w.Code, w.Body.String())
+
+	// Rows still buffered are dropped in favour of a problem response
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
+	assert.NotContains(t, w.Body.String(), `"title":"A"`)
+	mockSvc.AssertExpectations(t)
+}
+
+// slowEachRepository delays every row Each yields, like a large table read
+// over a slow link.
+type slowEachRepository struct {
+	TodoRepository
+	delay time.Duration
+}
+
+func (r slowEachRepository) Each(ctx context.Context, filter TodoFilter, fn func(Todo) error) error {
+	return r.TodoRepository.Each(ctx, filter, func(todo Todo) error {
+		time.Sleep(r.delay)
+		return fn(todo)
+	})
+}
+
+func TestExportTodos_OutlastsWriteTimeout(t *testing.T) {
+	repo := NewMemoryTodoRepository(logging.Discard())
+	for _, title := range []string{"A", "B", "C", "D", "E"} {
+		require.NoError(t, repo.Create(context.Background(), &Todo{Title: title}))
+	}
+	r := setupRouter(NewTodoHandler(NewTodoService(slowEachRepository{repo, 50 * time.Millisecond}, logging.Discard())))
+	srv := httptest.NewUnstartedServer(r)
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	start := time.Now()
+	resp, err := srv.Client().Get(srv.URL + "/todos/export?format=jsonl")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	t.Logf("status=%d after %s: %v\n%s", resp.StatusCode, time.Since(start), err, body)
+
+	// The export takes longer than the write timeout, yet arrives whole
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(body)), "\n"), 5)
+}
+
+func TestTodoTxtLine_RoundTrip(t *testing.T) {
+	for _, line := range []string{
+		"2024-03-01 Water plants",
+		"(A) 2024-03-01 Call mom +Family @phone due:2024-03-05",
+		"x 2024-03-02 2024-03-01 Pay rent +Home pri:B",
+	} {
+		item := parseTodoTxtLine(line)
+		todo := Todo{Title: item.Title, Description: item.Description, Completed: item.Completed, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		got := todoTxtLine(todo)
+		t.Logf("%q -> %+v -> %q", line, item, got)
+		assert.Equal(t, line, got)
+	}
+
+	// Free-text descriptions have no place in todo.txt
+	todo := Todo{Title: "Buy  milk", Description: "2 litres, semi-skimmed", Completed: true,
+		CreatedAt: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), UpdatedAt: time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)}
+	assert.Equal(t, "x 2024-03-04 2024-03-01 Buy milk", todoTxtLine(todo))
+}
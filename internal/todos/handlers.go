@@ -1,16 +1,24 @@
 package todos
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"mime"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/drago44/golang-todo-api/internal/problem"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 // TodoHandler exposes HTTP handlers for todo resources.
 type TodoHandler struct {
 	todoService TodoService
+	// strictJSON rejects request bodies with unknown fields
+	strictJSON bool
 }
 
 // NewTodoHandler creates a new TodoHandler instance.
@@ -18,11 +26,47 @@ func NewTodoHandler(todoService TodoService) *TodoHandler {
 	return &TodoHandler{todoService: todoService}
 }
 
+// WithStrictJSON returns a copy of h that rejects create and update bodies
+// containing fields CreateTodoRequest or UpdateTodoRequest do not define,
+// instead of ignoring them.
+func (h *TodoHandler) WithStrictJSON() *TodoHandler {
+	strict := *h
+	strict.strictJSON = true
+	return &strict
+}
+
+// bindJSON decodes and validates the request body into obj.
+func (h *TodoHandler) bindJSON(c *gin.Context, obj any) error {
+	if h.strictJSON {
+		return c.ShouldBindWith(obj, strictJSONBinding{})
+	}
+	return c.ShouldBindJSON(obj)
+}
+
+// strictJSONBinding is gin's JSON binding with unknown fields disallowed.
+type strictJSONBinding struct{}
+
+func (strictJSONBinding) Name() string { return "json" }
+
+func (strictJSONBinding) Bind(req *http.Request, obj any) error {
+	if req == nil || req.Body == nil {
+		return errors.New("invalid request")
+	}
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(obj); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
 // RegisterTodoRoutes registers todo routes under the provided router group.
 func (h *TodoHandler) RegisterTodoRoutes(rg *gin.RouterGroup) {
 	todos := rg.Group("/todos")
 	{
 		todos.POST("", h.CreateTodo)
+		todos.POST("/import", h.ImportTodos)
+		todos.GET("/export", h.ExportTodos)
 		todos.GET("", h.GetAllTodos)
 		todos.GET("/:id", h.GetTodoByID)
 		todos.PUT("/:id", h.UpdateTodo)
@@ -32,11 +76,6 @@ func (h *TodoHandler) RegisterTodoRoutes(rg *gin.RouterGroup) {
 
 // sync.Pool removed for simplicity
 
-// ErrorResponse describes an error payload returned by the API.
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
-
 // MessageResponse describes a simple informational message payload.
 type MessageResponse struct {
 	Message string `json:"message"`
@@ -48,35 +87,222 @@ type MessageResponse struct {
 // @Tags todos
 // @Accept json
 // @Produce json
+// @Produce application/problem+json
 // @Param request body CreateTodoRequest true "Create Todo Request"
 // @Success 201 {object} Todo
-// @Failure 400 {object} ErrorResponse
-// @Failure 409 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /todos [post]
 func (h *TodoHandler) CreateTodo(c *gin.Context) {
 	req := new(CreateTodoRequest)
-	if err := c.ShouldBindJSON(req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	if err := h.bindJSON(c, req); err != nil {
+		problem.BindError(c, err)
 		return
 	}
 
-	todo, err := h.todoService.CreateTodo(req)
+	todo, err := h.todoService.CreateTodo(c.Request.Context(), req)
 	if err != nil {
-		switch {
-		case errors.Is(err, ErrTitleRequired):
-			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
-			return
-		case errors.Is(err, ErrTitleExists):
-			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
-			return
-		default:
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, todo)
+}
+
+// ImportTodos handles POST /todos/import and creates todos from an uploaded
+// CSV, JSON or todo.txt file. Either every row is created or none is.
+// @Summary Import todos
+// @Description Import todos from a CSV file (header row, columns picked by mapping), a JSON array of CreateTodoRequest, or a todo.txt file. With dry_run the file is only checked; row-level errors and title conflicts are reported either way.
+// @Tags todos
+// @Accept multipart/form-data
+// @Produce json
+// @Produce application/problem+json
+// @Param file formData file true "File to import"
+// @Param format formData string false "csv, json or todotxt; defaults to the file extension" Enums(csv, json, todotxt)
+// @Param mapping formData string false "CSV column for each field, e.g. title=Name,description=Notes,completed=Done"
+// @Param dry_run formData bool false "Check the file without creating anything"
+// @Success 200 {object} ImportResponse "Dry run result"
+// @Success 201 {object} ImportResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 413 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /todos/import [post]
+func (h *TodoHandler) ImportTodos(c *gin.Context) {
+	header, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		problem.PayloadTooLarge(c, tooLarge.Limit)
+		return
+	case errors.Is(err, http.ErrMissingFile):
+		problem.BadParameter(c, "file", "is required")
+		return
+	case err != nil:
+		problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeMalformedRequest, "The request body is not a multipart form."))
+		return
+	}
+
+	// Parameters may come as form fields or in the query string
+	dryRun := false
+	if v := c.Request.FormValue("dry_run"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			problem.BadParameter(c, "dry_run", "must be a boolean")
 			return
 		}
 	}
+	format, err := importFormat(c.Request.FormValue("format"), header.Filename)
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
 
-	c.JSON(http.StatusCreated, todo)
+	file, err := header.Open()
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+	defer file.Close()
+	items, err := parseImport(file, format, c.Request.FormValue("mapping"))
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	resp, err := h.todoService.ImportTodos(c.Request.Context(), items, dryRun)
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+	switch {
+	case dryRun:
+		c.JSON(http.StatusOK, resp)
+	case len(resp.Errors) > 0:
+		p := problem.New(http.StatusUnprocessableEntity, CodeImportRejected, "No todos were imported because some rows are invalid.")
+		p.Errors = resp.Errors
+		problem.Write(c, p)
+	default:
+		c.JSON(http.StatusCreated, resp)
+	}
+}
+
+// ExportTodos handles GET /todos/export and streams todos as a file download.
+// @Summary Export todos
+// @Description Stream todos as CSV, JSON Lines, Markdown or todo.txt. The format comes from the format parameter, or else from the Accept header (text/csv, application/jsonl, text/markdown, text/plain); CSV is the default.
+// @Tags todos
+// @Produce text/csv
+// @Produce application/jsonl
+// @Produce text/markdown
+// @Produce text/plain
+// @Produce application/problem+json
+// @Param format query string false "Export format" Enums(csv, jsonl, md, todotxt)
+// @Param status query string false "Only open or completed todos" Enums(open, completed)
+// @Param from query string false "Created at or after this date (2006-01-02) or RFC 3339 time"
+// @Param to query string false "Created before this RFC 3339 time, or on or before this date"
+// @Success 200 {file} file
+// @Failure 400 {object} problem.Problem
+// @Failure 406 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /todos/export [get]
+func (h *TodoHandler) ExportTodos(c *gin.Context) {
+	format, ok := negotiateExport(c)
+	if !ok {
+		return
+	}
+	filter, ok := exportFilter(c)
+	if !ok {
+		return
+	}
+
+	filename := fmt.Sprintf("todos-%s.%s", time.Now().UTC().Format(time.DateOnly), format.extension)
+	c.Header("Content-Type", format.mediaType+"; charset=utf-8")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Header("Vary", "Accept")
+
+	deadline := newWriteDeadline(c.Writer)
+	enc := format.newEncoder(c.Writer)
+	err := h.todoService.ExportTodos(c.Request.Context(), filter, func(todo Todo) error {
+		deadline.renew()
+		return enc.Encode(todo)
+	})
+	if err == nil {
+		deadline.renew()
+		err = enc.Close()
+	}
+	switch {
+	case err == nil:
+		c.Status(http.StatusOK)
+	case !c.Writer.Written():
+		c.Writer.Header().Del("Content-Disposition")
+		problem.Error(c, err)
+	default:
+		// The status line is gone; a truncated download is all that is left
+		_ = c.Error(err)
+		c.Abort()
+	}
+}
+
+// negotiateExport picks the export format from the format parameter or the
+// Accept header, rendering a problem when neither names one it can serve.
+func negotiateExport(c *gin.Context) (exportFormat, bool) {
+	if name := c.Query("format"); name != "" {
+		format, ok := exportFormatByName(name)
+		if !ok {
+			problem.BadParameter(c, "format", "must be one of csv, jsonl, md or todotxt")
+		}
+		return format, ok
+	}
+
+	format, ok := exportFormatForAccept(c.GetHeader("Accept"))
+	if !ok {
+		problem.Write(c, problem.New(http.StatusNotAcceptable, CodeExportNotAcceptable,
+			"Todos can be exported as text/csv, application/jsonl, text/markdown or text/plain."))
+	}
+	return format, ok
+}
+
+// exportFilter reads the status, from and to parameters.
+func exportFilter(c *gin.Context) (TodoFilter, bool) {
+	var filter TodoFilter
+	switch c.Query("status") {
+	case "":
+	case "open":
+		filter.Completed = new(bool)
+	case "completed":
+		completed := true
+		filter.Completed = &completed
+	default:
+		problem.BadParameter(c, "status", "must be open or completed")
+		return filter, false
+	}
+
+	for _, param := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &filter.CreatedFrom}, {"to", &filter.CreatedTo}} {
+		v := c.Query(param.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if t, err = time.Parse(time.DateOnly, v); err == nil && param.name == "to" {
+				// A date as the upper bound includes that whole day
+				t = t.AddDate(0, 0, 1)
+			}
+		}
+		if err != nil {
+			problem.BadParameter(c, param.name, "must be a date such as 2024-03-01 or an RFC 3339 time")
+			return filter, false
+		}
+		*param.dst = t
+	}
+	if !filter.CreatedFrom.IsZero() && !filter.CreatedTo.IsZero() && !filter.CreatedFrom.Before(filter.CreatedTo) {
+		problem.BadParameter(c, "to", "must be after from")
+		return filter, false
+	}
+	return filter, true
 }
 
 // GetAllTodos handles GET /todos and returns all todo items.
@@ -85,13 +311,14 @@ func (h *TodoHandler) CreateTodo(c *gin.Context) {
 // @Tags todos
 // @Accept json
 // @Produce json
+// @Produce application/problem+json
 // @Success 200 {array} Todo
-// @Failure 500 {object} ErrorResponse
+// @Failure 500 {object} problem.Problem
 // @Router /todos [get]
 func (h *TodoHandler) GetAllTodos(c *gin.Context) {
-	todos, err := h.todoService.GetAllTodos()
+	todos, err := h.todoService.GetAllTodos(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		problem.Error(c, err)
 		return
 	}
 
@@ -104,30 +331,25 @@ func (h *TodoHandler) GetAllTodos(c *gin.Context) {
 // @Tags todos
 // @Accept json
 // @Produce json
+// @Produce application/problem+json
 // @Param id path int true "Todo ID"
 // @Success 200 {object} Todo
-// @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /todos/{id} [get]
 func (h *TodoHandler) GetTodoByID(c *gin.Context) {
 	// Parse the ID from the URL parameter and convert it to uint type
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid ID"})
+		problem.BadParameter(c, "id", "must be a positive integer")
 		return
 	}
 
-	todo, err := h.todoService.GetTodoByID(uint(id))
+	todo, err := h.todoService.GetTodoByID(c.Request.Context(), uint(id))
 	if err != nil {
-		switch {
-		case errors.Is(err, ErrNotFound):
-			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Todo not found"})
-			return
-		default:
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-			return
-		}
+		problem.Error(c, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, todo)
@@ -139,40 +361,32 @@ func (h *TodoHandler) GetTodoByID(c *gin.Context) {
 // @Tags todos
 // @Accept json
 // @Produce json
+// @Produce application/problem+json
 // @Param id path int true "Todo ID"
 // @Param request body UpdateTodoRequest true "Update Todo Request"
 // @Success 200 {object} Todo
-// @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 409 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /todos/{id} [put]
 func (h *TodoHandler) UpdateTodo(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid ID"})
+		problem.BadParameter(c, "id", "must be a positive integer")
 		return
 	}
 
 	req := new(UpdateTodoRequest)
-	if err := c.ShouldBindJSON(req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	if err := h.bindJSON(c, req); err != nil {
+		problem.BindError(c, err)
 		return
 	}
 
-	todo, err := h.todoService.UpdateTodo(uint(id), req)
+	todo, err := h.todoService.UpdateTodo(c.Request.Context(), uint(id), req)
 	if err != nil {
-		switch {
-		case errors.Is(err, ErrNotFound):
-			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Todo not found"})
-			return
-		case errors.Is(err, ErrTitleExists):
-			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
-			return
-		default:
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-			return
-		}
+		problem.Error(c, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, todo)
@@ -184,28 +398,23 @@ func (h *TodoHandler) UpdateTodo(c *gin.Context) {
 // @Tags todos
 // @Accept json
 // @Produce json
+// @Produce application/problem+json
 // @Param id path int true "Todo ID"
 // @Success 200 {object} MessageResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /todos/{id} [delete]
 func (h *TodoHandler) DeleteTodo(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid ID"})
+		problem.BadParameter(c, "id", "must be a positive integer")
 		return
 	}
 
-	if err := h.todoService.DeleteTodo(uint(id)); err != nil {
-		switch {
-		case errors.Is(err, ErrNotFound):
-			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Todo not found"})
-			return
-		default:
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-			return
-		}
+	if err := h.todoService.DeleteTodo(c.Request.Context(), uint(id)); err != nil {
+		problem.Error(c, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, MessageResponse{Message: "Todo deleted successfully"})
@@ -2,11 +2,14 @@ package todos
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/drago44/golang-todo-api/internal/problem"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -15,7 +18,7 @@ import (
 // Mock service for handler tests
 type mockTodoService struct{ mock.Mock }
 
-func (m *mockTodoService) CreateTodo(req *CreateTodoRequest) (*Todo, error) {
+func (m *mockTodoService) CreateTodo(_ context.Context, req *CreateTodoRequest) (*Todo, error) {
 	args := m.Called(req)
 	if v := args.Get(0); v != nil {
 		return v.(*Todo), args.Error(1)
@@ -24,12 +27,12 @@ func (m *mockTodoService) CreateTodo(req *CreateTodoRequest) (*Todo, error) {
 	return nil, args.Error(1)
 }
 
-func (m *mockTodoService) GetAllTodos() ([]Todo, error) {
+func (m *mockTodoService) GetAllTodos(_ context.Context) ([]Todo, error) {
 	args := m.Called()
 	return args.Get(0).([]Todo), args.Error(1)
 }
 
-func (m *mockTodoService) GetTodoByID(id uint) (*Todo, error) {
+func (m *mockTodoService) GetTodoByID(_ context.Context, id uint) (*Todo, error) {
 	args := m.Called(id)
 	if v := args.Get(0); v != nil {
 		return v.(*Todo), args.Error(1)
@@ -38,7 +41,7 @@ func (m *mockTodoService) GetTodoByID(id uint) (*Todo, error) {
 	return nil, args.Error(1)
 }
 
-func (m *mockTodoService) UpdateTodo(id uint, req *UpdateTodoRequest) (*Todo, error) {
+func (m *mockTodoService) UpdateTodo(_ context.Context, id uint, req *UpdateTodoRequest) (*Todo, error) {
 	args := m.Called(id, req)
 	if v := args.Get(0); v != nil {
 		return v.(*Todo), args.Error(1)
@@ -47,11 +50,39 @@ func (m *mockTodoService) UpdateTodo(id uint, req *UpdateTodoRequest) (*Todo, er
 	return nil, args.Error(1)
 }
 
-func (m *mockTodoService) DeleteTodo(id uint) error {
+func (m *mockTodoService) DeleteTodo(_ context.Context, id uint) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
 
+func (m *mockTodoService) ExportTodos(_ context.Context, filter TodoFilter, fn func(Todo) error) error {
+	args := m.Called(filter)
+	for _, todo := range args.Get(0).([]Todo) {
+		if err := fn(todo); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *mockTodoService) ListTodos(_ context.Context, filter TodoFilter, limit, offset int) ([]Todo, int64, error) {
+	args := m.Called(filter, limit, offset)
+	if v := args.Get(0); v != nil {
+		return v.([]Todo), args.Get(1).(int64), args.Error(2)
+	}
+
+	return nil, 0, args.Error(2)
+}
+
+func (m *mockTodoService) ImportTodos(_ context.Context, items []ImportItem, dryRun bool) (*ImportResponse, error) {
+	args := m.Called(items, dryRun)
+	if v := args.Get(0); v != nil {
+		return v.(*ImportResponse), args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
 func setupRouter(handler *TodoHandler) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
@@ -236,3 +267,118 @@ func TestDeleteTodo_Success(t *testing.T) {
 
 	mockSvc.AssertExpectations(t)
 }
+
+func TestCreateTodo_BadRequest_ProblemDetails(t *testing.T) {
+	mockSvc := new(mockTodoService)
+	h := NewTodoHandler(mockSvc)
+	r := setupRouter(h)
+
+	req := httptest.NewRequest(http.MethodPost, "/todos", bytes.NewReader([]byte(`{"description":"d"}`)))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	t.Logf("HTTP POST /todos (bad): status=%d resp=%s", w.Code, w.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+
+	var resp problem.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	assert.Equal(t, problem.CodeValidationFailed, resp.Code)
+	assert.Equal(t, "/todos", resp.Instance)
+	assert.Equal(t, []problem.FieldError{{Field: "title", Message: "is required"}}, resp.Errors)
+}
+
+func TestGetTodoByID_NotFound_ProblemCode(t *testing.T) {
+	mockSvc := new(mockTodoService)
+	h := NewTodoHandler(mockSvc)
+	r := setupRouter(h)
+
+	mockSvc.On("GetTodoByID", uint(2)).Return(nil, ErrNotFound).Once()
+
+	req := httptest.NewRequest(http.MethodGet, "/todos/2", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp problem.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	assert.Equal(t, http.StatusNotFound, resp.Status)
+	assert.Equal(t, CodeTodoNotFound, resp.Code)
+	assert.Equal(t, "/problems/"+CodeTodoNotFound, resp.Type)
+
+	mockSvc.AssertExpectations(t)
+}
+
+func TestGetAllTodos_InternalErrorIsNotEchoed(t *testing.T) {
+	mockSvc := new(mockTodoService)
+	h := NewTodoHandler(mockSvc)
+	r := setupRouter(h)
+
+	mockSvc.On("GetAllTodos").Return([]Todo(nil), errors.New("no such table: todos")).Once()
+
+	req := httptest.NewRequest(http.MethodGet, "/todos", nil)
+	req.Header.Set("X-Request-ID", "req-123")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	t.Logf("HTTP GET /todos (db error): status=%d resp=%s", w.Code, w.Body.String())
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "no such table")
+
+	var resp problem.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	assert.Equal(t, problem.CodeInternal, resp.Code)
+	assert.Equal(t, "req-123", resp.CorrelationID)
+
+	mockSvc.AssertExpectations(t)
+}
+
+func TestStrictJSON_RejectsUnknownFields(t *testing.T) {
+	mockSvc := new(mockTodoService)
+	lenient := setupRouter(NewTodoHandler(mockSvc))
+	strict := setupRouter(NewTodoHandler(mockSvc).WithStrictJSON())
+
+	body := `{"title":"A","priority":"high"}`
+	mockSvc.On("CreateTodo", &CreateTodoRequest{Title: "A"}).Return(&Todo{ID: 1, Title: "A"}, nil).Once()
+
+	post := func(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusCreated, post(lenient, http.MethodPost, "/todos", body).Code, "unknown fields are ignored by default")
+
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		path := "/todos"
+		if method == http.MethodPut {
+			path = "/todos/1"
+		}
+		w := post(strict, method, path, body)
+		t.Logf("strict %s %s: %d %s", method, path, w.Code, w.Body.String())
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var p problem.Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		assert.Equal(t, problem.CodeValidationFailed, p.Code)
+		assert.Equal(t, []problem.FieldError{{Field: "priority", Message: "is not a known field"}}, p.Errors)
+	}
+
+	// Known fields still bind and validate as usual
+	mockSvc.On("CreateTodo", &CreateTodoRequest{Title: "B"}).Return(&Todo{ID: 2, Title: "B"}, nil).Once()
+	assert.Equal(t, http.StatusCreated, post(strict, http.MethodPost, "/todos", `{"title":"B"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post(strict, http.MethodPost, "/todos", `{}`).Code)
+	mockSvc.AssertExpectations(t)
+}
@@ -0,0 +1,305 @@
+package todos
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/problem"
+)
+
+// Import file formats.
+const (
+	ImportCSV     = "csv"
+	ImportJSON    = "json"
+	ImportTodoTxt = "todotxt"
+)
+
+// MaxImportRows caps the number of todos a single import may create.
+const MaxImportRows = 1000
+
+// importFormat returns format if set, otherwise the format implied by the
+// file name extension.
+func importFormat(format, filename string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".csv":
+			format = ImportCSV
+		case ".json":
+			format = ImportJSON
+		case ".txt":
+			format = ImportTodoTxt
+		}
+	}
+	switch format {
+	case ImportCSV, ImportJSON, ImportTodoTxt:
+		return format, nil
+	case "":
+		return "", fmt.Errorf("%w: cannot tell the format of %q; set format to csv, json or todotxt", ErrImportFormat, filename)
+	default:
+		return "", fmt.Errorf("%w: %q (want csv, json or todotxt)", ErrImportFormat, format)
+	}
+}
+
+// parseImport reads the todos in r. Rows that cannot be read completely are
+// returned with their errors attached rather than failing the whole file.
+func parseImport(r io.Reader, format, mapping string) ([]ImportItem, error) {
+	switch format {
+	case ImportCSV:
+		return parseCSV(r, mapping)
+	case ImportJSON:
+		return parseJSON(r)
+	default:
+		return parseTodoTxt(r)
+	}
+}
+
+// csvColumns are the todo fields a CSV column can be mapped to.
+var csvColumns = []string{"title", "description", "completed"}
+
+// parseCSVMapping parses a mapping such as title=Name,completed=Done into
+// field to header name. Fields left out map to a column of their own name.
+func parseCSVMapping(mapping string) (map[string]string, error) {
+	m := make(map[string]string, len(csvColumns))
+	for _, field := range csvColumns {
+		m[field] = field
+	}
+	for _, entry := range strings.Split(mapping, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		field, column, ok := strings.Cut(entry, "=")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || column == "" {
+			return nil, fmt.Errorf("%w: %q is not field=column", ErrImportMapping, strings.TrimSpace(entry))
+		}
+		if _, known := m[field]; !known {
+			return nil, fmt.Errorf("%w: unknown field %q (want title, description or completed)", ErrImportMapping, field)
+		}
+		m[field] = column
+	}
+	return m, nil
+}
+
+// parseCSV reads a CSV file with a header row, picking columns by mapping.
+func parseCSV(r io.Reader, mapping string) ([]ImportItem, error) {
+	columns, err := parseCSVMapping(mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: the file has no header row", ErrImportFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrImportFile, err)
+	}
+
+	// Header names match case-insensitively; a spreadsheet may prefix a BOM
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	pos := make(map[string]int, len(columns))
+	for field, column := range columns {
+		i, ok := index[strings.ToLower(column)]
+		if !ok {
+			if field != "title" && column == field {
+				// Optional columns may be absent unless mapped explicitly
+				continue
+			}
+			return nil, fmt.Errorf("%w: the header has no column %q for %s", ErrImportMapping, column, field)
+		}
+		pos[field] = i
+	}
+	value := func(record []string, field string) string {
+		i, ok := pos[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var items []ImportItem
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return items, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrImportFile, err)
+		}
+		if len(items) == MaxImportRows {
+			return nil, fmt.Errorf("%w: more than %d", ErrImportTooMany, MaxImportRows)
+		}
+
+		line, _ := reader.FieldPos(0)
+		item := ImportItem{Row: line, Title: value(record, "title"), Description: value(record, "description")}
+		completed, ok := parseCompleted(value(record, "completed"))
+		if !ok {
+			item.invalid = append(item.invalid, problem.FieldError{
+				Field:   importField(line, "completed"),
+				Message: "must be true, false, yes, no, 1, 0, x or done",
+			})
+		}
+		item.Completed = completed
+		items = append(items, item)
+	}
+}
+
+// parseCompleted reads a spreadsheet-style boolean; blank means false.
+func parseCompleted(v string) (completed, ok bool) {
+	switch strings.ToLower(v) {
+	case "", "false", "no", "n", "0":
+		return false, true
+	case "true", "yes", "y", "1", "x", "done":
+		return true, true
+	}
+	return false, false
+}
+
+// parseJSON reads a JSON array of CreateTodoRequest.
+func parseJSON(r io.Reader) ([]ImportItem, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: not a JSON array of todos: %v", ErrImportFile, err)
+	}
+	if len(raw) > MaxImportRows {
+		return nil, fmt.Errorf("%w: more than %d", ErrImportTooMany, MaxImportRows)
+	}
+
+	items := make([]ImportItem, 0, len(raw))
+	for i, msg := range raw {
+		row := i + 1
+		var req CreateTodoRequest
+		item := ImportItem{Row: row}
+		if err := json.Unmarshal(msg, &req); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) && typeErr.Field != "" {
+				item.invalid = []problem.FieldError{{Field: importField(row, typeErr.Field), Message: "must be of type " + typeErr.Type.String()}}
+			} else {
+				item.invalid = []problem.FieldError{{Field: fmt.Sprintf("rows[%d]", row), Message: "must be an object"}}
+			}
+		}
+		item.Title, item.Description = req.Title, req.Description
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// parseTodoTxt reads a todo.txt file, one task per line.
+func parseTodoTxt(r io.Reader) ([]ImportItem, error) {
+	var items []ImportItem
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if len(items) == MaxImportRows {
+			return nil, fmt.Errorf("%w: more than %d", ErrImportTooMany, MaxImportRows)
+		}
+		item := parseTodoTxtLine(text)
+		item.Row = line
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrImportFile, err)
+	}
+	return items, nil
+}
+
+// parseTodoTxtLine parses a task such as
+//
+//	(A) 2024-03-01 Call mom +Family @phone due:2024-03-05
+//	x 2024-03-02 2024-03-01 Call mom +Family @phone
+//
+// Todos have no fields for priorities, projects, contexts, dates or
+// key:value tags, so they are taken out of the title and listed in the
+// description instead, one "Name: value" per line.
+func parseTodoTxtLine(text string) ImportItem {
+	var (
+		item                            ImportItem
+		priority, created, closed       string
+		words, projects, contexts, tags []string
+	)
+	tokens := strings.Fields(text)
+	if len(tokens) > 0 && tokens[0] == "x" {
+		item.Completed = true
+		tokens = tokens[1:]
+		if len(tokens) > 0 && isTodoTxtDate(tokens[0]) {
+			closed, tokens = tokens[0], tokens[1:]
+		}
+	} else if len(tokens) > 0 && isTodoTxtPriority(tokens[0]) {
+		priority, tokens = tokens[0][1:2], tokens[1:]
+	}
+	if len(tokens) > 0 && isTodoTxtDate(tokens[0]) {
+		created, tokens = tokens[0], tokens[1:]
+	}
+
+	for _, tok := range tokens {
+		key, value, isTag := strings.Cut(tok, ":")
+		switch {
+		case len(tok) > 1 && tok[0] == '+':
+			projects = append(projects, tok[1:])
+		case len(tok) > 1 && tok[0] == '@':
+			contexts = append(contexts, tok[1:])
+		case isTag && key != "" && value != "" && !strings.HasPrefix(value, "//"):
+			if key == "pri" && priority == "" {
+				// Completed tasks keep their priority as pri:A
+				priority = value
+				continue
+			}
+			tags = append(tags, key+": "+value)
+		default:
+			words = append(words, tok)
+		}
+	}
+
+	item.Title = strings.Join(words, " ")
+	if item.Title == "" {
+		// A task made only of projects and contexts keeps them as its title
+		item.Title = strings.Join(tokens, " ")
+	}
+
+	var desc []string
+	if priority != "" {
+		desc = append(desc, "Priority: "+priority)
+	}
+	if len(projects) > 0 {
+		desc = append(desc, "Projects: "+strings.Join(projects, ", "))
+	}
+	if len(contexts) > 0 {
+		desc = append(desc, "Contexts: "+strings.Join(contexts, ", "))
+	}
+	if created != "" {
+		desc = append(desc, "Created: "+created)
+	}
+	if closed != "" {
+		desc = append(desc, "Completed: "+closed)
+	}
+	item.Description = strings.Join(append(desc, tags...), "\n")
+	return item
+}
+
+func isTodoTxtDate(tok string) bool {
+	_, err := time.Parse(time.DateOnly, tok)
+	return err == nil
+}
+
+func isTodoTxtPriority(tok string) bool {
+	return len(tok) == 3 && tok[0] == '(' && tok[1] >= 'A' && tok[1] <= 'Z' && tok[2] == ')'
+}
@@ -0,0 +1,184 @@
+package todos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/problem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImport_CSV(t *testing.T) {
+	file := "\ufeffName,Notes,Status\nBuy milk,2 litres,done\n\"Call, mom\",,\nFix bike,,maybe\n"
+	items, err := parseImport(strings.NewReader(file), ImportCSV, "title=name, description=Notes, completed=Status")
+	require.NoError(t, err)
+	t.Logf("items: %+v", items)
+
+	require.Len(t, items, 3)
+	assert.Equal(t, ImportItem{Row: 2, Title: "Buy milk", Description: "2 litres", Completed: true}, items[0])
+	assert.Equal(t, "Call, mom", items[1].Title)
+	assert.Equal(t, 3, items[1].Row)
+	assert.Equal(t, []problem.FieldError{{Field: "rows[4].completed", Message: "must be true, false, yes, no, 1, 0, x or done"}}, items[2].invalid)
+
+	// Unmapped optional columns may be missing; mapped ones may not
+	items, err = parseImport(strings.NewReader("Title\nA\n"), ImportCSV, "")
+	require.NoError(t, err)
+	assert.Len(t, items, 1)
+	for _, mapping := range []string{"title=Name", "colour=Title", "title"} {
+		_, err = parseImport(strings.NewReader("Title\nA\n"), ImportCSV, mapping)
+		t.Logf("%q: %v", mapping, err)
+		assert.ErrorIs(t, err, ErrImportMapping, mapping)
+	}
+
+	_, err = parseImport(strings.NewReader("title\n\"unterminated\n"), ImportCSV, "")
+	assert.ErrorIs(t, err, ErrImportFile)
+}
+
+func TestParseImport_JSON(t *testing.T) {
+	items, err := parseImport(strings.NewReader(`[{"title":"A","description":"a"},{"title":5},"B"]`), ImportJSON, "")
+	require.NoError(t, err)
+	t.Logf("items: %+v", items)
+
+	require.Len(t, items, 3)
+	assert.Equal(t, ImportItem{Row: 1, Title: "A", Description: "a"}, items[0])
+	assert.Equal(t, []problem.FieldError{{Field: "rows[2].title", Message: "must be of type string"}}, items[1].invalid)
+	assert.Equal(t, []problem.FieldError{{Field: "rows[3]", Message: "must be an object"}}, items[2].invalid)
+
+	_, err = parseImport(strings.NewReader(`{"title":"A"}`), ImportJSON, "")
+	assert.ErrorIs(t, err, ErrImportFile)
+}
+
+func TestParseTodoTxtLine(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want ImportItem
+	}{
+		{"Water plants", ImportItem{Title: "Water plants"}},
+		{
+			"(A) 2024-03-01 Call mom +Family @phone due:2024-03-05",
+			ImportItem{Title: "Call mom", Description: "Priority: A\nProjects: Family\nContexts: phone\nCreated: 2024-03-01\ndue: 2024-03-05"},
+		},
+		{
+			"x 2024-03-02 2024-03-01 Pay rent +Home pri:B",
+			ImportItem{Title: "Pay rent", Description: "Priority: B\nProjects: Home\nCreated: 2024-03-01\nCompleted: 2024-03-02", Completed: true},
+		},
+		{"x Read https://example.com/x", ImportItem{Title: "Read https://example.com/x", Completed: true}},
+		{"(a) lower case is not a priority", ImportItem{Title: "(a) lower case is not a priority"}},
+		{"+Garden @home", ImportItem{Title: "+Garden @home", Description: "Projects: Garden\nContexts: home"}},
+	} {
+		got := parseTodoTxtLine(tc.line)
+		t.Logf("%q: %+v", tc.line, got)
+		assert.Equal(t, tc.want, got, tc.line)
+	}
+
+	items, err := parseImport(strings.NewReader("A\n\nx B\n"), ImportTodoTxt, "")
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, 3, items[1].Row, "rows are line numbers, blank lines included")
+}
+
+func TestImportFormat(t *testing.T) {
+	for filename, want := range map[string]string{"todos.CSV": ImportCSV, "todos.json": ImportJSON, "todo.txt": ImportTodoTxt} {
+		format, err := importFormat("", filename)
+		require.NoError(t, err)
+		assert.Equal(t, want, format, filename)
+	}
+	format, err := importFormat(ImportTodoTxt, "export.dat")
+	require.NoError(t, err)
+	assert.Equal(t, ImportTodoTxt, format)
+
+	for _, tc := range [][2]string{{"", "export.dat"}, {"xml", "todos.xml"}} {
+		_, err := importFormat(tc[0], tc[1])
+		assert.ErrorIs(t, err, ErrImportFormat)
+	}
+}
+
+// TestImportTodos_Handler runs dry runs and imports end to end against the
+// memory repository.
+func TestImportTodos_Handler(t *testing.T) {
+	repo := NewMemoryTodoRepository(logging.Discard())
+	service := NewTodoService(repo, logging.Discard())
+	_, err := service.CreateTodo(context.Background(), &CreateTodoRequest{Title: "Existing"})
+	require.NoError(t, err)
+	r := setupRouter(NewTodoHandler(service))
+
+	upload := func(filename, content string, fields map[string]string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for k, v := range fields {
+			require.NoError(t, mw.WriteField(k, v))
+		}
+		fw, err := mw.CreateFormFile("file", filename)
+		require.NoError(t, err)
+		_, _ = fw.Write([]byte(content))
+		require.NoError(t, mw.Close())
+
+		req := httptest.NewRequest(http.MethodPost, "/todos/import", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		t.Logf("POST /todos/import %s %v: status=%d resp=%s", filename, fields, w.Code, w.Body.String())
+		return w
+	}
+	count := func() int {
+		all, err := service.GetAllTodos(context.Background())
+		require.NoError(t, err)
+		return len(all)
+	}
+
+	bad := "(A) Plan trip +Travel\nExisting\n\nPlan trip\nx +Done\n"
+	wantErrs := []problem.FieldError{
+		{Field: "rows[2].title", Message: "already exists"},
+		{Field: "rows[4].title", Message: "duplicates row 1"},
+	}
+
+	// A dry run reports every problem and previews the todos
+	w := upload("todo.txt", bad, map[string]string{"dry_run": "true"})
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp ImportResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.DryRun)
+	assert.Equal(t, 4, resp.Total)
+	assert.Equal(t, wantErrs, resp.Errors)
+	require.Len(t, resp.Preview, 4)
+	assert.Equal(t, ImportItem{Row: 5, Title: "+Done", Description: "Projects: Done", Completed: true}, resp.Preview[3])
+	assert.Equal(t, 1, count())
+
+	// Importing the same file creates nothing
+	w = upload("todo.txt", bad, nil)
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var p problem.Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, CodeImportRejected, p.Code)
+	assert.Equal(t, wantErrs, p.Errors)
+	assert.Equal(t, 1, count())
+
+	// A clean file is created in full
+	w = upload("todos.csv", "Name,Done\nA,yes\nB,\n", map[string]string{"mapping": "title=Name,completed=Done"})
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Created)
+	require.Len(t, resp.Todos, 2)
+	assert.True(t, resp.Todos[0].Completed)
+	assert.NotZero(t, resp.Todos[1].ID)
+	assert.Equal(t, 3, count())
+
+	// Unknown formats and missing files are rejected up front
+	w = upload("todos.xml", "<todos/>", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), CodeImportFormat)
+
+	req := httptest.NewRequest(http.MethodPost, "/todos/import", strings.NewReader(""))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
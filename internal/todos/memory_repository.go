@@ -0,0 +1,313 @@
+package todos
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// errDuplicateID mirrors a primary key violation when a caller picks the ID.
+var errDuplicateID = errors.New("todo with this id already exists")
+
+// memoryTodoRepository keeps todos in process memory. It mirrors the GORM
+// repository: soft deletes, unique titles among live todos and change tokens.
+type memoryTodoRepository struct {
+	logger *slog.Logger
+
+	mu      sync.RWMutex
+	todos   map[uint]*Todo
+	lastID  uint
+	lastSeq uint64
+}
+
+// NewMemoryTodoRepository creates an empty in-memory TodoRepository. Data is
+// lost when the process exits.
+func NewMemoryTodoRepository(logger *slog.Logger) TodoRepository {
+	return &memoryTodoRepository{
+		logger: logger.With("component", "todo_repository"),
+		todos:  make(map[uint]*Todo),
+	}
+}
+
+// WithinTx runs fn against a copy of the store while holding the write lock,
+// and keeps the copy only if fn succeeds. Stored todos are never mutated in
+// place, so copying the map is enough.
+func (r *memoryTodoRepository) WithinTx(ctx context.Context, fn func(repo TodoRepository) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tx := &memoryTodoRepository{
+		logger:  r.logger,
+		todos:   maps.Clone(r.todos),
+		lastID:  r.lastID,
+		lastSeq: r.lastSeq,
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	r.todos, r.lastID, r.lastSeq = tx.todos, tx.lastID, tx.lastSeq
+	return nil
+}
+
+func (r *memoryTodoRepository) Create(ctx context.Context, todo *Todo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if todo.ID != 0 {
+		if _, taken := r.todos[todo.ID]; taken {
+			return errDuplicateID
+		}
+	}
+	if r.titleTaken(todo.Title, todo.ID) {
+		return ErrTitleExists
+	}
+
+	if todo.ID == 0 {
+		todo.ID = r.lastID + 1
+	}
+	r.lastID = max(r.lastID, todo.ID)
+
+	now := time.Now()
+	if todo.CreatedAt.IsZero() {
+		todo.CreatedAt = now
+	}
+	if todo.UpdatedAt.IsZero() {
+		todo.UpdatedAt = now
+	}
+	r.store(todo)
+
+	r.logger.DebugContext(ctx, "todo row inserted", "todo_id", todo.ID, "change_seq", todo.ChangeSeq)
+	return nil
+}
+
+func (r *memoryTodoRepository) GetAll(ctx context.Context) ([]Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	todos := make([]Todo, 0, len(r.todos))
+	for _, todo := range r.todos {
+		if !todo.DeletedAt.Valid {
+			todos = append(todos, cloneTodo(todo))
+		}
+	}
+	sort.Slice(todos, func(i, j int) bool { return todos[i].ID < todos[j].ID })
+	return todos, nil
+}
+
+func (r *memoryTodoRepository) GetByID(ctx context.Context, id uint) (*Todo, error) {
+	return r.get(ctx, id, false)
+}
+
+func (r *memoryTodoRepository) GetByIDUnscoped(ctx context.Context, id uint) (*Todo, error) {
+	return r.get(ctx, id, true)
+}
+
+func (r *memoryTodoRepository) get(ctx context.Context, id uint, unscoped bool) (*Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	todo, ok := r.todos[id]
+	if !ok || (todo.DeletedAt.Valid && !unscoped) {
+		return nil, ErrNotFound
+	}
+	clone := cloneTodo(todo)
+	return &clone, nil
+}
+
+func (r *memoryTodoRepository) ExistsByTitle(ctx context.Context, title string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.titleTaken(title, 0), nil
+}
+
+func (r *memoryTodoRepository) Update(ctx context.Context, todo *Todo) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.todos[todo.ID]
+	if !ok || existing.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	if r.titleTaken(todo.Title, todo.ID) {
+		return ErrTitleExists
+	}
+
+	todo.UpdatedAt = time.Now()
+	todo.DeletedAt = gorm.DeletedAt{}
+	r.store(todo)
+
+	r.logger.DebugContext(ctx, "todo row updated", "todo_id", todo.ID, "change_seq", todo.ChangeSeq)
+	return nil
+}
+
+func (r *memoryTodoRepository) Delete(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	todo, ok := r.todos[id]
+	if !ok || todo.DeletedAt.Valid {
+		return ErrNotFound
+	}
+
+	deleted := cloneTodo(todo)
+	deleted.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	r.store(&deleted)
+
+	r.logger.DebugContext(ctx, "todo row soft-deleted", "todo_id", id, "change_seq", deleted.ChangeSeq)
+	return nil
+}
+
+func (r *memoryTodoRepository) ChangesSince(ctx context.Context, since uint64, limit int) ([]Todo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var todos []Todo
+	for _, todo := range r.todos {
+		if todo.ChangeSeq > since {
+			todos = append(todos, cloneTodo(todo))
+		}
+	}
+	sort.Slice(todos, func(i, j int) bool { return todos[i].ChangeSeq < todos[j].ChangeSeq })
+	if len(todos) > limit {
+		todos = todos[:limit]
+	}
+	return todos, nil
+}
+
+func (r *memoryTodoRepository) LatestChangeSeq(ctx context.Context) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.lastSeq, nil
+}
+
+func (r *memoryTodoRepository) CountByStatus(ctx context.Context) (TodoCounts, error) {
+	if err := ctx.Err(); err != nil {
+		return TodoCounts{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var counts TodoCounts
+	for _, todo := range r.todos {
+		switch {
+		case todo.DeletedAt.Valid:
+		case todo.Completed:
+			counts.Completed++
+		default:
+			counts.Open++
+		}
+	}
+	return counts, nil
+}
+
+// Each copies the matching todos under the read lock and calls fn after
+// releasing it, so a slow fn does not block writers.
+func (r *memoryTodoRepository) Each(ctx context.Context, filter TodoFilter, fn func(Todo) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	var todos []Todo
+	for _, todo := range r.todos {
+		if !todo.DeletedAt.Valid && filter.matches(todo) {
+			todos = append(todos, cloneTodo(todo))
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(todos, func(i, j int) bool { return todos[i].ID < todos[j].ID })
+	for _, todo := range todos {
+		if err := fn(todo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryTodoRepository) List(ctx context.Context, filter TodoFilter, limit, offset int) ([]Todo, int64, error) {
+	var matched []Todo
+	if err := r.Each(ctx, filter, func(todo Todo) error {
+		matched = append(matched, todo)
+		return nil
+	}); err != nil {
+		return nil, 0, err
+	}
+
+	total := int64(len(matched))
+	matched = matched[min(offset, len(matched)):]
+	return append([]Todo{}, matched[:min(limit, len(matched))]...), total, nil
+}
+
+// titleTaken reports whether a live todo other than id has the title.
+// Callers must hold r.mu.
+func (r *memoryTodoRepository) titleTaken(title string, id uint) bool {
+	for _, todo := range r.todos {
+		if todo.ID != id && !todo.DeletedAt.Valid && todo.Title == title {
+			return true
+		}
+	}
+	return false
+}
+
+// store assigns the next change token to todo and saves a copy, so callers
+// cannot mutate stored state. Callers must hold r.mu for writing.
+func (r *memoryTodoRepository) store(todo *Todo) {
+	r.lastSeq++
+	todo.ChangeSeq = r.lastSeq
+
+	clone := cloneTodo(todo)
+	r.todos[todo.ID] = &clone
+}
+
+// cloneTodo copies todo including its FieldClocks map.
+func cloneTodo(todo *Todo) Todo {
+	clone := *todo
+	clone.FieldClocks = maps.Clone(todo.FieldClocks)
+	return clone
+}
@@ -1,10 +1,15 @@
 package todos
 
-import "go.uber.org/dig"
+import (
+	"log/slog"
+
+	"go.uber.org/dig"
+	"gorm.io/gorm"
+)
 
 // Module provides the todos module dependencies to the DI container.
 func Module(c *dig.Container) error {
-	if err := c.Provide(NewTodoRepository); err != nil {
+	if err := c.Provide(newTodoRepository); err != nil {
 		return err
 	}
 
@@ -12,9 +17,30 @@ func Module(c *dig.Container) error {
 		return err
 	}
 
+	if err := c.Decorate(WithTracing); err != nil {
+		return err
+	}
+
 	if err := c.Provide(NewTodoHandler); err != nil {
 		return err
 	}
 
+	if err := c.Provide(NewSyncService); err != nil {
+		return err
+	}
+
+	if err := c.Provide(NewSyncHandler); err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// newTodoRepository picks the storage backend. db is nil when DATABASE_URL is
+// memory://.
+func newTodoRepository(db *gorm.DB, logger *slog.Logger) TodoRepository {
+	if db == nil {
+		return NewMemoryTodoRepository(logger)
+	}
+	return NewTodoRepository(db, logger)
+}
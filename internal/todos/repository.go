@@ -1,43 +1,133 @@
 package todos
 
 import (
+	"context"
 	"errors"
+	"log/slog"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+// TxManager runs several repository calls as one unit of work.
+type TxManager interface {
+	// WithinTx calls fn with a TodoRepository bound to a transaction, which
+	// commits when fn returns nil and rolls back otherwise. fn must only use
+	// the repository it is given.
+	WithinTx(ctx context.Context, fn func(repo TodoRepository) error) error
+}
+
 // TodoRepository defines persistence operations for Todo entities.
 type TodoRepository interface {
-	Create(todo *Todo) error
-	GetAll() ([]Todo, error)
-	GetByID(id uint) (*Todo, error)
-	ExistsByTitle(title string) (bool, error)
-	Update(todo *Todo) error
-	Delete(id uint) error
+	TxManager
+	Create(ctx context.Context, todo *Todo) error
+	GetAll(ctx context.Context) ([]Todo, error)
+	GetByID(ctx context.Context, id uint) (*Todo, error)
+	GetByIDUnscoped(ctx context.Context, id uint) (*Todo, error)
+	ExistsByTitle(ctx context.Context, title string) (bool, error)
+	Update(ctx context.Context, todo *Todo) error
+	Delete(ctx context.Context, id uint) error
+	ChangesSince(ctx context.Context, since uint64, limit int) ([]Todo, error)
+	LatestChangeSeq(ctx context.Context) (uint64, error)
+	CountByStatus(ctx context.Context) (TodoCounts, error)
+	// Each calls fn for every live todo matching filter in ID order, reading
+	// rows in batches rather than all at once. It stops at the first error
+	// from fn and returns it.
+	Each(ctx context.Context, filter TodoFilter, fn func(Todo) error) error
+	// List returns up to limit live todos matching filter in ID order,
+	// skipping the first offset, and the total number of matches.
+	List(ctx context.Context, filter TodoFilter, limit, offset int) ([]Todo, int64, error)
+}
+
+// TodoFilter selects live todos by completion status and creation time.
+type TodoFilter struct {
+	// Completed, when set, matches only todos with that status
+	Completed *bool
+	// CreatedFrom and CreatedTo bound created_at to [CreatedFrom, CreatedTo);
+	// a zero time leaves that side open
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// Search, when non-empty, matches todos whose title or description
+	// contains it, ignoring case
+	Search string
+}
+
+// matches reports whether the live todo passes the filter.
+func (f TodoFilter) matches(todo *Todo) bool {
+	switch {
+	case f.Completed != nil && todo.Completed != *f.Completed:
+		return false
+	case !f.CreatedFrom.IsZero() && todo.CreatedAt.Before(f.CreatedFrom):
+		return false
+	case !f.CreatedTo.IsZero() && !todo.CreatedAt.Before(f.CreatedTo):
+		return false
+	case f.Search != "" && !containsFold(todo.Title, f.Search) && !containsFold(todo.Description, f.Search):
+		return false
+	}
+	return true
+}
+
+// containsFold reports whether substr is within s, ignoring case.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// eachBatchSize is the number of rows Each reads per query.
+const eachBatchSize = 500
+
+// TodoCounts holds the number of live todos by completion status.
+type TodoCounts struct {
+	Open      int64
+	Completed int64
 }
 
 type todoRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	logger *slog.Logger
 }
 
 // NewTodoRepository creates a GORM-backed TodoRepository.
-func NewTodoRepository(db *gorm.DB) TodoRepository {
-	return &todoRepository{db: db}
+func NewTodoRepository(db *gorm.DB, logger *slog.Logger) TodoRepository {
+	return &todoRepository{db: db, logger: logger.With("component", "todo_repository")}
 }
 
-func (r *todoRepository) Create(todo *Todo) error {
-	return r.db.Create(todo).Error
+func (r *todoRepository) WithinTx(ctx context.Context, fn func(repo TodoRepository) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&todoRepository{db: tx, logger: r.logger})
+	})
+}
+
+func (r *todoRepository) Create(ctx context.Context, todo *Todo) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(todo).Error; err != nil {
+			return translateError(tx, err)
+		}
+		return bumpChangeSeq(tx, todo)
+	})
+	if err == nil {
+		r.logger.DebugContext(ctx, "todo row inserted", "todo_id", todo.ID, "change_seq", todo.ChangeSeq)
+	}
+	return err
 }
 
-func (r *todoRepository) GetAll() ([]Todo, error) {
+func (r *todoRepository) GetAll(ctx context.Context) ([]Todo, error) {
 	var todos []Todo
-	err := r.db.Find(&todos).Error
+	err := r.db.WithContext(ctx).Order("id").Find(&todos).Error
 	return todos, err
 }
 
-func (r *todoRepository) GetByID(id uint) (*Todo, error) {
+func (r *todoRepository) GetByID(ctx context.Context, id uint) (*Todo, error) {
+	return getByID(r.db.WithContext(ctx), id)
+}
+
+func (r *todoRepository) GetByIDUnscoped(ctx context.Context, id uint) (*Todo, error) {
+	return getByID(r.db.WithContext(ctx).Unscoped(), id)
+}
+
+func getByID(db *gorm.DB, id uint) (*Todo, error) {
 	var todo Todo
-	err := r.db.First(&todo, id).Error
+	err := db.First(&todo, id).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, ErrNotFound
@@ -47,9 +137,9 @@ func (r *todoRepository) GetByID(id uint) (*Todo, error) {
 	return &todo, nil
 }
 
-func (r *todoRepository) ExistsByTitle(title string) (bool, error) {
+func (r *todoRepository) ExistsByTitle(ctx context.Context, title string) (bool, error) {
 	var todo Todo
-	res := r.db.Model(&Todo{}).
+	res := r.db.WithContext(ctx).Model(&Todo{}).
 		Select("id").
 		Where("title = ?", title).
 		Limit(1).
@@ -64,18 +154,158 @@ func (r *todoRepository) ExistsByTitle(title string) (bool, error) {
 	return true, nil
 }
 
-func (r *todoRepository) Update(todo *Todo) error {
-	return r.db.Save(todo).Error
+func (r *todoRepository) Update(ctx context.Context, todo *Todo) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Unlike Save, this never inserts: missing and soft-deleted rows are
+		// not found rather than recreated
+		res := tx.Model(todo).Select("*").Updates(todo)
+		if res.Error != nil {
+			return translateError(tx, res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return bumpChangeSeq(tx, todo)
+	})
+	if err == nil {
+		r.logger.DebugContext(ctx, "todo row updated", "todo_id", todo.ID, "change_seq", todo.ChangeSeq)
+	}
+	return err
 }
 
-func (r *todoRepository) Delete(id uint) error {
-	var todo Todo
-	res := r.db.Delete(&todo, id)
-	if res.Error != nil {
-		return res.Error
+func (r *todoRepository) Delete(ctx context.Context, id uint) error {
+	todo := Todo{ID: id}
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&todo)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return bumpChangeSeq(tx, &todo)
+	})
+	if err == nil {
+		r.logger.DebugContext(ctx, "todo row soft-deleted", "todo_id", id, "change_seq", todo.ChangeSeq)
 	}
-	if res.RowsAffected == 0 {
-		return ErrNotFound
+	return err
+}
+
+func (r *todoRepository) ChangesSince(ctx context.Context, since uint64, limit int) ([]Todo, error) {
+	var todos []Todo
+	err := r.db.WithContext(ctx).Unscoped().
+		Where("change_seq > ?", since).
+		Order("change_seq").
+		Limit(limit).
+		Find(&todos).Error
+	return todos, err
+}
+
+func (r *todoRepository) LatestChangeSeq(ctx context.Context) (uint64, error) {
+	var seq uint64
+	err := r.db.WithContext(ctx).Unscoped().Model(&Todo{}).
+		Select("COALESCE(MAX(change_seq), 0)").
+		Scan(&seq).Error
+	return seq, err
+}
+
+func (r *todoRepository) CountByStatus(ctx context.Context) (TodoCounts, error) {
+	var rows []struct {
+		Completed bool
+		Count     int64
+	}
+	err := r.db.WithContext(ctx).Model(&Todo{}).
+		Select("completed, COUNT(*) AS count").
+		Group("completed").
+		Scan(&rows).Error
+	if err != nil {
+		return TodoCounts{}, err
+	}
+
+	var counts TodoCounts
+	for _, row := range rows {
+		if row.Completed {
+			counts.Completed = row.Count
+		} else {
+			counts.Open = row.Count
+		}
+	}
+	return counts, nil
+}
+
+func (r *todoRepository) Each(ctx context.Context, filter TodoFilter, fn func(Todo) error) error {
+	q := filtered(r.db.WithContext(ctx), filter)
+
+	// Batches are keyed on the primary key, so no connection is held while
+	// fn writes to a slow client
+	var batch []Todo
+	return q.FindInBatches(&batch, eachBatchSize, func(*gorm.DB, int) error {
+		for _, todo := range batch {
+			if err := fn(todo); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+func (r *todoRepository) List(ctx context.Context, filter TodoFilter, limit, offset int) ([]Todo, int64, error) {
+	var total int64
+	if err := filtered(r.db.WithContext(ctx), filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	todos := []Todo{}
+	err := filtered(r.db.WithContext(ctx), filter).Order("id").Limit(limit).Offset(offset).Find(&todos).Error
+	return todos, total, err
+}
+
+// likeEscaper escapes LIKE wildcards with '!', which, unlike a backslash,
+// needs no quoting in any supported dialect's string literals.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// filtered returns a query over the live todos matching filter.
+func filtered(db *gorm.DB, filter TodoFilter) *gorm.DB {
+	q := db.Model(&Todo{})
+	if filter.Completed != nil {
+		q = q.Where("completed = ?", *filter.Completed)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		q = q.Where("created_at >= ?", filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		q = q.Where("created_at < ?", filter.CreatedTo)
+	}
+	if filter.Search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(filter.Search)) + "%"
+		q = q.Where("(LOWER(title) LIKE ? ESCAPE '!' OR LOWER(description) LIKE ? ESCAPE '!')", pattern, pattern)
+	}
+	return q
+}
+
+// bumpChangeSeq assigns the next change token to the todo row, including
+// soft-deleted rows so tombstones are visible to sync clients. Incrementing the
+// counter row locks it until the transaction ends, so concurrent writers never
+// observe a duplicate value on any dialect.
+func bumpChangeSeq(tx *gorm.DB, todo *Todo) error {
+	if err := tx.Exec("UPDATE todo_change_seq SET last_seq = last_seq + 1 WHERE id = 1").Error; err != nil {
+		return err
+	}
+	if err := tx.Raw("SELECT last_seq FROM todo_change_seq WHERE id = 1").Scan(&todo.ChangeSeq).Error; err != nil {
+		return err
+	}
+
+	return tx.Unscoped().Model(&Todo{}).
+		Where("id = ?", todo.ID).
+		UpdateColumn("change_seq", todo.ChangeSeq).Error
+}
+
+// translateError maps a unique index violation to ErrTitleExists. The live
+// title index is the only unique constraint a write can hit, and it closes
+// the race between ExistsByTitle and the write.
+func translateError(db *gorm.DB, err error) error {
+	if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok && errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey) {
+		return ErrTitleExists
 	}
-	return nil
+	return err
 }
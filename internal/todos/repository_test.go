@@ -1,76 +1,405 @@
 package todos
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/drago44/golang-todo-api/internal/cache"
+	"github.com/drago44/golang-todo-api/internal/dbtest"
+	"github.com/drago44/golang-todo-api/internal/logging"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
+	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
 )
 
-func createTestDB(t *testing.T) *gorm.DB {
-	t.Helper()
-
-	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
-	if err != nil {
-		t.Fatalf("failed to open sqlite memory: %v", err)
-	}
+// repositoryContract is the behaviour every TodoRepository implementation
+// must share. Each case gets a fresh, empty repository.
+var repositoryContract = []struct {
+	name string
+	run  func(t *testing.T, repo TodoRepository)
+}{
+	{"CRUD", testRepositoryCRUD},
+	{"CountByStatus", testRepositoryCountByStatus},
+	{"Each", testRepositoryEach},
+	{"List", testRepositoryList},
+	{"TitleUniqueAmongLiveTodos", testRepositoryTitleUniqueAmongLiveTodos},
+	{"NotFound", testRepositoryNotFound},
+	{"ChangesIncludeTombstones", testRepositoryChangesIncludeTombstones},
+	{"ConcurrentWritesGetDistinctChangeSeqs", testRepositoryConcurrentWritesGetDistinctChangeSeqs},
+	{"WithinTx", testRepositoryWithinTx},
+}
 
-	if err := db.AutoMigrate(&Todo{}); err != nil {
-		t.Fatalf("failed to migrate: %v", err)
+// TestTodoRepository_Contract runs the contract against the in-memory
+// repository, the cache decorator and the GORM repository on every
+// available dialect.
+func TestTodoRepository_Contract(t *testing.T) {
+	for _, tc := range repositoryContract {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Run("memory", func(t *testing.T) {
+				tc.run(t, NewMemoryTodoRepository(logging.Discard()))
+			})
+			t.Run("cached", func(t *testing.T) {
+				tc.run(t, WithCache(NewMemoryTodoRepository(logging.Discard()), cache.NewLRU(100), time.Minute, logging.Discard(), nil))
+			})
+			dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+				tc.run(t, NewTodoRepository(db, logging.Discard()))
+			})
+		})
 	}
-
-	t.Log("sqlite memory database created and migrated")
-
-	return db
 }
 
-func TestRepository_CRUD(t *testing.T) {
-	db := createTestDB(t)
-	repo := NewTodoRepository(db)
-
+func testRepositoryCRUD(t *testing.T, repo TodoRepository) {
 	// Create
 	todo := &Todo{Title: "A", Description: "d"}
-	assert.NoError(t, repo.Create(todo))
+	assert.NoError(t, repo.Create(context.Background(), todo))
 	assert.NotZero(t, todo.ID)
+	assert.NotZero(t, todo.ChangeSeq)
 	t.Logf("created todo with ID=%d", todo.ID)
 
 	// GetByID
-	got, err := repo.GetByID(todo.ID)
-	assert.NoError(t, err)
+	got, err := repo.GetByID(context.Background(), todo.ID)
+	require.NoError(t, err)
 	assert.Equal(t, "A", got.Title)
 	t.Logf("fetched by id: %+v", got)
 
 	// ExistsByTitle
-	exists, err := repo.ExistsByTitle("A")
+	exists, err := repo.ExistsByTitle(context.Background(), "A")
 	assert.NoError(t, err)
 	assert.True(t, exists)
 	t.Logf("exists by title 'A': %v", exists)
 
-	notExists, err := repo.ExistsByTitle("B")
+	notExists, err := repo.ExistsByTitle(context.Background(), "B")
 	assert.NoError(t, err)
 	assert.False(t, notExists)
 	t.Logf("exists by title 'B': %v", notExists)
 
-	// GetAll
-	list, err := repo.GetAll()
+	// GetAll returns live todos in ID order
+	second := &Todo{Title: "B"}
+	require.NoError(t, repo.Create(context.Background(), second))
+	list, err := repo.GetAll(context.Background())
 	assert.NoError(t, err)
-	assert.GreaterOrEqual(t, len(list), 1)
+	require.Len(t, list, 2)
+	assert.Equal(t, []uint{todo.ID, second.ID}, []uint{list[0].ID, list[1].ID})
 	t.Logf("list size=%d", len(list))
 
 	// Update
 	got.Description = "new"
-	assert.NoError(t, repo.Update(got))
+	assert.NoError(t, repo.Update(context.Background(), got))
+	assert.Greater(t, got.ChangeSeq, second.ChangeSeq)
 	t.Log("updated description to 'new'")
 
-	got2, err := repo.GetByID(todo.ID)
-	assert.NoError(t, err)
+	got2, err := repo.GetByID(context.Background(), todo.ID)
+	require.NoError(t, err)
 	assert.Equal(t, "new", got2.Description)
 	t.Logf("verified update: %+v", got2)
 
-	// Delete
-	assert.NoError(t, repo.Delete(todo.ID))
-	_, err = repo.GetByID(todo.ID)
-	assert.Error(t, err)
+	// Delete is soft: the row stays visible unscoped
+	assert.NoError(t, repo.Delete(context.Background(), todo.ID))
+	_, err = repo.GetByID(context.Background(), todo.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	tombstone, err := repo.GetByIDUnscoped(context.Background(), todo.ID)
+	require.NoError(t, err)
+	assert.True(t, tombstone.DeletedAt.Valid)
+	assert.Equal(t, "new", tombstone.Description)
 	t.Logf("deleted todo id=%d", todo.ID)
+
+	exists, err = repo.ExistsByTitle(context.Background(), "A")
+	assert.NoError(t, err)
+	assert.False(t, exists, "deleted todos do not hold their title")
+}
+
+func testRepositoryCountByStatus(t *testing.T, repo TodoRepository) {
+	todos := []*Todo{{Title: "A"}, {Title: "B", Completed: true}, {Title: "C"}, {Title: "D"}}
+	for _, todo := range todos {
+		assert.NoError(t, repo.Create(context.Background(), todo))
+	}
+	// Deleted todos are not counted
+	assert.NoError(t, repo.Delete(context.Background(), todos[3].ID))
+
+	counts, err := repo.CountByStatus(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, TodoCounts{Open: 2, Completed: 1}, counts)
+	t.Logf("counts: %+v", counts)
+}
+
+func testRepositoryEach(t *testing.T, repo TodoRepository) {
+	ctx := context.Background()
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	// More than one batch, spread over three days
+	const n = eachBatchSize + 2
+	for i := range n {
+		todo := &Todo{Title: fmt.Sprintf("todo-%03d", i), Completed: i%2 == 1, CreatedAt: day.Add(time.Duration(i%3) * 24 * time.Hour)}
+		require.NoError(t, repo.Create(ctx, todo))
+	}
+	require.NoError(t, repo.Delete(ctx, 1))
+
+	collect := func(filter TodoFilter) []uint {
+		var ids []uint
+		require.NoError(t, repo.Each(ctx, filter, func(todo Todo) error {
+			ids = append(ids, todo.ID)
+			return nil
+		}))
+		return ids
+	}
+
+	all := collect(TodoFilter{})
+	assert.Len(t, all, n-1, "deleted todos are left out")
+	assert.IsIncreasing(t, all)
+
+	completed := true
+	assert.Len(t, collect(TodoFilter{Completed: &completed}), n/2)
+	secondDay := collect(TodoFilter{CreatedFrom: day.Add(24 * time.Hour), CreatedTo: day.Add(48 * time.Hour)})
+	assert.Len(t, secondDay, n/3)
+	assert.Equal(t, uint(2), secondDay[0])
+	t.Logf("all=%d second day=%d", len(all), len(secondDay))
+
+	// An error from fn stops the walk
+	stop := errors.New("stop")
+	calls := 0
+	err := repo.Each(ctx, TodoFilter{}, func(Todo) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
+func testRepositoryList(t *testing.T, repo TodoRepository) {
+	ctx := context.Background()
+	for _, todo := range []*Todo{
+		{Title: "Buy milk", Completed: true},
+		{Title: "Write docs", Description: "see the BUY list"},
+		{Title: "Buy bread"},
+		{Title: "Buy eggs"},
+		{Title: "100% done_"},
+	} {
+		require.NoError(t, repo.Create(ctx, todo))
+	}
+	require.NoError(t, repo.Delete(ctx, 4))
+
+	titles := func(list []Todo) []string {
+		out := []string{}
+		for _, todo := range list {
+			out = append(out, todo.Title)
+		}
+		return out
+	}
+
+	page, total, err := repo.List(ctx, TodoFilter{Search: "buy"}, 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total, "search matches title or description, ignoring case; deleted todos are left out")
+	assert.Equal(t, []string{"Buy milk", "Write docs"}, titles(page))
+
+	page, total, err = repo.List(ctx, TodoFilter{Search: "buy"}, 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Equal(t, []string{"Buy bread"}, titles(page))
+
+	completed := false
+	page, total, err = repo.List(ctx, TodoFilter{Completed: &completed, Search: "BUY"}, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, []string{"Write docs", "Buy bread"}, titles(page))
+
+	// LIKE wildcards in the search are literal
+	page, total, err = repo.List(ctx, TodoFilter{Search: "0% done_"}, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, []string{"100% done_"}, titles(page))
+	page, total, err = repo.List(ctx, TodoFilter{Search: "b_y"}, 10, 0)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+	assert.Empty(t, page)
+
+	page, total, err = repo.List(ctx, TodoFilter{}, 10, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+	assert.NotNil(t, page, "an empty page is a list, not nil")
+	assert.Empty(t, page)
+	t.Logf("total=%d", total)
+}
+
+func testRepositoryTitleUniqueAmongLiveTodos(t *testing.T, repo TodoRepository) {
+	ctx := context.Background()
+
+	first := &Todo{Title: "same"}
+	require.NoError(t, repo.Create(ctx, first))
+
+	err := repo.Create(ctx, &Todo{Title: "same"})
+	t.Logf("duplicate live title: %v", err)
+	assert.ErrorIs(t, err, ErrTitleExists, "a second live todo must not take the title")
+
+	other := &Todo{Title: "other"}
+	require.NoError(t, repo.Create(ctx, other))
+	other.Title = "same"
+	assert.ErrorIs(t, repo.Update(ctx, other), ErrTitleExists, "renaming onto a live title must fail")
+
+	// Soft-deleted todos free their title
+	require.NoError(t, repo.Delete(ctx, first.ID))
+	assert.NoError(t, repo.Create(ctx, &Todo{Title: "same"}))
+}
+
+func testRepositoryNotFound(t *testing.T, repo TodoRepository) {
+	ctx := context.Background()
+
+	_, err := repo.GetByID(ctx, 999)
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = repo.GetByIDUnscoped(ctx, 999)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, repo.Update(ctx, &Todo{ID: 999, Title: "ghost"}), ErrNotFound)
+	assert.ErrorIs(t, repo.Delete(ctx, 999), ErrNotFound)
+
+	// A deleted todo can be neither deleted again nor brought back by Update
+	todo := &Todo{Title: "A"}
+	require.NoError(t, repo.Create(ctx, todo))
+	require.NoError(t, repo.Delete(ctx, todo.ID))
+	assert.ErrorIs(t, repo.Delete(ctx, todo.ID), ErrNotFound)
+
+	todo.Description = "resurrect"
+	err = repo.Update(ctx, todo)
+	t.Logf("update of deleted todo: %v", err)
+	assert.ErrorIs(t, err, ErrNotFound)
+	list, err := repo.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func testRepositoryChangesIncludeTombstones(t *testing.T, repo TodoRepository) {
+	ctx := context.Background()
+
+	latest, err := repo.LatestChangeSeq(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, latest)
+
+	a := &Todo{Title: "A"}
+	b := &Todo{Title: "B"}
+	require.NoError(t, repo.Create(ctx, a))
+	require.NoError(t, repo.Create(ctx, b))
+	require.NoError(t, repo.Delete(ctx, a.ID))
+
+	changes, err := repo.ChangesSince(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	// The delete moved A behind B
+	assert.Equal(t, b.ID, changes[0].ID)
+	assert.Equal(t, a.ID, changes[1].ID)
+	assert.True(t, changes[1].DeletedAt.Valid)
+
+	latest, err = repo.LatestChangeSeq(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, changes[1].ChangeSeq, latest)
+
+	page, err := repo.ChangesSince(ctx, 0, 1)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	rest, err := repo.ChangesSince(ctx, page[0].ChangeSeq, 10)
+	require.NoError(t, err)
+	require.Len(t, rest, 1)
+	assert.Equal(t, a.ID, rest[0].ID)
+
+	none, err := repo.ChangesSince(ctx, latest, 10)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+}
+
+func testRepositoryConcurrentWritesGetDistinctChangeSeqs(t *testing.T, repo TodoRepository) {
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make([]error, writers)
+	for i := range writers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = repo.Create(context.Background(), &Todo{Title: fmt.Sprintf("todo-%d", i)})
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	changes, err := repo.ChangesSince(context.Background(), 0, writers)
+	require.NoError(t, err)
+	seen := make(map[uint64]bool, writers)
+	for _, todo := range changes {
+		assert.False(t, seen[todo.ChangeSeq], "change_seq %d assigned twice", todo.ChangeSeq)
+		seen[todo.ChangeSeq] = true
+	}
+	assert.Len(t, seen, writers)
+}
+
+func testRepositoryWithinTx(t *testing.T, repo TodoRepository) {
+	ctx := context.Background()
+	errAbort := errors.New("abort")
+
+	kept := &Todo{Title: "kept"}
+	require.NoError(t, repo.Create(ctx, kept))
+	seq, err := repo.LatestChangeSeq(ctx)
+	require.NoError(t, err)
+
+	// A failing unit of work leaves no trace
+	err = repo.WithinTx(ctx, func(tx TodoRepository) error {
+		require.NoError(t, tx.Create(ctx, &Todo{Title: "rolled back"}))
+		require.NoError(t, tx.Delete(ctx, kept.ID))
+
+		exists, err := tx.ExistsByTitle(ctx, "rolled back")
+		require.NoError(t, err)
+		assert.True(t, exists, "the transaction sees its own writes")
+		return errAbort
+	})
+	assert.ErrorIs(t, err, errAbort)
+
+	list, err := repo.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, kept.ID, list[0].ID)
+	after, err := repo.LatestChangeSeq(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, seq, after)
+
+	// A successful one commits every write
+	err = repo.WithinTx(ctx, func(tx TodoRepository) error {
+		if err := tx.Create(ctx, &Todo{Title: "committed"}); err != nil {
+			return err
+		}
+		return tx.Delete(ctx, kept.ID)
+	})
+	require.NoError(t, err)
+
+	list, err = repo.GetAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "committed", list[0].Title)
+}
+
+func TestMemoryTodoRepository_ReturnsCopies(t *testing.T) {
+	repo := NewMemoryTodoRepository(logging.Discard())
+	ctx := context.Background()
+
+	todo := &Todo{Title: "A", FieldClocks: FieldClocks{}}
+	require.NoError(t, repo.Create(ctx, todo))
+	todo.Title = "mutated after create"
+
+	got, err := repo.GetByID(ctx, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "A", got.Title)
+
+	got.Title = "mutated after get"
+	again, err := repo.GetByID(ctx, todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "A", again.Title)
+}
+
+func TestMemoryTodoRepository_HonoursCancellation(t *testing.T) {
+	repo := NewMemoryTodoRepository(logging.Discard())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, repo.Create(ctx, &Todo{Title: "A"}), context.Canceled)
+	_, err := repo.GetAll(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
 }
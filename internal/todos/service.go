@@ -1,87 +1,119 @@
 package todos
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/problem"
 )
 
 // TodoService defines business logic for managing todos.
 type TodoService interface {
-	CreateTodo(req *CreateTodoRequest) (*Todo, error)
-	GetAllTodos() ([]Todo, error)
-	GetTodoByID(id uint) (*Todo, error)
-	UpdateTodo(id uint, req *UpdateTodoRequest) (*Todo, error)
-	DeleteTodo(id uint) error
+	CreateTodo(ctx context.Context, req *CreateTodoRequest) (*Todo, error)
+	GetAllTodos(ctx context.Context) ([]Todo, error)
+	GetTodoByID(ctx context.Context, id uint) (*Todo, error)
+	UpdateTodo(ctx context.Context, id uint, req *UpdateTodoRequest) (*Todo, error)
+	DeleteTodo(ctx context.Context, id uint) error
+	// ImportTodos validates items and, unless dryRun is set or a row fails,
+	// creates them all in one transaction.
+	ImportTodos(ctx context.Context, items []ImportItem, dryRun bool) (*ImportResponse, error)
+	// ExportTodos calls fn for every todo matching filter in ID order without
+	// loading them all at once.
+	ExportTodos(ctx context.Context, filter TodoFilter, fn func(Todo) error) error
+	// ListTodos returns one page of todos matching filter in ID order and the
+	// total number of matches.
+	ListTodos(ctx context.Context, filter TodoFilter, limit, offset int) ([]Todo, int64, error)
 }
 
 type todoService struct {
 	todoRepo TodoRepository
+	logger   *slog.Logger
 }
 
-// NewTodoService constructs a TodoService with the provided repository.
-func NewTodoService(todoRepo TodoRepository) TodoService {
-	return &todoService{todoRepo: todoRepo}
+// NewTodoService constructs a TodoService with the provided repository and logger.
+func NewTodoService(todoRepo TodoRepository, logger *slog.Logger) TodoService {
+	return &todoService{todoRepo: todoRepo, logger: logger.With("component", "todo_service")}
 }
 
-// Domain errors returned by TodoService and repository.
-var (
-	ErrTitleRequired = errors.New("title is required")
-	ErrTitleExists   = errors.New("todo with this title already exists")
-	ErrNotFound      = errors.New("todo not found")
-)
-
-func (s *todoService) CreateTodo(req *CreateTodoRequest) (*Todo, error) {
+func (s *todoService) CreateTodo(ctx context.Context, req *CreateTodoRequest) (*Todo, error) {
 	// 1. Check if title is required
 	if req.Title == "" {
 		return nil, ErrTitleRequired
 	}
 
-	// 2. Check if title already exists in the database
-	exists, err := s.todoRepo.ExistsByTitle(req.Title)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check title uniqueness: %w", err)
-	}
-	if exists {
-		return nil, ErrTitleExists
-	}
-
-	// 3. Create a new Todo
+	// 2. Create a new Todo
 	todo := &Todo{
 		Title:       req.Title,
 		Description: req.Description,
 		Completed:   false,
 	}
-
-	// 4. Save to the database
-	if err := s.todoRepo.Create(todo); err != nil {
+	now := time.Now()
+	todo.touchField(FieldTitle, now)
+	todo.touchField(FieldDescription, now)
+	todo.touchField(FieldCompleted, now)
+
+	// 3. Check the title and save in one transaction; a concurrent insert
+	// that wins the race still surfaces as ErrTitleExists from Create
+	err := s.todoRepo.WithinTx(ctx, func(repo TodoRepository) error {
+		exists, err := repo.ExistsByTitle(ctx, req.Title)
+		if err != nil {
+			return fmt.Errorf("failed to check title uniqueness: %w", err)
+		}
+		if exists {
+			return ErrTitleExists
+		}
+		return repo.Create(ctx, todo)
+	})
+	if err != nil {
 		return nil, err
 	}
+	s.logger.InfoContext(ctx, "todo created", "todo_id", todo.ID)
 
 	return todo, nil
 }
 
-func (s *todoService) GetAllTodos() ([]Todo, error) {
-	return s.todoRepo.GetAll()
+func (s *todoService) GetAllTodos(ctx context.Context) ([]Todo, error) {
+	return s.todoRepo.GetAll(ctx)
 }
 
-func (s *todoService) GetTodoByID(id uint) (*Todo, error) {
-	return s.todoRepo.GetByID(id)
+func (s *todoService) GetTodoByID(ctx context.Context, id uint) (*Todo, error) {
+	return s.todoRepo.GetByID(ctx, id)
 }
 
-func (s *todoService) UpdateTodo(id uint, req *UpdateTodoRequest) (*Todo, error) {
+func (s *todoService) UpdateTodo(ctx context.Context, id uint, req *UpdateTodoRequest) (*Todo, error) {
+	var todo *Todo
+	err := s.todoRepo.WithinTx(ctx, func(repo TodoRepository) error {
+		var err error
+		todo, err = updateTodo(ctx, repo, id, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.logger.InfoContext(ctx, "todo updated", "todo_id", todo.ID)
+
+	return todo, nil
+}
+
+// updateTodo reads, checks and writes the todo through repo, which is bound
+// to the caller's transaction.
+func updateTodo(ctx context.Context, repo TodoRepository, id uint, req *UpdateTodoRequest) (*Todo, error) {
 	// 1. Get the existing Todo
-	todo, err := s.todoRepo.GetByID(id)
+	todo, err := repo.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
 	// 2. Track changes
 	hasChanges := false
+	now := time.Now()
 
 	// 3. Update Title (if provided)
 	if req.Title != "" && req.Title != todo.Title {
 		// Check if the title is unique
-		exists, err := s.todoRepo.ExistsByTitle(req.Title)
+		exists, err := repo.ExistsByTitle(ctx, req.Title)
 		if err != nil {
 			return nil, fmt.Errorf("failed to check title uniqueness: %w", err)
 		}
@@ -90,18 +122,21 @@ func (s *todoService) UpdateTodo(id uint, req *UpdateTodoRequest) (*Todo, error)
 		}
 
 		todo.Title = req.Title
+		todo.touchField(FieldTitle, now)
 		hasChanges = true
 	}
 
 	// 4. Update Description (if provided)
 	if req.Description != "" && req.Description != todo.Description {
 		todo.Description = req.Description
+		todo.touchField(FieldDescription, now)
 		hasChanges = true
 	}
 
 	// 5. Update Completed (if provided)
 	if req.Completed != nil && *req.Completed != todo.Completed {
 		todo.Completed = *req.Completed
+		todo.touchField(FieldCompleted, now)
 		hasChanges = true
 	}
 
@@ -111,13 +146,110 @@ func (s *todoService) UpdateTodo(id uint, req *UpdateTodoRequest) (*Todo, error)
 	}
 
 	// 7. Save the changes
-	if err := s.todoRepo.Update(todo); err != nil {
+	if err := repo.Update(ctx, todo); err != nil {
 		return nil, err
 	}
 
 	return todo, nil
 }
 
-func (s *todoService) DeleteTodo(id uint) error {
-	return s.todoRepo.Delete(id)
+func (s *todoService) DeleteTodo(ctx context.Context, id uint) error {
+	if err := s.todoRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.logger.InfoContext(ctx, "todo deleted", "todo_id", id)
+
+	return nil
+}
+
+func (s *todoService) ExportTodos(ctx context.Context, filter TodoFilter, fn func(Todo) error) error {
+	return s.todoRepo.Each(ctx, filter, fn)
+}
+
+func (s *todoService) ListTodos(ctx context.Context, filter TodoFilter, limit, offset int) ([]Todo, int64, error) {
+	return s.todoRepo.List(ctx, filter, limit, offset)
+}
+
+func (s *todoService) ImportTodos(ctx context.Context, items []ImportItem, dryRun bool) (*ImportResponse, error) {
+	resp := &ImportResponse{DryRun: dryRun, Total: len(items)}
+
+	// 1. Check every row, so a dry run reports all problems at once
+	err := s.todoRepo.WithinTx(ctx, func(repo TodoRepository) error {
+		var err error
+		resp.Errors, err = checkImport(ctx, repo, items)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		resp.Preview = items
+		return resp, nil
+	}
+	if len(resp.Errors) > 0 {
+		return resp, nil
+	}
+
+	// 2. Create everything or nothing; a title taken since the check
+	// surfaces as ErrTitleExists and rolls the import back
+	now := time.Now()
+	todos := make([]Todo, len(items))
+	err = s.todoRepo.WithinTx(ctx, func(repo TodoRepository) error {
+		for i, item := range items {
+			todos[i] = Todo{Title: item.Title, Description: item.Description, Completed: item.Completed}
+			todos[i].touchField(FieldTitle, now)
+			todos[i].touchField(FieldDescription, now)
+			todos[i].touchField(FieldCompleted, now)
+			if err := repo.Create(ctx, &todos[i]); err != nil {
+				return fmt.Errorf("row %d: %w", item.Row, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Created = len(todos)
+	resp.Todos = todos
+	s.logger.InfoContext(ctx, "todos imported", "count", len(todos))
+
+	return resp, nil
+}
+
+// checkImport reports rows without a title, titles repeated within the
+// import and titles that already exist.
+func checkImport(ctx context.Context, repo TodoRepository, items []ImportItem) ([]problem.FieldError, error) {
+	var errs []problem.FieldError
+	seen := make(map[string]int, len(items))
+	for _, item := range items {
+		errs = append(errs, item.invalid...)
+		field := importField(item.Row, "title")
+		if item.Title == "" {
+			if len(item.invalid) > 0 {
+				// The row could not be read, so its title is not missing
+				continue
+			}
+			errs = append(errs, problem.FieldError{Field: field, Message: "is required"})
+			continue
+		}
+		if row, ok := seen[item.Title]; ok {
+			errs = append(errs, problem.FieldError{Field: field, Message: fmt.Sprintf("duplicates row %d", row)})
+			continue
+		}
+		seen[item.Title] = item.Row
+
+		exists, err := repo.ExistsByTitle(ctx, item.Title)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check title uniqueness: %w", err)
+		}
+		if exists {
+			errs = append(errs, problem.FieldError{Field: field, Message: "already exists"})
+		}
+	}
+	return errs, nil
+}
+
+// importField names a field of an import row in row-level errors.
+func importField(row int, name string) string {
+	return fmt.Sprintf("rows[%d].%s", row, name)
 }
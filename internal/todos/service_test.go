@@ -1,27 +1,39 @@
 package todos
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"sync"
 	"testing"
 
+	"github.com/drago44/golang-todo-api/internal/dbtest"
+	"github.com/drago44/golang-todo-api/internal/logging"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
 // Mock implementation of TodoRepository for service unit tests
 type mockTodoRepository struct{ mock.Mock }
 
-func (m *mockTodoRepository) Create(todo *Todo) error {
+// WithinTx runs fn directly; the mock has nothing to roll back.
+func (m *mockTodoRepository) WithinTx(_ context.Context, fn func(repo TodoRepository) error) error {
+	return fn(m)
+}
+
+func (m *mockTodoRepository) Create(_ context.Context, todo *Todo) error {
 	args := m.Called(todo)
 	return args.Error(0)
 }
 
-func (m *mockTodoRepository) GetAll() ([]Todo, error) {
+func (m *mockTodoRepository) GetAll(_ context.Context) ([]Todo, error) {
 	args := m.Called()
 	return args.Get(0).([]Todo), args.Error(1)
 }
 
-func (m *mockTodoRepository) GetByID(id uint) (*Todo, error) {
+func (m *mockTodoRepository) GetByID(_ context.Context, id uint) (*Todo, error) {
 	args := m.Called(id)
 	if v := args.Get(0); v != nil {
 		return v.(*Todo), args.Error(1)
@@ -30,24 +42,66 @@ func (m *mockTodoRepository) GetByID(id uint) (*Todo, error) {
 	return nil, args.Error(1)
 }
 
-func (m *mockTodoRepository) ExistsByTitle(title string) (bool, error) {
+func (m *mockTodoRepository) GetByIDUnscoped(_ context.Context, id uint) (*Todo, error) {
+	args := m.Called(id)
+	if v := args.Get(0); v != nil {
+		return v.(*Todo), args.Error(1)
+	}
+
+	return nil, args.Error(1)
+}
+
+func (m *mockTodoRepository) ExistsByTitle(_ context.Context, title string) (bool, error) {
 	args := m.Called(title)
 	return args.Bool(0), args.Error(1)
 }
 
-func (m *mockTodoRepository) Update(todo *Todo) error {
+func (m *mockTodoRepository) Update(_ context.Context, todo *Todo) error {
 	args := m.Called(todo)
 	return args.Error(0)
 }
 
-func (m *mockTodoRepository) Delete(id uint) error {
+func (m *mockTodoRepository) Delete(_ context.Context, id uint) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
 
+func (m *mockTodoRepository) ChangesSince(_ context.Context, since uint64, limit int) ([]Todo, error) {
+	args := m.Called(since, limit)
+	return args.Get(0).([]Todo), args.Error(1)
+}
+
+func (m *mockTodoRepository) LatestChangeSeq(_ context.Context) (uint64, error) {
+	args := m.Called()
+	return args.Get(0).(uint64), args.Error(1)
+}
+
+func (m *mockTodoRepository) CountByStatus(_ context.Context) (TodoCounts, error) {
+	args := m.Called()
+	return args.Get(0).(TodoCounts), args.Error(1)
+}
+
+func (m *mockTodoRepository) Each(_ context.Context, filter TodoFilter, fn func(Todo) error) error {
+	args := m.Called(filter)
+	for _, todo := range args.Get(0).([]Todo) {
+		if err := fn(todo); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *mockTodoRepository) List(_ context.Context, filter TodoFilter, limit, offset int) ([]Todo, int64, error) {
+	args := m.Called(filter, limit, offset)
+	if args.Get(0) == nil {
+		return nil, 0, args.Error(2)
+	}
+	return args.Get(0).([]Todo), args.Get(1).(int64), args.Error(2)
+}
+
 func TestCreateTodo_Success(t *testing.T) {
 	mockRepo := new(mockTodoRepository)
-	service := NewTodoService(mockRepo)
+	service := NewTodoService(mockRepo, logging.Discard())
 
 	req := &CreateTodoRequest{Title: "Test", Description: "desc"}
 	t.Logf("CreateTodo: preparing request: %+v", req)
@@ -59,7 +113,7 @@ func TestCreateTodo_Success(t *testing.T) {
 		return todo.Title == "Test" && todo.Description == "desc" && todo.Completed == false
 	})).Return(nil).Once()
 
-	created, err := service.CreateTodo(req)
+	created, err := service.CreateTodo(context.Background(), req)
 	assert.NoError(t, err)
 	assert.NotNil(t, created)
 	assert.Equal(t, "Test", created.Title)
@@ -72,9 +126,9 @@ func TestCreateTodo_Success(t *testing.T) {
 
 func TestCreateTodo_EmptyTitle(t *testing.T) {
 	mockRepo := new(mockTodoRepository)
-	service := NewTodoService(mockRepo)
+	service := NewTodoService(mockRepo, logging.Discard())
 
-	_, err := service.CreateTodo(&CreateTodoRequest{Title: "", Description: "x"})
+	_, err := service.CreateTodo(context.Background(), &CreateTodoRequest{Title: "", Description: "x"})
 	assert.Error(t, err)
 	assert.Equal(t, "title is required", err.Error())
 	t.Log("CreateTodo: got expected validation error for empty title")
@@ -82,11 +136,11 @@ func TestCreateTodo_EmptyTitle(t *testing.T) {
 
 func TestCreateTodo_TitleExists(t *testing.T) {
 	mockRepo := new(mockTodoRepository)
-	service := NewTodoService(mockRepo)
+	service := NewTodoService(mockRepo, logging.Discard())
 
 	mockRepo.On("ExistsByTitle", "Dup").Return(true, nil).Once()
 
-	_, err := service.CreateTodo(&CreateTodoRequest{Title: "Dup"})
+	_, err := service.CreateTodo(context.Background(), &CreateTodoRequest{Title: "Dup"})
 	assert.Error(t, err)
 	assert.Equal(t, "todo with this title already exists", err.Error())
 	t.Log("CreateTodo: got expected duplicate title error")
@@ -96,11 +150,11 @@ func TestCreateTodo_TitleExists(t *testing.T) {
 
 func TestCreateTodo_ExistsByTitleDbError(t *testing.T) {
 	mockRepo := new(mockTodoRepository)
-	service := NewTodoService(mockRepo)
+	service := NewTodoService(mockRepo, logging.Discard())
 
 	mockRepo.On("ExistsByTitle", "X").Return(false, errors.New("db down")).Once()
 
-	_, err := service.CreateTodo(&CreateTodoRequest{Title: "X"})
+	_, err := service.CreateTodo(context.Background(), &CreateTodoRequest{Title: "X"})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to check title uniqueness")
 	t.Logf("CreateTodo: got expected repo error: %v", err)
@@ -110,12 +164,12 @@ func TestCreateTodo_ExistsByTitleDbError(t *testing.T) {
 
 func TestGetAllTodos(t *testing.T) {
 	mockRepo := new(mockTodoRepository)
-	service := NewTodoService(mockRepo)
+	service := NewTodoService(mockRepo, logging.Discard())
 
 	expected := []Todo{{ID: 1, Title: "A"}}
 	mockRepo.On("GetAll").Return(expected, nil).Once()
 
-	got, err := service.GetAllTodos()
+	got, err := service.GetAllTodos(context.Background())
 	assert.NoError(t, err)
 	assert.Equal(t, expected, got)
 	t.Logf("GetAllTodos: fetched %d todos", len(got))
@@ -125,11 +179,11 @@ func TestGetAllTodos(t *testing.T) {
 
 func TestGetTodoByID(t *testing.T) {
 	mockRepo := new(mockTodoRepository)
-	service := NewTodoService(mockRepo)
+	service := NewTodoService(mockRepo, logging.Discard())
 
 	mockRepo.On("GetByID", uint(7)).Return(&Todo{ID: 7, Title: "Z"}, nil).Once()
 
-	got, err := service.GetTodoByID(7)
+	got, err := service.GetTodoByID(context.Background(), 7)
 	assert.NoError(t, err)
 	assert.NotNil(t, got)
 	assert.Equal(t, uint(7), got.ID)
@@ -140,13 +194,13 @@ func TestGetTodoByID(t *testing.T) {
 
 func TestUpdateTodo_NoChanges(t *testing.T) {
 	mockRepo := new(mockTodoRepository)
-	service := NewTodoService(mockRepo)
+	service := NewTodoService(mockRepo, logging.Discard())
 
 	existing := &Todo{ID: 3, Title: "A", Description: "d", Completed: false}
 	mockRepo.On("GetByID", uint(3)).Return(existing, nil).Once()
 
 	req := &UpdateTodoRequest{}
-	got, err := service.UpdateTodo(3, req)
+	got, err := service.UpdateTodo(context.Background(), 3, req)
 	assert.NoError(t, err)
 	assert.Equal(t, existing, got)
 	t.Log("UpdateTodo: no changes applied as expected")
@@ -158,12 +212,12 @@ func TestUpdateTodo_NoChanges(t *testing.T) {
 
 func TestUpdateTodo_TitleConflict(t *testing.T) {
 	mockRepo := new(mockTodoRepository)
-	service := NewTodoService(mockRepo)
+	service := NewTodoService(mockRepo, logging.Discard())
 
 	mockRepo.On("GetByID", uint(5)).Return(&Todo{ID: 5, Title: "Old"}, nil).Once()
 	mockRepo.On("ExistsByTitle", "New").Return(true, nil).Once()
 
-	_, err := service.UpdateTodo(5, &UpdateTodoRequest{Title: "New"})
+	_, err := service.UpdateTodo(context.Background(), 5, &UpdateTodoRequest{Title: "New"})
 	assert.Error(t, err)
 	assert.Equal(t, "todo with this title already exists", err.Error())
 	t.Log("UpdateTodo: got expected title conflict error")
@@ -173,7 +227,7 @@ func TestUpdateTodo_TitleConflict(t *testing.T) {
 
 func TestUpdateTodo_Success(t *testing.T) {
 	mockRepo := new(mockTodoRepository)
-	service := NewTodoService(mockRepo)
+	service := NewTodoService(mockRepo, logging.Discard())
 
 	mockRepo.On("GetByID", uint(9)).Return(&Todo{ID: 9, Title: "T", Description: "old", Completed: false}, nil).Once()
 
@@ -184,7 +238,7 @@ func TestUpdateTodo_Success(t *testing.T) {
 		return todo.Description == "new" && todo.Completed == true && todo.Title == "T"
 	})).Return(nil).Once()
 
-	updated, err := service.UpdateTodo(9, req)
+	updated, err := service.UpdateTodo(context.Background(), 9, req)
 	assert.NoError(t, err)
 	assert.Equal(t, "new", updated.Description)
 	assert.True(t, updated.Completed)
@@ -195,13 +249,54 @@ func TestUpdateTodo_Success(t *testing.T) {
 
 func TestDeleteTodo(t *testing.T) {
 	mockRepo := new(mockTodoRepository)
-	service := NewTodoService(mockRepo)
+	service := NewTodoService(mockRepo, logging.Discard())
 
 	mockRepo.On("Delete", uint(11)).Return(nil).Once()
 
-	err := service.DeleteTodo(11)
+	err := service.DeleteTodo(context.Background(), 11)
 	assert.NoError(t, err)
 	t.Log("DeleteTodo: delete returned no error")
 
 	mockRepo.AssertExpectations(t)
 }
+
+// TestTodoService_ConcurrentTitleClaims renames several todos to the same title
+// at once: exactly one wins and every other caller gets ErrTitleExists.
+func TestTodoService_ConcurrentTitleClaims(t *testing.T) {
+	run := func(t *testing.T, repo TodoRepository) {
+		service := NewTodoService(repo, logging.Discard())
+
+		const writers = 8
+		ids := make([]uint, writers)
+		for i := range ids {
+			todo, err := service.CreateTodo(context.Background(), &CreateTodoRequest{Title: fmt.Sprintf("todo-%d", i)})
+			require.NoError(t, err)
+			ids[i] = todo.ID
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, writers)
+		for i, id := range ids {
+			wg.Add(1)
+			go func(i int, id uint) {
+				defer wg.Done()
+				_, errs[i] = service.UpdateTodo(context.Background(), id, &UpdateTodoRequest{Title: "claimed"})
+			}(i, id)
+		}
+		wg.Wait()
+
+		won := 0
+		for _, err := range errs {
+			if err == nil {
+				won++
+				continue
+			}
+			assert.ErrorIs(t, err, ErrTitleExists)
+		}
+		assert.Equal(t, 1, won)
+		t.Logf("errors: %v", errs)
+	}
+
+	t.Run("memory", func(t *testing.T) { run(t, NewMemoryTodoRepository(logging.Discard())) })
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) { run(t, NewTodoRepository(db, logging.Discard())) })
+}
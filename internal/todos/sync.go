@@ -0,0 +1,387 @@
+package todos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Sync strategies accepted by SyncService.Apply.
+const (
+	SyncStrategyLWW    = "lww"
+	SyncStrategyReport = "report"
+)
+
+// Sync result statuses reported per change.
+const (
+	SyncStatusCreated   = "created"
+	SyncStatusApplied   = "applied"
+	SyncStatusUnchanged = "unchanged"
+	SyncStatusConflict  = "conflict"
+	SyncStatusDeleted   = "deleted"
+	SyncStatusRejected  = "rejected"
+)
+
+// Conflict resolutions reported in SyncConflict.
+const (
+	SyncResolutionServer     = "server"
+	SyncResolutionUnresolved = "unresolved"
+)
+
+// syncFields lists syncable fields in the order they are applied.
+var syncFields = []string{FieldTitle, FieldDescription, FieldCompleted}
+
+const (
+	defaultSyncLimit = 500
+	maxSyncLimit     = 1000
+)
+
+// SyncService reconciles offline clients with the server state.
+type SyncService interface {
+	Changes(ctx context.Context, since string, limit int) (*SyncChangesResponse, error)
+	Apply(ctx context.Context, req *SyncRequest) (*SyncResponse, error)
+}
+
+type syncService struct {
+	todoRepo TodoRepository
+	logger   *slog.Logger
+}
+
+// NewSyncService constructs a SyncService with the provided repository and logger.
+func NewSyncService(todoRepo TodoRepository, logger *slog.Logger) SyncService {
+	return &syncService{todoRepo: todoRepo, logger: logger.With("component", "sync_service")}
+}
+
+// ParseChangeToken decodes a change token; an empty token means "from the beginning".
+func ParseChangeToken(token string) (uint64, error) {
+	if token == "" {
+		return 0, nil
+	}
+	seq, err := strconv.ParseUint(token, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidSyncToken
+	}
+	return seq, nil
+}
+
+// FormatChangeToken encodes a change sequence as an opaque token.
+func FormatChangeToken(seq uint64) string {
+	return strconv.FormatUint(seq, 10)
+}
+
+func (s *syncService) Changes(ctx context.Context, since string, limit int) (*SyncChangesResponse, error) {
+	seq, err := ParseChangeToken(since)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultSyncLimit
+	}
+	if limit > maxSyncLimit {
+		limit = maxSyncLimit
+	}
+
+	// Fetch one extra row to learn whether another page exists
+	changes, err := s.todoRepo.ChangesSince(ctx, seq, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &SyncChangesResponse{Changes: changes, Token: FormatChangeToken(seq)}
+	if len(changes) > limit {
+		resp.Changes = changes[:limit]
+		resp.HasMore = true
+	}
+	if n := len(resp.Changes); n > 0 {
+		resp.Token = FormatChangeToken(resp.Changes[n-1].ChangeSeq)
+	}
+
+	return resp, nil
+}
+
+func (s *syncService) Apply(ctx context.Context, req *SyncRequest) (*SyncResponse, error) {
+	strategy := req.Strategy
+	if strategy == "" {
+		strategy = SyncStrategyLWW
+	}
+	if strategy != SyncStrategyLWW && strategy != SyncStrategyReport {
+		return nil, ErrInvalidSyncStrategy
+	}
+
+	results := make([]SyncResult, 0, len(req.Changes))
+	counts := make(map[string]int)
+	for i := range req.Changes {
+		ch := &req.Changes[i]
+		res, err := s.applyChangeInTx(ctx, ch, strategy)
+		if err != nil {
+			return nil, err
+		}
+		res.ClientRef = ch.ClientRef
+		results = append(results, res)
+		counts[res.Status]++
+	}
+
+	latest, err := s.todoRepo.LatestChangeSeq(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.InfoContext(ctx, "sync batch applied",
+		"strategy", strategy,
+		"changes", len(req.Changes),
+		SyncStatusCreated, counts[SyncStatusCreated],
+		SyncStatusApplied, counts[SyncStatusApplied],
+		SyncStatusConflict, counts[SyncStatusConflict],
+		SyncStatusDeleted, counts[SyncStatusDeleted],
+		SyncStatusRejected, counts[SyncStatusRejected],
+	)
+
+	return &SyncResponse{Results: results, Token: FormatChangeToken(latest)}, nil
+}
+
+// applyChangeInTx applies a single change in its own transaction, so a
+// rejected change never undoes the ones before it.
+func (s *syncService) applyChangeInTx(ctx context.Context, ch *SyncChange, strategy string) (SyncResult, error) {
+	var res SyncResult
+	err := s.todoRepo.WithinTx(ctx, func(repo TodoRepository) error {
+		tx := &syncService{todoRepo: repo, logger: s.logger}
+		var err error
+		res, err = tx.applyChange(ctx, ch, strategy)
+		return err
+	})
+	// A concurrent writer took the title after the uniqueness check
+	if errors.Is(err, ErrTitleExists) {
+		return rejected(ch.ID, err), nil
+	}
+	return res, err
+}
+
+// applyChange applies a single change. Client mistakes are reported in the
+// result; only infrastructure failures are returned as errors.
+func (s *syncService) applyChange(ctx context.Context, ch *SyncChange, strategy string) (SyncResult, error) {
+	if ch.ID == 0 {
+		return s.applyCreate(ctx, ch)
+	}
+
+	base, err := ParseChangeToken(ch.BaseToken)
+	if err != nil {
+		return rejected(ch.ID, err), nil
+	}
+
+	todo, err := s.todoRepo.GetByIDUnscoped(ctx, ch.ID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return rejected(ch.ID, err), nil
+		}
+		return SyncResult{}, err
+	}
+
+	// Tombstones win: a deleted todo cannot be resurrected by a stale client
+	if todo.DeletedAt.Valid {
+		return SyncResult{ID: todo.ID, Status: SyncStatusDeleted, Todo: todo}, nil
+	}
+
+	changedSinceBase := todo.ChangeSeq > base
+
+	if ch.Deleted {
+		return s.applyDelete(ctx, ch, todo, strategy, changedSinceBase)
+	}
+
+	if err := validateSyncFields(ch.Fields); err != nil {
+		return rejected(todo.ID, err), nil
+	}
+
+	var (
+		conflicts []SyncConflict
+		changed   bool
+	)
+	for _, name := range syncFields {
+		fv, ok := ch.Fields[name]
+		if !ok {
+			continue
+		}
+		current := fieldValue(todo, name)
+		if fv.Value == current {
+			continue
+		}
+
+		conflict := SyncConflict{
+			Field:            name,
+			ServerValue:      current,
+			ClientValue:      fv.Value,
+			ServerModifiedAt: todo.fieldModifiedAt(name),
+		}
+		switch strategy {
+		case SyncStrategyLWW:
+			if !fv.ModifiedAt.After(todo.fieldModifiedAt(name)) {
+				conflict.Resolution = SyncResolutionServer
+				conflicts = append(conflicts, conflict)
+				continue
+			}
+		case SyncStrategyReport:
+			if changedSinceBase {
+				conflict.Resolution = SyncResolutionUnresolved
+				conflicts = append(conflicts, conflict)
+				continue
+			}
+		}
+
+		if name == FieldTitle {
+			exists, err := s.todoRepo.ExistsByTitle(ctx, fv.Value.(string))
+			if err != nil {
+				return SyncResult{}, fmt.Errorf("failed to check title uniqueness: %w", err)
+			}
+			if exists {
+				return rejected(todo.ID, ErrTitleExists), nil
+			}
+		}
+		setFieldValue(todo, name, fv)
+		changed = true
+	}
+
+	status := SyncStatusUnchanged
+	if changed {
+		if err := s.todoRepo.Update(ctx, todo); err != nil {
+			return SyncResult{}, err
+		}
+		status = SyncStatusApplied
+	}
+	if strategy == SyncStrategyReport && len(conflicts) > 0 {
+		status = SyncStatusConflict
+	}
+
+	return SyncResult{ID: todo.ID, Status: status, Conflicts: conflicts, Todo: todo}, nil
+}
+
+func (s *syncService) applyCreate(ctx context.Context, ch *SyncChange) (SyncResult, error) {
+	if ch.Deleted {
+		return SyncResult{Status: SyncStatusUnchanged}, nil
+	}
+
+	if err := validateSyncFields(ch.Fields); err != nil {
+		return rejected(0, err), nil
+	}
+	if _, ok := ch.Fields[FieldTitle]; !ok {
+		return rejected(0, ErrTitleRequired), nil
+	}
+	exists, err := s.todoRepo.ExistsByTitle(ctx, ch.Fields[FieldTitle].Value.(string))
+	if err != nil {
+		return SyncResult{}, fmt.Errorf("failed to check title uniqueness: %w", err)
+	}
+	if exists {
+		return rejected(0, ErrTitleExists), nil
+	}
+
+	todo := &Todo{}
+	now := time.Now()
+	for _, name := range syncFields {
+		if fv, ok := ch.Fields[name]; ok {
+			setFieldValue(todo, name, fv)
+		} else {
+			todo.touchField(name, now)
+		}
+	}
+
+	if err := s.todoRepo.Create(ctx, todo); err != nil {
+		return SyncResult{}, err
+	}
+
+	return SyncResult{ID: todo.ID, Status: SyncStatusCreated, Todo: todo}, nil
+}
+
+func (s *syncService) applyDelete(ctx context.Context, ch *SyncChange, todo *Todo, strategy string, changedSinceBase bool) (SyncResult, error) {
+	switch {
+	case strategy == SyncStrategyLWW && ch.ModifiedAt.Before(todo.lastModifiedAt()):
+		return SyncResult{ID: todo.ID, Status: SyncStatusUnchanged, Todo: todo, Conflicts: []SyncConflict{{
+			Field:            "deleted",
+			ServerValue:      false,
+			ClientValue:      true,
+			ServerModifiedAt: todo.lastModifiedAt(),
+			Resolution:       SyncResolutionServer,
+		}}}, nil
+	case strategy == SyncStrategyReport && changedSinceBase:
+		return SyncResult{ID: todo.ID, Status: SyncStatusConflict, Todo: todo, Conflicts: []SyncConflict{{
+			Field:            "deleted",
+			ServerValue:      false,
+			ClientValue:      true,
+			ServerModifiedAt: todo.lastModifiedAt(),
+			Resolution:       SyncResolutionUnresolved,
+		}}}, nil
+	}
+
+	if err := s.todoRepo.Delete(ctx, todo.ID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return SyncResult{ID: todo.ID, Status: SyncStatusDeleted}, nil
+		}
+		return SyncResult{}, err
+	}
+
+	deleted, err := s.todoRepo.GetByIDUnscoped(ctx, todo.ID)
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	return SyncResult{ID: todo.ID, Status: SyncStatusDeleted, Todo: deleted}, nil
+}
+
+func rejected(id uint, err error) SyncResult {
+	return SyncResult{ID: id, Status: SyncStatusRejected, Error: err.Error()}
+}
+
+// fieldValue returns the current value of a syncable field.
+func fieldValue(todo *Todo, name string) interface{} {
+	switch name {
+	case FieldTitle:
+		return todo.Title
+	case FieldDescription:
+		return todo.Description
+	default:
+		return todo.Completed
+	}
+}
+
+// validateSyncFields rejects unknown fields and values of the wrong type
+// before anything is compared or written.
+func validateSyncFields(fields map[string]SyncFieldValue) error {
+	for name, fv := range fields {
+		var ok bool
+		switch name {
+		case FieldTitle:
+			var v string
+			v, ok = fv.Value.(string)
+			ok = ok && v != ""
+		case FieldDescription:
+			_, ok = fv.Value.(string)
+		case FieldCompleted:
+			_, ok = fv.Value.(bool)
+		default:
+			return fmt.Errorf("%w: %s", ErrUnknownSyncField, name)
+		}
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrInvalidSyncValue, name)
+		}
+	}
+	return nil
+}
+
+// setFieldValue assigns a validated client value to a syncable field and stamps its clock.
+func setFieldValue(todo *Todo, name string, fv SyncFieldValue) {
+	at := fv.ModifiedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	switch name {
+	case FieldTitle:
+		todo.Title = fv.Value.(string)
+	case FieldDescription:
+		todo.Description = fv.Value.(string)
+	case FieldCompleted:
+		todo.Completed = fv.Value.(bool)
+	}
+
+	todo.touchField(name, at)
+}
@@ -0,0 +1,89 @@
+package todos
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/drago44/golang-todo-api/internal/problem"
+	"github.com/gin-gonic/gin"
+)
+
+// SyncHandler exposes HTTP handlers for delta sync of offline clients.
+type SyncHandler struct {
+	syncService SyncService
+}
+
+// NewSyncHandler creates a new SyncHandler instance.
+func NewSyncHandler(syncService SyncService) *SyncHandler {
+	return &SyncHandler{syncService: syncService}
+}
+
+// RegisterSyncRoutes registers sync routes under the provided router group.
+func (h *SyncHandler) RegisterSyncRoutes(rg *gin.RouterGroup) {
+	sync := rg.Group("/sync")
+	{
+		sync.GET("", h.GetChanges)
+		sync.POST("", h.PushChanges)
+	}
+}
+
+// GetChanges handles GET /sync and returns todos changed since a token.
+// @Summary Pull changes
+// @Description Get todos (including deleted tombstones) changed since a change token
+// @Tags sync
+// @Accept json
+// @Produce json
+// @Produce application/problem+json
+// @Param since query string false "Change token from a previous pull; empty for a full sync"
+// @Param limit query int false "Maximum number of changes to return (default 500, max 1000)"
+// @Success 200 {object} SyncChangesResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /sync [get]
+func (h *SyncHandler) GetChanges(c *gin.Context) {
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			problem.BadParameter(c, "limit", "must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	resp, err := h.syncService.Changes(c.Request.Context(), c.Query("since"), limit)
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// PushChanges handles POST /sync and applies a batch of client changes.
+// @Summary Push changes
+// @Description Apply a batch of client changes with per-field last-writer-wins or conflict reporting
+// @Tags sync
+// @Accept json
+// @Produce json
+// @Produce application/problem+json
+// @Param request body SyncRequest true "Sync Request"
+// @Success 200 {object} SyncResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /sync [post]
+func (h *SyncHandler) PushChanges(c *gin.Context) {
+	req := new(SyncRequest)
+	if err := c.ShouldBindJSON(req); err != nil {
+		problem.BindError(c, err)
+		return
+	}
+
+	resp, err := h.syncService.Apply(c.Request.Context(), req)
+	if err != nil {
+		problem.Error(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,221 @@
+package todos
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drago44/golang-todo-api/internal/dbtest"
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// createFileTestDB opens an isolated SQLite file so change tokens can be
+// checked across reconnects.
+func createFileTestDB(t *testing.T, path string) *gorm.DB {
+	t.Helper()
+
+	return dbtest.SQLite(t, path)
+}
+
+func TestSync_ChangesIncludeTombstonesAndSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sync.db")
+	repo := NewTodoRepository(createFileTestDB(t, path), logging.Discard())
+	todoSvc := NewTodoService(repo, logging.Discard())
+	syncSvc := NewSyncService(repo, logging.Discard())
+
+	a, err := todoSvc.CreateTodo(context.Background(), &CreateTodoRequest{Title: "A"})
+	require.NoError(t, err)
+	b, err := todoSvc.CreateTodo(context.Background(), &CreateTodoRequest{Title: "B"})
+	require.NoError(t, err)
+
+	first, err := syncSvc.Changes(context.Background(), "", 0)
+	require.NoError(t, err)
+	assert.Len(t, first.Changes, 2)
+	assert.False(t, first.HasMore)
+	t.Logf("initial pull: token=%s changes=%d", first.Token, len(first.Changes))
+
+	require.NoError(t, todoSvc.DeleteTodo(context.Background(), a.ID))
+	done := true
+	_, err = todoSvc.UpdateTodo(context.Background(), b.ID, &UpdateTodoRequest{Completed: &done})
+	require.NoError(t, err)
+
+	// Reopen the database to prove tokens are persisted, not in-memory
+	syncSvc = NewSyncService(NewTodoRepository(createFileTestDB(t, path), logging.Discard()), logging.Discard())
+
+	delta, err := syncSvc.Changes(context.Background(), first.Token, 0)
+	require.NoError(t, err)
+	require.Len(t, delta.Changes, 2)
+	assert.Equal(t, a.ID, delta.Changes[0].ID)
+	assert.True(t, delta.Changes[0].DeletedAt.Valid)
+	assert.Equal(t, b.ID, delta.Changes[1].ID)
+	assert.True(t, delta.Changes[1].Completed)
+	t.Logf("delta pull: token=%s changes=%d", delta.Token, len(delta.Changes))
+
+	empty, err := syncSvc.Changes(context.Background(), delta.Token, 0)
+	require.NoError(t, err)
+	assert.Empty(t, empty.Changes)
+	assert.Equal(t, delta.Token, empty.Token)
+}
+
+func TestSync_ChangesPaginates(t *testing.T) {
+	repo := NewTodoRepository(createFileTestDB(t, filepath.Join(t.TempDir(), "sync.db")), logging.Discard())
+	todoSvc := NewTodoService(repo, logging.Discard())
+	syncSvc := NewSyncService(repo, logging.Discard())
+
+	for _, title := range []string{"A", "B", "C"} {
+		_, err := todoSvc.CreateTodo(context.Background(), &CreateTodoRequest{Title: title})
+		require.NoError(t, err)
+	}
+
+	page, err := syncSvc.Changes(context.Background(), "", 2)
+	require.NoError(t, err)
+	assert.Len(t, page.Changes, 2)
+	assert.True(t, page.HasMore)
+
+	rest, err := syncSvc.Changes(context.Background(), page.Token, 2)
+	require.NoError(t, err)
+	assert.Len(t, rest.Changes, 1)
+	assert.False(t, rest.HasMore)
+
+	_, err = syncSvc.Changes(context.Background(), "not-a-token", 0)
+	assert.ErrorIs(t, err, ErrInvalidSyncToken)
+}
+
+func TestSync_ApplyLastWriterWinsPerField(t *testing.T) {
+	repo := NewTodoRepository(createFileTestDB(t, filepath.Join(t.TempDir(), "sync.db")), logging.Discard())
+	todoSvc := NewTodoService(repo, logging.Discard())
+	syncSvc := NewSyncService(repo, logging.Discard())
+
+	todo, err := todoSvc.CreateTodo(context.Background(), &CreateTodoRequest{Title: "A", Description: "server"})
+	require.NoError(t, err)
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	resp, err := syncSvc.Apply(context.Background(), &SyncRequest{Changes: []SyncChange{{
+		ID:        todo.ID,
+		ClientRef: "c1",
+		Fields: map[string]SyncFieldValue{
+			FieldDescription: {Value: "stale", ModifiedAt: past},
+			FieldCompleted:   {Value: true, ModifiedAt: future},
+		},
+	}}})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 1)
+
+	res := resp.Results[0]
+	t.Logf("lww result: %+v", res)
+	assert.Equal(t, "c1", res.ClientRef)
+	assert.Equal(t, SyncStatusApplied, res.Status)
+	require.Len(t, res.Conflicts, 1)
+	assert.Equal(t, FieldDescription, res.Conflicts[0].Field)
+	assert.Equal(t, SyncResolutionServer, res.Conflicts[0].Resolution)
+
+	got, err := repo.GetByID(context.Background(), todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "server", got.Description)
+	assert.True(t, got.Completed)
+}
+
+func TestSync_ApplyReportsConflicts(t *testing.T) {
+	repo := NewTodoRepository(createFileTestDB(t, filepath.Join(t.TempDir(), "sync.db")), logging.Discard())
+	todoSvc := NewTodoService(repo, logging.Discard())
+	syncSvc := NewSyncService(repo, logging.Discard())
+
+	todo, err := todoSvc.CreateTodo(context.Background(), &CreateTodoRequest{Title: "A"})
+	require.NoError(t, err)
+	pulled, err := syncSvc.Changes(context.Background(), "", 0)
+	require.NoError(t, err)
+
+	// Server-side edit after the client pulled
+	_, err = todoSvc.UpdateTodo(context.Background(), todo.ID, &UpdateTodoRequest{Description: "server"})
+	require.NoError(t, err)
+
+	resp, err := syncSvc.Apply(context.Background(), &SyncRequest{
+		Strategy: SyncStrategyReport,
+		Changes: []SyncChange{{
+			ID:        todo.ID,
+			BaseToken: pulled.Token,
+			Fields: map[string]SyncFieldValue{
+				FieldDescription: {Value: "client", ModifiedAt: time.Now()},
+			},
+		}},
+	})
+	require.NoError(t, err)
+
+	res := resp.Results[0]
+	t.Logf("report result: %+v", res)
+	assert.Equal(t, SyncStatusConflict, res.Status)
+	require.Len(t, res.Conflicts, 1)
+	assert.Equal(t, "server", res.Conflicts[0].ServerValue)
+	assert.Equal(t, "client", res.Conflicts[0].ClientValue)
+	assert.Equal(t, SyncResolutionUnresolved, res.Conflicts[0].Resolution)
+
+	got, err := repo.GetByID(context.Background(), todo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "server", got.Description)
+
+	// The todo's own change token, as rendered to clients, is a finer base:
+	// later writes to other todos move the cursor but are not conflicts
+	body, err := json.Marshal(got)
+	require.NoError(t, err)
+	var rendered struct {
+		ChangeToken string `json:"change_token"`
+	}
+	require.NoError(t, json.Unmarshal(body, &rendered))
+	assert.Equal(t, FormatChangeToken(got.ChangeSeq), rendered.ChangeToken)
+	_, err = todoSvc.CreateTodo(context.Background(), &CreateTodoRequest{Title: "B"})
+	require.NoError(t, err)
+
+	resp, err = syncSvc.Apply(context.Background(), &SyncRequest{
+		Strategy: SyncStrategyReport,
+		Changes: []SyncChange{{
+			ID:        todo.ID,
+			BaseToken: rendered.ChangeToken,
+			Fields: map[string]SyncFieldValue{
+				FieldDescription: {Value: "client", ModifiedAt: time.Now()},
+			},
+		}},
+	})
+	require.NoError(t, err)
+	t.Logf("result with the todo's change token: %+v", resp.Results[0])
+	assert.Equal(t, SyncStatusApplied, resp.Results[0].Status)
+	assert.Empty(t, resp.Results[0].Conflicts)
+}
+
+func TestSync_ApplyCreateAndDelete(t *testing.T) {
+	repo := NewTodoRepository(createFileTestDB(t, filepath.Join(t.TempDir(), "sync.db")), logging.Discard())
+	syncSvc := NewSyncService(repo, logging.Discard())
+
+	resp, err := syncSvc.Apply(context.Background(), &SyncRequest{Changes: []SyncChange{
+		{ClientRef: "new", Fields: map[string]SyncFieldValue{FieldTitle: {Value: "Offline"}}},
+		{ClientRef: "dup", Fields: map[string]SyncFieldValue{FieldTitle: {Value: "Offline"}}},
+		{ClientRef: "bad", Fields: map[string]SyncFieldValue{"priority": {Value: 1.0}}},
+	}})
+	require.NoError(t, err)
+	require.Len(t, resp.Results, 3)
+	assert.Equal(t, SyncStatusCreated, resp.Results[0].Status)
+	assert.Equal(t, SyncStatusRejected, resp.Results[1].Status)
+	assert.Equal(t, SyncStatusRejected, resp.Results[2].Status)
+	t.Logf("create results: %+v", resp.Results)
+
+	id := resp.Results[0].ID
+	del, err := syncSvc.Apply(context.Background(), &SyncRequest{Changes: []SyncChange{
+		{ID: id, Deleted: true, ModifiedAt: time.Now().Add(time.Minute)},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, SyncStatusDeleted, del.Results[0].Status)
+	require.NotNil(t, del.Results[0].Todo)
+	assert.True(t, del.Results[0].Todo.DeletedAt.Valid)
+
+	_, err = repo.GetByID(context.Background(), id)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = syncSvc.Apply(context.Background(), &SyncRequest{Strategy: "merge"})
+	assert.ErrorIs(t, err, ErrInvalidSyncStrategy)
+}
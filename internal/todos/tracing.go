@@ -0,0 +1,129 @@
+package todos
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/drago44/golang-todo-api/internal/todos")
+
+// tracedTodoService decorates a TodoService with one span per method call.
+type tracedTodoService struct {
+	next TodoService
+}
+
+// WithTracing wraps svc so every call runs in its own span, a child of the
+// span carried by the caller's context.
+func WithTracing(svc TodoService) TodoService {
+	return &tracedTodoService{next: svc}
+}
+
+func (s *tracedTodoService) CreateTodo(ctx context.Context, req *CreateTodoRequest) (*Todo, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.CreateTodo")
+	defer span.End()
+
+	todo, err := s.next.CreateTodo(ctx, req)
+	if err == nil {
+		span.SetAttributes(attribute.Int64("todo.id", int64(todo.ID)))
+	}
+	recordError(span, err)
+	return todo, err
+}
+
+func (s *tracedTodoService) GetAllTodos(ctx context.Context) ([]Todo, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.GetAllTodos")
+	defer span.End()
+
+	todos, err := s.next.GetAllTodos(ctx)
+	span.SetAttributes(attribute.Int("todo.count", len(todos)))
+	recordError(span, err)
+	return todos, err
+}
+
+func (s *tracedTodoService) GetTodoByID(ctx context.Context, id uint) (*Todo, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.GetTodoByID", trace.WithAttributes(attribute.Int64("todo.id", int64(id))))
+	defer span.End()
+
+	todo, err := s.next.GetTodoByID(ctx, id)
+	recordError(span, err)
+	return todo, err
+}
+
+func (s *tracedTodoService) UpdateTodo(ctx context.Context, id uint, req *UpdateTodoRequest) (*Todo, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.UpdateTodo", trace.WithAttributes(attribute.Int64("todo.id", int64(id))))
+	defer span.End()
+
+	todo, err := s.next.UpdateTodo(ctx, id, req)
+	recordError(span, err)
+	return todo, err
+}
+
+func (s *tracedTodoService) DeleteTodo(ctx context.Context, id uint) error {
+	ctx, span := tracer.Start(ctx, "TodoService.DeleteTodo", trace.WithAttributes(attribute.Int64("todo.id", int64(id))))
+	defer span.End()
+
+	err := s.next.DeleteTodo(ctx, id)
+	recordError(span, err)
+	return err
+}
+
+func (s *tracedTodoService) ImportTodos(ctx context.Context, items []ImportItem, dryRun bool) (*ImportResponse, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.ImportTodos", trace.WithAttributes(
+		attribute.Int("import.rows", len(items)),
+		attribute.Bool("import.dry_run", dryRun),
+	))
+	defer span.End()
+
+	resp, err := s.next.ImportTodos(ctx, items, dryRun)
+	if err == nil {
+		span.SetAttributes(attribute.Int("import.created", resp.Created), attribute.Int("import.errors", len(resp.Errors)))
+	}
+	recordError(span, err)
+	return resp, err
+}
+
+func (s *tracedTodoService) ExportTodos(ctx context.Context, filter TodoFilter, fn func(Todo) error) error {
+	ctx, span := tracer.Start(ctx, "TodoService.ExportTodos")
+	defer span.End()
+
+	rows := 0
+	err := s.next.ExportTodos(ctx, filter, func(todo Todo) error {
+		rows++
+		return fn(todo)
+	})
+	span.SetAttributes(attribute.Int("export.rows", rows))
+	recordError(span, err)
+	return err
+}
+
+func (s *tracedTodoService) ListTodos(ctx context.Context, filter TodoFilter, limit, offset int) ([]Todo, int64, error) {
+	ctx, span := tracer.Start(ctx, "TodoService.ListTodos", trace.WithAttributes(
+		attribute.Int("page.limit", limit),
+		attribute.Int("page.offset", offset),
+	))
+	defer span.End()
+
+	todos, total, err := s.next.ListTodos(ctx, filter, limit, offset)
+	span.SetAttributes(attribute.Int("todo.count", len(todos)), attribute.Int64("todo.total", total))
+	recordError(span, err)
+	return todos, total, err
+}
+
+// recordError attaches err to the span. Domain errors caused by the client
+// are recorded as events only; everything else marks the span as failed.
+func recordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrTitleExists) || errors.Is(err, ErrTitleRequired) {
+		return
+	}
+	span.SetStatus(codes.Error, err.Error())
+}
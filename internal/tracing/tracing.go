@@ -0,0 +1,122 @@
+// Package tracing configures OpenTelemetry trace export and W3C trace context
+// propagation, and instruments GORM queries with spans.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// Supported span exporters.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+)
+
+// ServiceName identifies this application in exported spans.
+const ServiceName = "todo-api"
+
+// Config describes how spans are sampled and exported.
+type Config struct {
+	// Exporter is one of ExporterNone, ExporterStdout, ExporterFile or ExporterOTLP
+	Exporter string
+	// FilePath receives newline-delimited JSON spans for ExporterFile
+	FilePath string
+	// OTLPEndpoint is a host:port or URL of an OTLP/HTTP collector
+	OTLPEndpoint string
+	// OTLPInsecure disables TLS towards a host:port OTLPEndpoint
+	OTLPInsecure bool
+	// SampleRatio is the fraction of new root traces that are recorded
+	SampleRatio float64
+}
+
+// Setup installs the global propagator and tracer provider. Incoming
+// traceparent headers are honoured even when the exporter is "none", so
+// request logs still carry the caller's trace ID. The returned function
+// flushes pending spans and releases the exporter.
+func Setup(ctx context.Context, cfg Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	exporter, closeOutput, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(ServiceName)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("building trace resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		return errors.Join(tp.Shutdown(ctx), closeOutput())
+	}, nil
+}
+
+// newExporter creates the configured exporter; a nil exporter means tracing
+// is disabled. closeOutput releases any file opened for the exporter.
+func newExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, func() error, error) {
+	noClose := func() error { return nil }
+
+	switch strings.ToLower(cfg.Exporter) {
+	case "", ExporterNone:
+		return nil, noClose, nil
+	case ExporterStdout:
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		return exp, noClose, err
+	case ExporterFile:
+		f, err := os.OpenFile(cfg.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening trace file %s: %w", cfg.FilePath, err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, nil, err
+		}
+		return exp, f.Close, nil
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if strings.Contains(cfg.OTLPEndpoint, "://") {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+		} else {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.OTLPEndpoint))
+			if cfg.OTLPInsecure {
+				opts = append(opts, otlptracehttp.WithInsecure())
+			}
+		}
+		exp, err := otlptracehttp.New(ctx, opts...)
+		return exp, noClose, err
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+}
@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/drago44/golang-todo-api/internal/dbtest"
+	"github.com/drago44/golang-todo-api/internal/logging"
+	"github.com/drago44/golang-todo-api/internal/todos"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing_SpansFromHandlerToRepository(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterNone})
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+
+	db := dbtest.SQLite(t, "")
+	require.NoError(t, db.Use(GormPlugin()))
+
+	repo := todos.NewTodoRepository(db, logging.Discard())
+	svc := todos.WithTracing(todos.NewTodoService(repo, logging.Discard()))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(otelgin.Middleware(ServiceName))
+	todos.NewTodoHandler(svc).RegisterTodoRoutes(r.Group("/api/v1"))
+
+	const parentTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/todos", bytes.NewReader([]byte(`{"title":"traced"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+parentTraceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		t.Logf("span %s trace=%s parent=%s", s.Name(), s.SpanContext().TraceID(), s.Parent().SpanID())
+		assert.Equal(t, parentTraceID, s.SpanContext().TraceID().String(), s.Name())
+		spans[s.Name()] = s
+	}
+
+	server := spans["POST /api/v1/todos"]
+	service := spans["TodoService.CreateTodo"]
+	require.NotNil(t, server)
+	require.NotNil(t, service)
+	assert.Equal(t, server.SpanContext().SpanID(), service.Parent().SpanID())
+
+	create := spans["gorm.create"]
+	require.NotNil(t, create)
+	assert.Equal(t, service.SpanContext().SpanID(), create.Parent().SpanID())
+	assert.Contains(t, spans, "gorm.query", "title uniqueness check should be traced")
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), Config{Exporter: "zipkin"})
+	assert.Error(t, err)
+}
+
+func TestSetup_FileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterFile, FilePath: path, SampleRatio: 1})
+	require.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "file-span")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	assert.FileExists(t, path)
+}